@@ -0,0 +1,162 @@
+package Analysis
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/Matcher"
+	"unicode"
+)
+
+type AmbiguityKind int
+
+const (
+	// SameMatch means both branches match the example.
+	SameMatch AmbiguityKind = iota
+	// PrefixMatch means the first branch matches the example and the
+	// second branch can continue it.
+	PrefixMatch
+	// SharedStart means both branches can start with the example.
+	SharedStart
+)
+
+// Ambiguity is a pair of branches of an alternative that a sampler cannot
+// tell apart from the first character.
+type Ambiguity struct {
+	Alternative *GBNFParser.Node
+	// First and Second are indexes of the branches of Alternative. For a
+	// PrefixMatch, First is the branch matching the example.
+	First   int
+	Second  int
+	Kind    AmbiguityKind
+	Example string
+}
+
+// maxExampleLength bounds the search for an example.
+const maxExampleLength = 32
+
+// Ambiguities finds the branches of alternatives in declarations whose FIRST
+// sets overlap, with an example of the overlap. The declarations may refer to
+// any rule of the analysed grammar, which must compile for matching.
+func (analysis *Analysis) Ambiguities(declarations []*GBNFParser.Node) ([]Ambiguity, error) {
+	alternatives := []*GBNFParser.Node{}
+	for _, declaration := range declarations {
+		alternatives = append(alternatives, collectAlternatives(declaration.Children)...)
+	}
+
+	// Each branch becomes a rule of its own so the matcher can follow it.
+	// The names cannot clash with identifiers as they contain spaces.
+	ast := &GBNFParser.Node{Type: GBNFParser.NodeRoot}
+	for _, name := range analysis.names {
+		ast.Children = append(ast.Children, analysis.declarations[name])
+	}
+	for index, alternative := range alternatives {
+		for branchIndex, branch := range Branches(alternative) {
+			ast.Children = append(ast.Children, &GBNFParser.Node{
+				Type:     GBNFParser.NodeDeclaration,
+				Token:    &GBNFParser.Token{Type: GBNFParser.TokenIdentifier, Value: branchRuleName(index, branchIndex)},
+				Children: branch,
+			})
+		}
+	}
+	grammar, err := Matcher.Compile(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	ambiguities := []Ambiguity{}
+	for index, alternative := range alternatives {
+		branches := Branches(alternative)
+		for first := range branches {
+			firstSet, _ := analysis.ExpressionFirst(branches[first])
+			for second := first + 1; second < len(branches); second++ {
+				secondSet, _ := analysis.ExpressionFirst(branches[second])
+				if len(GBNFParser.IntersectRanges(firstSet, secondSet)) == 0 {
+					continue
+				}
+				ambiguity, err := findExample(grammar, branchRuleName(index, first), branchRuleName(index, second))
+				if err != nil {
+					return nil, err
+				}
+				pair := [2]int{first, second}
+				ambiguity.Alternative = alternative
+				ambiguity.First, ambiguity.Second = pair[ambiguity.First], pair[ambiguity.Second]
+				ambiguities = append(ambiguities, ambiguity)
+			}
+		}
+	}
+	return ambiguities, nil
+}
+
+func branchRuleName(alternative int, branch int) string {
+	return fmt.Sprintf("alternative %d branch %d", alternative, branch)
+}
+
+// collectAlternatives returns the alternative nodes in nodes, outermost
+// first.
+func collectAlternatives(nodes []*GBNFParser.Node) []*GBNFParser.Node {
+	alternatives := []*GBNFParser.Node{}
+	for _, node := range nodes {
+		if node.Type == GBNFParser.NodeAlternative {
+			alternatives = append(alternatives, node)
+		}
+		alternatives = append(alternatives, collectAlternatives(node.Children)...)
+	}
+	return alternatives
+}
+
+// findExample walks both branches along characters they have in common,
+// looking for a text both match. Failing that, it settles for a text one
+// branch matches and the other continues, or else for the common start.
+// First and Second of the result are 0 for firstRule and 1 for secondRule.
+func findExample(grammar *Matcher.Grammar, firstRule string, secondRule string) (Ambiguity, error) {
+	first, err := grammar.NewMatcher(firstRule)
+	if err != nil {
+		return Ambiguity{}, err
+	}
+	second, err := grammar.NewMatcher(secondRule)
+	if err != nil {
+		return Ambiguity{}, err
+	}
+
+	example := []rune{}
+	var prefix *Ambiguity
+	for len(example) < maxExampleLength {
+		if len(example) > 0 {
+			firstComplete, secondComplete := first.IsComplete(), second.IsComplete()
+			switch {
+			case firstComplete && secondComplete:
+				return Ambiguity{Kind: SameMatch, Example: string(example), First: 0, Second: 1}, nil
+			case prefix == nil && firstComplete && len(second.Next()) > 0:
+				prefix = &Ambiguity{Kind: PrefixMatch, Example: string(example), First: 0, Second: 1}
+			case prefix == nil && secondComplete && len(first.Next()) > 0:
+				prefix = &Ambiguity{Kind: PrefixMatch, Example: string(example), First: 1, Second: 0}
+			}
+		}
+
+		common := GBNFParser.IntersectRanges(first.Next(), second.Next())
+		if len(common) == 0 {
+			break
+		}
+		char := exampleChar(common)
+		first.Accept(char)
+		second.Accept(char)
+		example = append(example, char)
+	}
+
+	if prefix != nil {
+		return *prefix, nil
+	}
+	return Ambiguity{Kind: SharedStart, Example: string(example), First: 0, Second: 1}, nil
+}
+
+// exampleChar picks a character from ranges, preferring a visible one.
+func exampleChar(ranges []GBNFParser.CharRange) rune {
+	for _, charRange := range ranges {
+		for char := charRange.Low; char <= charRange.High && char < charRange.Low+256; char++ {
+			if unicode.IsGraphic(char) && !unicode.IsSpace(char) {
+				return char
+			}
+		}
+	}
+	return ranges[0].Low
+}
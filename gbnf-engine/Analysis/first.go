@@ -0,0 +1,146 @@
+package Analysis
+
+import (
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"slices"
+)
+
+// Analysis holds what is known about the rules of a grammar.
+type Analysis struct {
+	declarations map[string]*GBNFParser.Node
+	// names lists the declared rules in the order of the grammar.
+	names    []string
+	nullable map[string]bool
+	first    map[string][]GBNFParser.CharRange
+	follow   map[string][]GBNFParser.CharRange
+	// followLiterals holds the texts spelled out right after each rule.
+	followLiterals map[string][]string
+	followEnd      map[string]bool
+}
+
+// Analyze computes the FIRST and FOLLOW sets and the nullability of the
+// rules of a grammar.
+func Analyze(ast *GBNFParser.Node) *Analysis {
+	analysis := &Analysis{
+		declarations: map[string]*GBNFParser.Node{},
+		nullable:     map[string]bool{},
+		first:        map[string][]GBNFParser.CharRange{},
+	}
+	for _, node := range GBNFParser.EffectiveDeclarations(ast) {
+		analysis.names = append(analysis.names, node.Token.Value)
+		analysis.declarations[node.Token.Value] = node
+	}
+
+	// The sets only grow, so iterating until nothing changes terminates,
+	// also for recursive rules.
+	for changed := true; changed; {
+		changed = false
+		for _, name := range analysis.names {
+			first, nullable := analysis.ExpressionFirst(analysis.declarations[name].Children)
+			if nullable != analysis.nullable[name] || !slices.Equal(first, analysis.first[name]) {
+				analysis.nullable[name], analysis.first[name] = nullable, first
+				changed = true
+			}
+		}
+	}
+	analysis.computeFollow()
+	return analysis
+}
+
+// Rules lists the declared rules in the order of the grammar.
+func (analysis *Analysis) Rules() []string {
+	return slices.Clone(analysis.names)
+}
+
+// Nullable tells whether rule matches the empty string.
+func (analysis *Analysis) Nullable(rule string) bool {
+	return analysis.nullable[rule]
+}
+
+// First returns the characters a match of rule can start with.
+func (analysis *Analysis) First(rule string) []GBNFParser.CharRange {
+	return analysis.first[rule]
+}
+
+// ExpressionFirst returns the characters a sequence of nodes can start with
+// and whether it matches the empty string.
+func (analysis *Analysis) ExpressionFirst(nodes []*GBNFParser.Node) ([]GBNFParser.CharRange, bool) {
+	first := []GBNFParser.CharRange{}
+	for _, node := range nodes {
+		nodeFirst, nullable := analysis.nodeFirst(node)
+		first = append(first, nodeFirst...)
+		if !nullable {
+			return GBNFParser.MergeRanges(first), false
+		}
+	}
+	return GBNFParser.MergeRanges(first), true
+}
+
+func (analysis *Analysis) nodeFirst(node *GBNFParser.Node) ([]GBNFParser.CharRange, bool) {
+	switch node.Type {
+	case GBNFParser.NodeToken:
+		return analysis.tokenFirst(node.Token)
+	case GBNFParser.NodeSubExpression:
+		return analysis.ExpressionFirst(node.Children)
+	case GBNFParser.NodeAlternative:
+		first := []GBNFParser.CharRange{}
+		nullable := false
+		for _, branch := range Branches(node) {
+			branchFirst, branchNullable := analysis.ExpressionFirst(branch)
+			first = append(first, branchFirst...)
+			nullable = nullable || branchNullable
+		}
+		return GBNFParser.MergeRanges(first), nullable
+	case GBNFParser.NodeRepeat:
+		if node.Max == 0 {
+			return []GBNFParser.CharRange{}, true
+		}
+		first, nullable := analysis.nodeFirst(node.Children[0])
+		return first, nullable || node.Min == 0
+	default:
+		return []GBNFParser.CharRange{}, true
+	}
+}
+
+func (analysis *Analysis) tokenFirst(token *GBNFParser.Token) ([]GBNFParser.CharRange, bool) {
+	switch token.Type {
+	case GBNFParser.TokenString:
+		text, err := GBNFParser.UnescapeString(token.Value)
+		if err != nil || text == "" {
+			return []GBNFParser.CharRange{}, err == nil
+		}
+		char := []rune(text)[0]
+		return []GBNFParser.CharRange{{Low: char, High: char}}, false
+	case GBNFParser.TokenRegexp:
+		ranges, negated, err := GBNFParser.ParseCharClass(token.Value)
+		if err != nil {
+			return []GBNFParser.CharRange{}, false
+		}
+		if negated {
+			return GBNFParser.InvertRanges(ranges), false
+		}
+		return GBNFParser.MergeRanges(ranges), false
+	case GBNFParser.TokenIdentifier:
+		// Undeclared rules match nothing.
+		return analysis.first[token.Value], analysis.nullable[token.Value]
+	default:
+		return []GBNFParser.CharRange{}, true
+	}
+}
+
+// Branches returns the sequences of the branches of an alternative node. An
+// empty branch is an empty sequence.
+func Branches(alternative *GBNFParser.Node) [][]*GBNFParser.Node {
+	branches := [][]*GBNFParser.Node{}
+	for _, child := range alternative.Children {
+		switch child.Type {
+		case GBNFParser.NodeSubExpression:
+			branches = append(branches, child.Children)
+		case GBNFParser.NodeUnknown:
+			branches = append(branches, []*GBNFParser.Node{})
+		default:
+			branches = append(branches, []*GBNFParser.Node{child})
+		}
+	}
+	return branches
+}
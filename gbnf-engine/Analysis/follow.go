@@ -0,0 +1,114 @@
+package Analysis
+
+import (
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"slices"
+)
+
+// StartRule is the rule a grammar's matches start from, which the end of the
+// text may follow.
+const StartRule = "root"
+
+// context is what may follow a node inside a declaration: characters and
+// the literals spelled out from there, and, if inherited is set, whatever
+// follows the declaration itself.
+type context struct {
+	first     []GBNFParser.CharRange
+	literals  []string
+	inherited bool
+}
+
+// computeFollow computes the FOLLOW sets of all rules, iterating until they
+// no longer grow.
+func (analysis *Analysis) computeFollow() {
+	analysis.follow = map[string][]GBNFParser.CharRange{}
+	analysis.followLiterals = map[string][]string{}
+	analysis.followEnd = map[string]bool{}
+	if _, ok := analysis.declarations[StartRule]; ok {
+		analysis.followEnd[StartRule] = true
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, name := range analysis.names {
+			analysis.sequenceFollow(name, analysis.declarations[name].Children, context{inherited: true}, &changed)
+		}
+	}
+}
+
+// sequenceFollow records what follows the rules referenced in nodes, given
+// what follows the whole sequence.
+func (analysis *Analysis) sequenceFollow(declaration string, nodes []*GBNFParser.Node, after context, changed *bool) {
+	for index := len(nodes) - 1; index >= 0; index-- {
+		analysis.nodeFollow(declaration, nodes[index], after, changed)
+		first, nullable := analysis.nodeFirst(nodes[index])
+		literals := analysis.sequenceLiterals(nodes[index:], map[string]bool{})
+		if nullable {
+			after = context{first: GBNFParser.MergeRanges(slices.Concat(first, after.first)), literals: slices.Concat(literals, after.literals), inherited: after.inherited}
+		} else {
+			after = context{first: first, literals: literals}
+		}
+	}
+}
+
+func (analysis *Analysis) nodeFollow(declaration string, node *GBNFParser.Node, after context, changed *bool) {
+	switch node.Type {
+	case GBNFParser.NodeToken:
+		if node.Token.Type != GBNFParser.TokenIdentifier {
+			return
+		}
+		name := node.Token.Value
+		if _, ok := analysis.declarations[name]; !ok {
+			return
+		}
+		follow, literals := after.first, after.literals
+		end := false
+		if after.inherited {
+			follow = slices.Concat(follow, analysis.follow[declaration])
+			literals = slices.Concat(literals, analysis.followLiterals[declaration])
+			end = analysis.followEnd[declaration]
+		}
+		merged := GBNFParser.MergeRanges(slices.Concat(follow, analysis.follow[name]))
+		mergedLiterals := slices.Concat(literals, analysis.followLiterals[name])
+		slices.Sort(mergedLiterals)
+		mergedLiterals = slices.Compact(mergedLiterals)
+		if !slices.Equal(merged, analysis.follow[name]) || !slices.Equal(mergedLiterals, analysis.followLiterals[name]) || (end && !analysis.followEnd[name]) {
+			analysis.follow[name] = merged
+			analysis.followLiterals[name] = mergedLiterals
+			analysis.followEnd[name] = analysis.followEnd[name] || end
+			*changed = true
+		}
+	case GBNFParser.NodeSubExpression:
+		analysis.sequenceFollow(declaration, node.Children, after, changed)
+	case GBNFParser.NodeAlternative:
+		for _, branch := range Branches(node) {
+			analysis.sequenceFollow(declaration, branch, after, changed)
+		}
+	case GBNFParser.NodeRepeat:
+		if node.Max == -1 || node.Max > 1 {
+			// A repeated node may be followed by another copy of itself.
+			first, _ := analysis.nodeFirst(node.Children[0])
+			literals := analysis.nodeLiterals(node.Children[0], map[string]bool{})
+			after = context{first: GBNFParser.MergeRanges(slices.Concat(after.first, first)), literals: slices.Concat(after.literals, literals), inherited: after.inherited}
+		}
+		analysis.nodeFollow(declaration, node.Children[0], after, changed)
+	}
+}
+
+// Follow returns the characters that may come right after a match of rule.
+func (analysis *Analysis) Follow(rule string) []GBNFParser.CharRange {
+	return analysis.follow[rule]
+}
+
+// FollowLiterals returns the texts the grammar spells out right after a
+// match of rule, like FirstLiterals does for its start. Characters that
+// follow rule as part of a character class are only in Follow.
+func (analysis *Analysis) FollowLiterals(rule string) []string {
+	return slices.Clone(analysis.followLiterals[rule])
+}
+
+// FollowedByEnd tells whether a match of rule may end the text, that is
+// whether it can come last in a match of StartRule.
+func (analysis *Analysis) FollowedByEnd(rule string) bool {
+	return analysis.followEnd[rule]
+}
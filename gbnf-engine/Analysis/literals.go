@@ -0,0 +1,79 @@
+package Analysis
+
+import (
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"slices"
+)
+
+// FirstLiterals returns the texts the grammar spells out at the start of a
+// match of rule, such as "true" and "null" for a JSON value. A branch that
+// starts with a character class adds nothing; its characters are in First.
+func (analysis *Analysis) FirstLiterals(rule string) []string {
+	literals := analysis.ruleLiterals(rule, map[string]bool{})
+	slices.Sort(literals)
+	return slices.Compact(literals)
+}
+
+func (analysis *Analysis) ruleLiterals(rule string, visiting map[string]bool) []string {
+	declaration, ok := analysis.declarations[rule]
+	if !ok || visiting[rule] {
+		return nil
+	}
+	visiting[rule] = true
+	defer delete(visiting, rule)
+	return analysis.sequenceLiterals(declaration.Children, visiting)
+}
+
+// sequenceLiterals joins the string literals a sequence starts with. If it
+// starts with anything else, the literals of that node are used instead, and
+// if that node can match the empty string, those of the rest of the sequence
+// as well.
+func (analysis *Analysis) sequenceLiterals(nodes []*GBNFParser.Node, visiting map[string]bool) []string {
+	text := ""
+	for index, node := range nodes {
+		if node.Type != GBNFParser.NodeToken || node.Token.Type != GBNFParser.TokenString {
+			if text != "" {
+				break
+			}
+			literals := analysis.nodeLiterals(node, visiting)
+			if _, nullable := analysis.nodeFirst(node); nullable {
+				literals = append(literals, analysis.sequenceLiterals(nodes[index+1:], visiting)...)
+			}
+			return literals
+		}
+		value, err := GBNFParser.UnescapeString(node.Token.Value)
+		if err != nil {
+			break
+		}
+		text += value
+	}
+	if text == "" {
+		return nil
+	}
+	return []string{text}
+}
+
+func (analysis *Analysis) nodeLiterals(node *GBNFParser.Node, visiting map[string]bool) []string {
+	switch node.Type {
+	case GBNFParser.NodeToken:
+		switch node.Token.Type {
+		case GBNFParser.TokenString:
+			return analysis.sequenceLiterals([]*GBNFParser.Node{node}, visiting)
+		case GBNFParser.TokenIdentifier:
+			return analysis.ruleLiterals(node.Token.Value, visiting)
+		}
+	case GBNFParser.NodeSubExpression:
+		return analysis.sequenceLiterals(node.Children, visiting)
+	case GBNFParser.NodeAlternative:
+		literals := []string{}
+		for _, branch := range Branches(node) {
+			literals = append(literals, analysis.sequenceLiterals(branch, visiting)...)
+		}
+		return literals
+	case GBNFParser.NodeRepeat:
+		if node.Max != 0 {
+			return analysis.nodeLiterals(node.Children[0], visiting)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package Analysis
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"math"
+)
+
+// Metrics describes how costly a rule is for a sampler like llama.cpp's,
+// which expands repetitions into copies and keeps a stack per nesting level.
+type Metrics struct {
+	// Depth is how deeply groups, alternatives and repetitions nest in the
+	// declaration.
+	Depth int
+	// ExpandedSize estimates the number of grammar elements of the
+	// declaration once `{m,n}` bounds are unrolled, counting a character of a
+	// literal, a character class and a rule reference as one element each.
+	// It saturates at math.MaxInt32.
+	ExpandedSize int
+	// FanOut is the largest number of branches of an alternative, or 1 if
+	// the declaration has none.
+	FanOut int
+	// Recursive is set if the rule can refer back to itself.
+	Recursive bool
+}
+
+// Thresholds bound the metrics beyond which a rule is considered slow to
+// sample. A bound of zero or less is not checked.
+type Thresholds struct {
+	MaxDepth        int
+	MaxExpandedSize int
+	MaxFanOut       int
+}
+
+// DefaultThresholds are lenient enough for common grammars, such as those
+// generated from JSON schemas, yet flag the grammars llama.cpp struggles with.
+var DefaultThresholds = Thresholds{
+	MaxDepth:        10,
+	MaxExpandedSize: 1000,
+	MaxFanOut:       32,
+}
+
+// Metrics measures the declaration of rule. Unknown rules measure zero.
+func (analysis *Analysis) Metrics(rule string) Metrics {
+	declaration, ok := analysis.declarations[rule]
+	if !ok {
+		return Metrics{}
+	}
+	metrics := Metrics{FanOut: 1, Recursive: analysis.reaches(rule, rule, map[string]bool{})}
+	metrics.Depth, metrics.ExpandedSize = measureSequence(declaration.Children, &metrics.FanOut)
+	return metrics
+}
+
+// Warnings describes the metrics exceeding thresholds, such as "nesting depth
+// 12 exceeds 10".
+func (metrics Metrics) Warnings(thresholds Thresholds) []string {
+	warnings := []string{}
+	if thresholds.MaxDepth > 0 && metrics.Depth > thresholds.MaxDepth {
+		warnings = append(warnings, fmt.Sprintf("nesting depth %d exceeds %d", metrics.Depth, thresholds.MaxDepth))
+	}
+	if thresholds.MaxExpandedSize > 0 && metrics.ExpandedSize > thresholds.MaxExpandedSize {
+		warnings = append(warnings, fmt.Sprintf("expands to about %d elements, more than %d", metrics.ExpandedSize, thresholds.MaxExpandedSize))
+	}
+	if thresholds.MaxFanOut > 0 && metrics.FanOut > thresholds.MaxFanOut {
+		warnings = append(warnings, fmt.Sprintf("alternative with %d branches exceeds %d", metrics.FanOut, thresholds.MaxFanOut))
+	}
+	return warnings
+}
+
+// reaches tells whether rule refers to target, directly or through other
+// rules.
+func (analysis *Analysis) reaches(rule string, target string, visited map[string]bool) bool {
+	declaration, ok := analysis.declarations[rule]
+	if !ok || visited[rule] {
+		return false
+	}
+	visited[rule] = true
+	for _, reference := range references(declaration.Children) {
+		if reference == target || analysis.reaches(reference, target, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// references lists the rules referred to in nodes.
+func references(nodes []*GBNFParser.Node) []string {
+	names := []string{}
+	for _, node := range nodes {
+		if node.Type == GBNFParser.NodeToken && node.Token.Type == GBNFParser.TokenIdentifier {
+			names = append(names, node.Token.Value)
+		}
+		names = append(names, references(node.Children)...)
+	}
+	return names
+}
+
+// measureSequence returns the depth and expanded size of a sequence, raising
+// fanOut to the widest alternative in it.
+func measureSequence(nodes []*GBNFParser.Node, fanOut *int) (int, int) {
+	depth, size := 0, 0
+	for _, node := range nodes {
+		nodeDepth, nodeSize := measureNode(node, fanOut)
+		depth = max(depth, nodeDepth)
+		size = saturatedAdd(size, nodeSize)
+	}
+	return depth, size
+}
+
+func measureNode(node *GBNFParser.Node, fanOut *int) (int, int) {
+	switch node.Type {
+	case GBNFParser.NodeToken:
+		if node.Token.Type == GBNFParser.TokenString {
+			text, err := GBNFParser.UnescapeString(node.Token.Value)
+			if err == nil {
+				return 0, len([]rune(text))
+			}
+		}
+		return 0, 1
+	case GBNFParser.NodeSubExpression:
+		depth, size := measureSequence(node.Children, fanOut)
+		return depth + 1, size
+	case GBNFParser.NodeAlternative:
+		branches := Branches(node)
+		*fanOut = max(*fanOut, len(branches))
+		depth, size := 0, 0
+		for _, branch := range branches {
+			branchDepth, branchSize := measureSequence(branch, fanOut)
+			depth = max(depth, branchDepth)
+			size = saturatedAdd(size, branchSize)
+		}
+		return depth + 1, size
+	case GBNFParser.NodeRepeat:
+		depth, size := measureNode(node.Children[0], fanOut)
+		// Like llama.cpp, x{m,n} becomes n copies of x, m of them required,
+		// and x{m,} becomes m copies followed by x*.
+		copies := node.Max
+		if node.Max == -1 {
+			copies = node.Min + 1
+		}
+		copies = max(copies, 0)
+		return depth + 1, saturatedMultiply(size, copies)
+	default:
+		return 0, 0
+	}
+}
+
+func saturatedAdd(a int, b int) int {
+	return min(a+b, math.MaxInt32)
+}
+
+func saturatedMultiply(a int, b int) int {
+	if a != 0 && b > math.MaxInt32/a {
+		return math.MaxInt32
+	}
+	return min(a*b, math.MaxInt32)
+}
@@ -0,0 +1,132 @@
+package Formats
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// antlrDialect writes ANTLR 4 grammars. GBNF works on characters, so every
+// rule becomes a lexer rule; the root rule is the only token, which a parser
+// rule requires to span the whole input.
+type antlrDialect struct{}
+
+func (antlrDialect) ruleName(name string) string {
+	name = strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	if !unicode.IsLetter([]rune(name)[0]) {
+		name = "R_" + name
+	}
+	return name
+}
+
+func (antlrDialect) reserved() []string {
+	return []string{"EOF"}
+}
+
+func (antlrDialect) literal(text string) string {
+	var builder strings.Builder
+	builder.WriteRune('\'')
+	for _, char := range text {
+		builder.WriteString(antlrEscape(char, `'`))
+	}
+	builder.WriteRune('\'')
+	return builder.String()
+}
+
+func (antlrDialect) charClass(ranges []GBNFParser.CharRange, negated bool) string {
+	var builder strings.Builder
+	if negated {
+		builder.WriteRune('~')
+	}
+	builder.WriteRune('[')
+	for _, charRange := range ranges {
+		builder.WriteString(antlrEscape(charRange.Low, `]-`))
+		if charRange.High != charRange.Low {
+			builder.WriteString("-" + antlrEscape(charRange.High, `]-`))
+		}
+	}
+	builder.WriteRune(']')
+	return builder.String()
+}
+
+// antlrEscape escapes char for an ANTLR literal or set, escaping the
+// characters in special with a backslash.
+func antlrEscape(char rune, special string) string {
+	switch {
+	case char == '\\':
+		return `\\`
+	case char == '\n':
+		return `\n`
+	case char == '\r':
+		return `\r`
+	case char == '\t':
+		return `\t`
+	case strings.ContainsRune(special, char):
+		return `\` + string(char)
+	case unicode.IsPrint(char) || char == ' ':
+		return string(char)
+	case char < 0x10000:
+		return fmt.Sprintf(`\u%04X`, char)
+	default:
+		return fmt.Sprintf(`\u{%X}`, char)
+	}
+}
+
+func (antlrDialect) repeat(atom string, min int, max int) (string, bool) {
+	return "", false
+}
+
+func (antlrDialect) header(grammarName string, start string) string {
+	header := "// Generated by gbnf-engine export.\ngrammar " + antlrGrammarName(grammarName) + ";\n\n"
+	if start != "" {
+		header += "root : " + start + " EOF ;\n\n"
+	}
+	return header
+}
+
+func (antlrDialect) rule(name string, body string, start bool) string {
+	if start {
+		return name + " : " + body + " ;\n"
+	}
+	return "fragment " + name + " : " + body + " ;\n"
+}
+
+// antlrKeywords cannot be used as grammar names.
+var antlrKeywords = []string{"catch", "channels", "finally", "fragment", "grammar", "import", "lexer", "locals", "mode", "options", "parser", "returns", "throws", "tokens"}
+
+// antlrGrammarName turns a name into a grammar name. ANTLR requires it to
+// match the file name, so a name that is valid already is kept as it is.
+func antlrGrammarName(name string) string {
+	if isANTLRIdentifier(name) && !slices.Contains(antlrKeywords, name) {
+		return name
+	}
+	var builder strings.Builder
+	upper := true
+	for _, char := range name {
+		switch {
+		case unicode.IsLetter(char) || unicode.IsDigit(char) && builder.Len() > 0:
+			if upper {
+				char = unicode.ToUpper(char)
+			}
+			builder.WriteRune(char)
+			upper = false
+		default:
+			upper = true
+		}
+	}
+	if builder.Len() == 0 {
+		return "Grammar"
+	}
+	return builder.String()
+}
+
+func isANTLRIdentifier(name string) bool {
+	for index, char := range name {
+		if !unicode.IsLetter(char) && (index == 0 || !unicode.IsDigit(char) && char != '_') {
+			return false
+		}
+	}
+	return name != ""
+}
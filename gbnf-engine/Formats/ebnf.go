@@ -0,0 +1,88 @@
+package Formats
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"strings"
+)
+
+// ebnfDialect writes the EBNF notation of the W3C XML specification, which
+// has no escapes: other characters are written as #xN.
+type ebnfDialect struct{}
+
+func (ebnfDialect) ruleName(name string) string {
+	return name
+}
+
+func (ebnfDialect) reserved() []string {
+	return nil
+}
+
+func (ebnfDialect) literal(text string) string {
+	parts := []string{}
+	var run strings.Builder
+	flush := func() {
+		if run.Len() > 0 {
+			parts = append(parts, `"`+run.String()+`"`)
+			run.Reset()
+		}
+	}
+	for _, char := range text {
+		switch {
+		case char == '"':
+			flush()
+			parts = append(parts, `'"'`)
+		case ' ' <= char && char <= '~':
+			run.WriteRune(char)
+		default:
+			flush()
+			parts = append(parts, ebnfCharRef(char))
+		}
+	}
+	flush()
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+func (ebnfDialect) charClass(ranges []GBNFParser.CharRange, negated bool) string {
+	var builder strings.Builder
+	builder.WriteRune('[')
+	if negated {
+		builder.WriteRune('^')
+	}
+	for _, charRange := range ranges {
+		builder.WriteString(ebnfClassChar(charRange.Low))
+		if charRange.High != charRange.Low {
+			builder.WriteString("-" + ebnfClassChar(charRange.High))
+		}
+	}
+	builder.WriteRune(']')
+	return builder.String()
+}
+
+// ebnfClassChar writes letters and digits as themselves and other characters
+// as #xN, which is always unambiguous in a class.
+func ebnfClassChar(char rune) string {
+	if 'a' <= char && char <= 'z' || 'A' <= char && char <= 'Z' || '0' <= char && char <= '9' {
+		return string(char)
+	}
+	return ebnfCharRef(char)
+}
+
+func ebnfCharRef(char rune) string {
+	return fmt.Sprintf("#x%X", char)
+}
+
+func (ebnfDialect) repeat(atom string, min int, max int) (string, bool) {
+	return "", false
+}
+
+func (ebnfDialect) header(grammarName string, start string) string {
+	return "/* Generated by gbnf-engine export. */\n\n"
+}
+
+func (ebnfDialect) rule(name string, body string, start bool) string {
+	return name + " ::= " + body + "\n"
+}
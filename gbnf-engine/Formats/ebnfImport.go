@@ -0,0 +1,181 @@
+package Formats
+
+import (
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// lexEBNF splits a W3C or ISO EBNF grammar into tokens. Brackets hold a
+// character class in W3C grammars and an optional group in ISO grammars,
+// and `?` starts a special sequence in ISO grammars, so the dialect is
+// decided once, by the first definition.
+func lexEBNF(text string) []sourceToken {
+	lexer := &sourceLexer{input: []rune(text)}
+	tokens := []sourceToken{}
+	w3c := isW3C(text)
+	for {
+		char := lexer.peekAt(0)
+		line, column := lexer.line, lexer.column
+		switch {
+		case char == 0:
+			return append(tokens, lexer.token(sourceEOF, "", line, column))
+		case unicode.IsSpace(char):
+			lexer.next()
+		case lexer.hasPrefix("/*") || lexer.hasPrefix("(*"):
+			closing := "*/"
+			if char == '(' {
+				closing = "*)"
+			}
+			lexer.next()
+			lexer.next()
+			for !lexer.hasPrefix(closing) && lexer.peekAt(0) != 0 {
+				lexer.next()
+			}
+			if lexer.peekAt(0) == 0 {
+				tokens = append(tokens, lexer.token(sourceInvalid, "unterminated comment", line, column))
+				continue
+			}
+			lexer.next()
+			lexer.next()
+		case char == '"' || char == '\'':
+			tokens = append(tokens, lexEBNFString(lexer))
+		case char == '#' && lexer.peekAt(1) == 'x':
+			tokens = append(tokens, lexEBNFCharRef(lexer))
+		case char == '[' && w3c:
+			tokens = append(tokens, lexEBNFClass(lexer))
+		case char == '?' && !w3c:
+			lexer.next()
+			for lexer.peekAt(0) != '?' && lexer.peekAt(0) != 0 {
+				lexer.next()
+			}
+			if lexer.peekAt(0) == 0 {
+				tokens = append(tokens, lexer.token(sourceInvalid, "unterminated special sequence", line, column))
+				continue
+			}
+			lexer.next()
+			tokens = append(tokens, lexer.token(sourceSpecial, "?", line, column))
+		case unicode.IsLetter(char) || char == '_':
+			tokens = append(tokens, lexer.lexName(true))
+		case unicode.IsDigit(char):
+			tokens = append(tokens, lexer.lexNumber())
+		case lexer.hasPrefix("::="):
+			for range 3 {
+				lexer.next()
+			}
+			tokens = append(tokens, lexer.token(sourcePunctuation, "::=", line, column))
+		default:
+			lexer.next()
+			if !strings.ContainsRune("=|,;.()[]{}?*+-", char) {
+				tokens = append(tokens, lexer.token(sourceInvalid, "unexpected character `"+string(char)+"`", line, column))
+				continue
+			}
+			tokens = append(tokens, lexer.token(sourcePunctuation, string(char), line, column))
+		}
+	}
+}
+
+// isW3C reports whether the first definition of an EBNF grammar uses the
+// W3C `::=` rather than the ISO `=`. A grammar without definitions is read
+// as W3C.
+func isW3C(text string) bool {
+	lexer := &sourceLexer{input: []rune(text)}
+	for lexer.peekAt(0) != 0 {
+		switch {
+		case lexer.hasPrefix("/*") || lexer.hasPrefix("(*"):
+			closing := "*/"
+			if lexer.peekAt(0) == '(' {
+				closing = "*)"
+			}
+			for !lexer.hasPrefix(closing) && lexer.peekAt(0) != 0 {
+				lexer.next()
+			}
+		case lexer.hasPrefix("::="):
+			return true
+		case lexer.peekAt(0) == '=':
+			return false
+		}
+		lexer.next()
+	}
+	return true
+}
+
+// lexEBNFString reads a string literal, which has no escape sequences.
+func lexEBNFString(lexer *sourceLexer) sourceToken {
+	line, column := lexer.line, lexer.column
+	quote := lexer.next()
+	var builder strings.Builder
+	for lexer.peekAt(0) != quote {
+		if lexer.peekAt(0) == 0 || lexer.peekAt(0) == '\n' {
+			return lexer.token(sourceInvalid, "unterminated string", line, column)
+		}
+		builder.WriteRune(lexer.next())
+	}
+	lexer.next()
+	return lexer.token(sourceLiteral, builder.String(), line, column)
+}
+
+// lexEBNFCharRef reads a character written as `#xN`.
+func lexEBNFCharRef(lexer *sourceLexer) sourceToken {
+	line, column := lexer.line, lexer.column
+	char, ok := lexHexChar(lexer)
+	if !ok {
+		return lexer.token(sourceInvalid, "invalid character reference", line, column)
+	}
+	return lexer.token(sourceLiteral, string(char), line, column)
+}
+
+func lexHexChar(lexer *sourceLexer) (rune, bool) {
+	lexer.next()
+	lexer.next()
+	var hex strings.Builder
+	for strings.ContainsRune("0123456789abcdefABCDEF", lexer.peekAt(0)) && lexer.peekAt(0) != 0 {
+		hex.WriteRune(lexer.next())
+	}
+	value, err := strconv.ParseUint(hex.String(), 16, 32)
+	if err != nil || value > unicode.MaxRune {
+		return 0, false
+	}
+	return rune(value), true
+}
+
+// lexEBNFClass reads a W3C character class such as `[^#x20a-z]` and writes
+// it as a GBNF class.
+func lexEBNFClass(lexer *sourceLexer) sourceToken {
+	line, column := lexer.line, lexer.column
+	lexer.next()
+	negated := lexer.peekAt(0) == '^'
+	if negated {
+		lexer.next()
+	}
+
+	readChar := func() (rune, bool) {
+		if lexer.hasPrefix("#x") {
+			return lexHexChar(lexer)
+		}
+		char := lexer.peekAt(0)
+		if char == 0 || char == '\n' {
+			return 0, false
+		}
+		return lexer.next(), true
+	}
+
+	ranges := []GBNFParser.CharRange{}
+	for lexer.peekAt(0) != ']' {
+		low, ok := readChar()
+		if !ok {
+			return lexer.token(sourceInvalid, "invalid character class", line, column)
+		}
+		high := low
+		if lexer.peekAt(0) == '-' && lexer.peekAt(1) != ']' {
+			lexer.next()
+			if high, ok = readChar(); !ok || high < low {
+				return lexer.token(sourceInvalid, "invalid character class", line, column)
+			}
+		}
+		ranges = append(ranges, GBNFParser.CharRange{Low: low, High: high})
+	}
+	lexer.next()
+	return lexer.token(sourceClass, GBNFParser.FormatCharClass(ranges, negated), line, column)
+}
@@ -0,0 +1,350 @@
+package Formats
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"strings"
+)
+
+// Names of the formats grammars can be exported to.
+const (
+	Lark   = "lark"
+	ANTLR4 = "antlr4"
+	EBNF   = "ebnf"
+)
+
+// Names lists the supported formats.
+var Names = []string{Lark, ANTLR4, EBNF}
+
+// maxExpandedCopies is the number of copies above which expanding a bounded
+// repeat is reported, as the result is hard to read.
+const maxExpandedCopies = 100
+
+// dialect writes the parts of a grammar in one format.
+type dialect interface {
+	// ruleName turns a rule name into a name valid in the format.
+	ruleName(name string) string
+	// reserved lists names that rules cannot use.
+	reserved() []string
+	literal(text string) string
+	charClass(ranges []GBNFParser.CharRange, negated bool) string
+	// repeat repeats atom between min and max times, -1 meaning unbounded,
+	// and reports false if the format has no syntax for it.
+	repeat(atom string, min int, max int) (string, bool)
+	header(grammarName string, start string) string
+	rule(name string, body string, start bool) string
+}
+
+type exporter struct {
+	dialect  dialect
+	names    map[string]string
+	nullable map[string]bool
+	issues   []string
+	current  string
+}
+
+// Export translates a grammar into format, one of Names. grammarName names
+// the grammar in formats that declare one. Constructs that cannot be
+// translated faithfully are returned as issues.
+func Export(ast *GBNFParser.Node, format string, grammarName string) (string, []string, error) {
+	var dialect dialect
+	switch format {
+	case Lark:
+		dialect = larkDialect{}
+	case ANTLR4:
+		dialect = antlrDialect{}
+	case EBNF:
+		dialect = ebnfDialect{}
+	default:
+		return "", nil, fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(Names, ", "))
+	}
+
+	exporter := &exporter{dialect: dialect}
+	declarations := exporter.declarations(ast)
+	exporter.names = ruleNames(declarations, dialect)
+	exporter.nullable = nullableRules(declarations)
+
+	var builder strings.Builder
+	start, hasRoot := exporter.names["root"]
+	if !hasRoot {
+		exporter.issues = append(exporter.issues, "no `root` rule declared, so the grammar has no start rule")
+	}
+	if name := antlrGrammarName(grammarName); format == ANTLR4 && name != grammarName {
+		exporter.issues = append(exporter.issues, fmt.Sprintf("`%s` is not a valid grammar name, so the grammar is named `%s` and ANTLR requires the file to be named %s.g4", grammarName, name, name))
+	}
+	builder.WriteString(dialect.header(grammarName, start))
+	for _, declaration := range declarations {
+		exporter.current = declaration.Token.Value
+		body, _ := exporter.expression(declaration.Children)
+		if body == "" {
+			exporter.report("only matches the empty string, which cannot be written as a rule body")
+		}
+		builder.WriteString(dialect.rule(exporter.names[declaration.Token.Value], body, declaration.Token.Value == "root"))
+	}
+	if hasRoot && format == ANTLR4 && exporter.nullable["root"] {
+		exporter.current = "root"
+		exporter.report("matches the empty string, which ANTLR lexer rules cannot")
+	}
+	return builder.String(), exporter.issues, nil
+}
+
+func (exporter *exporter) report(format string, args ...any) {
+	exporter.issues = append(exporter.issues, fmt.Sprintf("rule `%s`: ", exporter.current)+fmt.Sprintf(format, args...))
+}
+
+// declarations returns the declaration llama.cpp uses for every rule. The
+// declarations it ignores are reported.
+func (exporter *exporter) declarations(ast *GBNFParser.Node) []*GBNFParser.Node {
+	declarations := GBNFParser.EffectiveDeclarations(ast)
+	effective := map[*GBNFParser.Node]bool{}
+	for _, declaration := range declarations {
+		effective[declaration] = true
+	}
+	for _, node := range ast.Children {
+		if node.Type == GBNFParser.NodeDeclaration && !effective[node] {
+			exporter.current = node.Token.Value
+			exporter.report("declared more than once; only the last declaration is exported")
+		}
+	}
+	return declarations
+}
+
+// ruleNames maps every rule to a unique name valid in the dialect.
+func ruleNames(declarations []*GBNFParser.Node, dialect dialect) map[string]string {
+	taken := map[string]bool{}
+	for _, name := range dialect.reserved() {
+		taken[name] = true
+	}
+	names := map[string]string{}
+	for _, declaration := range declarations {
+		base := dialect.ruleName(declaration.Token.Value)
+		name := base
+		for suffix := 2; taken[name]; suffix++ {
+			name = fmt.Sprintf("%s_%d", base, suffix)
+		}
+		taken[name] = true
+		names[declaration.Token.Value] = name
+	}
+	return names
+}
+
+// kind tells where a translated expression can be used without parentheses.
+type kind int
+
+const (
+	// kindAtom can take a repeat operator.
+	kindAtom kind = iota
+	// kindElement is a single element of a sequence, such as `a?`.
+	kindElement
+	kindSequence
+	kindAlternation
+)
+
+// expression translates a sequence, returning "" if it only matches the
+// empty string.
+func (exporter *exporter) expression(nodes []*GBNFParser.Node) (string, kind) {
+	parts, partKind := []string{}, kindAtom
+	for _, node := range nodes {
+		if part, nodeKind := exporter.node(node); part != "" {
+			parts = append(parts, part)
+			partKind = nodeKind
+		}
+	}
+	if len(parts) == 1 {
+		return parts[0], partKind
+	}
+	return strings.Join(parts, " "), kindSequence
+}
+
+func (exporter *exporter) node(node *GBNFParser.Node) (string, kind) {
+	switch node.Type {
+	case GBNFParser.NodeToken:
+		return exporter.token(node.Token), kindAtom
+	case GBNFParser.NodeSubExpression:
+		inner, innerKind := exporter.expression(node.Children)
+		if innerKind == kindAtom || innerKind == kindElement {
+			return inner, innerKind
+		}
+		return "(" + inner + ")", kindAtom
+	case GBNFParser.NodeAlternative:
+		// Empty alternatives make the others optional.
+		branches, branchKind, optional := []string{}, kindAtom, false
+		for _, child := range node.Children {
+			var branch string
+			var childKind kind
+			if child.Type == GBNFParser.NodeSubExpression {
+				branch, childKind = exporter.expression(child.Children)
+			} else {
+				branch, childKind = exporter.node(child)
+			}
+			if branch == "" {
+				optional = true
+				continue
+			}
+			branches, branchKind = append(branches, branch), childKind
+		}
+		switch {
+		case len(branches) == 0:
+			return "", kindAtom
+		case optional && len(branches) == 1 && branchKind == kindAtom:
+			return branches[0] + "?", kindElement
+		case optional:
+			return "(" + strings.Join(branches, " | ") + ")?", kindElement
+		case len(branches) == 1:
+			return branches[0], branchKind
+		default:
+			return strings.Join(branches, " | "), kindAlternation
+		}
+	case GBNFParser.NodeRepeat:
+		atom, atomKind := exporter.node(node.Children[0])
+		if atom == "" {
+			return "", kindAtom
+		}
+		if atomKind != kindAtom {
+			atom = "(" + atom + ")"
+		}
+		return exporter.repeat(atom, node.Min, node.Max)
+	default:
+		return "", kindAtom
+	}
+}
+
+func (exporter *exporter) token(token *GBNFParser.Token) string {
+	switch token.Type {
+	case GBNFParser.TokenString:
+		text, err := GBNFParser.UnescapeString(token.Value)
+		if err != nil {
+			exporter.report("%v", err)
+		}
+		if text == "" {
+			return ""
+		}
+		return exporter.dialect.literal(text)
+	case GBNFParser.TokenRegexp:
+		ranges, negated, err := GBNFParser.ParseCharClass(token.Value)
+		if err != nil {
+			exporter.report("%v", err)
+			return token.Value
+		}
+		if len(ranges) == 0 && !negated {
+			exporter.report("the empty character class %s matches nothing", token.Value)
+		}
+		return exporter.dialect.charClass(ranges, negated)
+	case GBNFParser.TokenIdentifier:
+		if name, ok := exporter.names[token.Value]; ok {
+			return name
+		}
+		exporter.report("rule `%s` is not declared", token.Value)
+		return exporter.dialect.ruleName(token.Value)
+	default:
+		return ""
+	}
+}
+
+// repeat writes a repeat with the operators of the dialect, expanding
+// bounded repeats into copies if the dialect has no syntax for them.
+func (exporter *exporter) repeat(atom string, min int, max int) (string, kind) {
+	switch {
+	case min == 0 && max == -1:
+		return atom + "*", kindElement
+	case min == 1 && max == -1:
+		return atom + "+", kindElement
+	case min == 0 && max == 1:
+		return atom + "?", kindElement
+	case min == 1 && max == 1:
+		return atom, kindAtom
+	case max == 0:
+		return "", kindAtom
+	}
+	if repeated, ok := exporter.dialect.repeat(atom, min, max); ok {
+		return repeated, kindSequence
+	}
+
+	copies := max
+	if max == -1 {
+		copies = min
+	}
+	if copies > maxExpandedCopies {
+		exporter.report("a repeat was expanded into %d copies", copies)
+	}
+	return expandRepeat(atom, min, max), kindSequence
+}
+
+// expandRepeat writes atom{min,max} with `?`, `*` and `+` only, as
+// `a a (a a?)?` for a{2,4}.
+func expandRepeat(atom string, min int, max int) string {
+	parts := []string{}
+	if max == -1 {
+		for index := 1; index < min; index++ {
+			parts = append(parts, atom)
+		}
+		return strings.Join(append(parts, atom+"+"), " ")
+	}
+
+	for index := 0; index < min; index++ {
+		parts = append(parts, atom)
+	}
+	tail := ""
+	for index := min; index < max; index++ {
+		if tail == "" {
+			tail = atom + "?"
+		} else {
+			tail = "(" + atom + " " + tail + ")?"
+		}
+	}
+	if tail != "" {
+		parts = append(parts, tail)
+	}
+	return strings.Join(parts, " ")
+}
+
+// nullableRules returns the rules that match the empty string.
+func nullableRules(declarations []*GBNFParser.Node) map[string]bool {
+	nullable := map[string]bool{}
+	for changed := true; changed; {
+		changed = false
+		for _, declaration := range declarations {
+			name := declaration.Token.Value
+			if !nullable[name] && sequenceNullable(declaration.Children, nullable) {
+				nullable[name] = true
+				changed = true
+			}
+		}
+	}
+	return nullable
+}
+
+func sequenceNullable(nodes []*GBNFParser.Node, nullable map[string]bool) bool {
+	for _, node := range nodes {
+		if !nodeNullable(node, nullable) {
+			return false
+		}
+	}
+	return true
+}
+
+func nodeNullable(node *GBNFParser.Node, nullable map[string]bool) bool {
+	switch node.Type {
+	case GBNFParser.NodeToken:
+		switch node.Token.Type {
+		case GBNFParser.TokenString:
+			return node.Token.Value == ""
+		case GBNFParser.TokenIdentifier:
+			return nullable[node.Token.Value]
+		}
+		return false
+	case GBNFParser.NodeSubExpression:
+		return sequenceNullable(node.Children, nullable)
+	case GBNFParser.NodeAlternative:
+		for _, child := range node.Children {
+			if nodeNullable(child, nullable) {
+				return true
+			}
+		}
+		return false
+	case GBNFParser.NodeRepeat:
+		return node.Min == 0 || nodeNullable(node.Children[0], nullable)
+	default:
+		return true
+	}
+}
@@ -0,0 +1,669 @@
+package Formats
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ImportNames lists the formats grammars can be imported from.
+var ImportNames = []string{Lark, EBNF}
+
+type sourceTokenKind int
+
+const (
+	sourceEOF sourceTokenKind = iota
+	sourceNewline
+	sourceName
+	// sourceLiteral holds the text a string literal matches.
+	sourceLiteral
+	// sourceClass holds a W3C character class already written as GBNF.
+	sourceClass
+	sourceNumber
+	sourceRegexp
+	sourceDirective
+	sourceSpecial
+	sourcePunctuation
+	// sourceInvalid holds the message of a lexing error.
+	sourceInvalid
+)
+
+// sourceToken is a token of a grammar being imported.
+type sourceToken struct {
+	kind   sourceTokenKind
+	value  string
+	line   int
+	column int
+	length int
+	// insensitive marks Lark literals with the `i` flag.
+	insensitive bool
+}
+
+// sourceLexer holds the position shared by the lexers of imported formats.
+type sourceLexer struct {
+	input  []rune
+	pos    int
+	line   int
+	column int
+}
+
+func (lexer *sourceLexer) peekAt(offset int) rune {
+	if lexer.pos+offset < len(lexer.input) {
+		return lexer.input[lexer.pos+offset]
+	}
+	return 0
+}
+
+func (lexer *sourceLexer) next() rune {
+	char := lexer.input[lexer.pos]
+	lexer.pos++
+	if char == '\n' {
+		lexer.line++
+		lexer.column = 0
+	} else {
+		lexer.column++
+	}
+	return char
+}
+
+func (lexer *sourceLexer) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(string(lexer.input[lexer.pos:]), prefix)
+}
+
+// token creates a token of kind spanning from line and column to the
+// current position, which must be on the same line.
+func (lexer *sourceLexer) token(kind sourceTokenKind, value string, line int, column int) sourceToken {
+	length := lexer.column - column
+	if lexer.line != line {
+		length = 1
+	}
+	return sourceToken{kind: kind, value: value, line: line, column: column, length: length}
+}
+
+// lexName reads letters, digits and underscores, and dashes between them if
+// dashes is set.
+func (lexer *sourceLexer) lexName(dashes bool) sourceToken {
+	line, column := lexer.line, lexer.column
+	var builder strings.Builder
+	for {
+		char := lexer.peekAt(0)
+		isWordChar := func(char rune) bool {
+			return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_'
+		}
+		if isWordChar(char) || (dashes && char == '-' && isWordChar(lexer.peekAt(1))) {
+			builder.WriteRune(lexer.next())
+			continue
+		}
+		return lexer.token(sourceName, builder.String(), line, column)
+	}
+}
+
+func (lexer *sourceLexer) lexNumber() sourceToken {
+	line, column := lexer.line, lexer.column
+	var builder strings.Builder
+	for unicode.IsDigit(lexer.peekAt(0)) {
+		builder.WriteRune(lexer.next())
+	}
+	return lexer.token(sourceNumber, builder.String(), line, column)
+}
+
+// importer translates the tokens of a grammar into GBNF rules. Rules that
+// cannot be translated are reported and skipped.
+type importer struct {
+	format string
+	tokens []sourceToken
+	pos    int
+	names  map[string]string
+	rules  []string
+	errors []*GBNFParser.ParseError
+}
+
+// Import translates a Lark or EBNF grammar into GBNF. Both W3C (`::=`) and
+// ISO (`=` ... `;`) EBNF rules are understood. The rule named start, or
+// Lark's `start` rule or the first EBNF rule if start is empty, becomes
+// `root`. Constructs without a GBNF equivalent, such as Lark's regular
+// expression terminals and EBNF exceptions, are returned as errors at their
+// position in text.
+func Import(text string, format string, start string) (*GBNFParser.Node, []*GBNFParser.ParseError, error) {
+	var tokens []sourceToken
+	switch format {
+	case Lark:
+		tokens = lexLark(text)
+	case EBNF:
+		tokens = lexEBNF(text)
+	default:
+		return nil, nil, fmt.Errorf("cannot import format %q, expected one of %s", format, strings.Join(ImportNames, ", "))
+	}
+
+	importer := &importer{format: format, tokens: tokens}
+	definitions := importer.definitions()
+	if start == "" && len(definitions) > 0 {
+		start = definitions[0].value
+		if format == Lark {
+			start = "start"
+		}
+	}
+	importer.names = importedNames(definitions, start)
+	if _, ok := importer.names[start]; !ok {
+		importer.errors = append(importer.errors, &GBNFParser.ParseError{
+			Message: fmt.Sprintf("the grammar has no rule `%s` to start from", start),
+		})
+	}
+
+	for importer.peek().kind != sourceEOF {
+		if err := importer.statement(); err != nil {
+			importer.errors = append(importer.errors, err)
+			importer.skipStatement()
+		}
+	}
+
+	grammar := GBNFParser.ParseGrammarFile("", strings.Join(importer.rules, "\n")+"\n")
+	if len(grammar.Errors) > 0 {
+		return nil, nil, fmt.Errorf("the translated grammar is invalid: %s", grammar.Errors[0].Message)
+	}
+	return grammar.AST, importer.errors, nil
+}
+
+// definitions returns the name tokens of all rules in definition order.
+func (importer *importer) definitions() []sourceToken {
+	definitions := []sourceToken{}
+	for index, token := range importer.tokens {
+		if token.kind == sourceName && importer.isDefinition(index) {
+			definitions = append(definitions, token)
+		}
+	}
+	return definitions
+}
+
+// isDefinition tells whether the name at index starts a rule.
+func (importer *importer) isDefinition(index int) bool {
+	next := index + 1
+	if importer.format == Lark {
+		if index > 0 && importer.tokens[index-1].kind != sourceNewline &&
+			!isPunctuation(importer.tokens[index-1], "?") && !isPunctuation(importer.tokens[index-1], "!") {
+			return false
+		}
+		// Skip a priority such as `.2`.
+		if next+1 < len(importer.tokens) && isPunctuation(importer.tokens[next], ".") && importer.tokens[next+1].kind == sourceNumber {
+			next += 2
+		}
+		return next < len(importer.tokens) && (isPunctuation(importer.tokens[next], ":") || isPunctuation(importer.tokens[next], "{"))
+	}
+	return next < len(importer.tokens) && (isPunctuation(importer.tokens[next], "::=") || isPunctuation(importer.tokens[next], "="))
+}
+
+// importedNames maps rule names to valid GBNF names, with start becoming
+// root and clashes resolved with a numeric suffix.
+func importedNames(definitions []sourceToken, start string) map[string]string {
+	names := map[string]string{}
+	used := map[string]bool{}
+	add := func(name string, candidate string) {
+		if _, ok := names[name]; ok {
+			return
+		}
+		unique := candidate
+		for suffix := 2; used[unique]; suffix++ {
+			unique = candidate + "-" + strconv.Itoa(suffix)
+		}
+		names[name] = unique
+		used[unique] = true
+	}
+	for _, definition := range definitions {
+		if definition.value == start {
+			add(start, "root")
+		}
+	}
+	for _, definition := range definitions {
+		add(definition.value, gbnfName(definition.value))
+	}
+	return names
+}
+
+// gbnfName turns a name with underscores into a GBNF identifier, which
+// consists of letters, digits and dashes.
+func gbnfName(name string) string {
+	parts := strings.FieldsFunc(name, func(char rune) bool { return char == '_' || char == '-' })
+	name = strings.Join(parts, "-")
+	if name == "" {
+		return "rule"
+	}
+	if !unicode.IsLetter([]rune(name)[0]) {
+		return "r-" + name
+	}
+	return name
+}
+
+func isPunctuation(token sourceToken, value string) bool {
+	return token.kind == sourcePunctuation && token.value == value
+}
+
+func (importer *importer) peek() sourceToken {
+	return importer.peekAt(0)
+}
+
+func (importer *importer) peekAt(offset int) sourceToken {
+	if importer.pos+offset < len(importer.tokens) {
+		return importer.tokens[importer.pos+offset]
+	}
+	return importer.tokens[len(importer.tokens)-1]
+}
+
+func (importer *importer) next() sourceToken {
+	token := importer.peek()
+	if importer.pos < len(importer.tokens)-1 {
+		importer.pos++
+	}
+	return token
+}
+
+func (importer *importer) accept(value string) bool {
+	if isPunctuation(importer.peek(), value) {
+		importer.next()
+		return true
+	}
+	return false
+}
+
+func (importer *importer) expect(value string) *GBNFParser.ParseError {
+	if !importer.accept(value) {
+		return importer.unexpected(importer.peek(), "`"+value+"`")
+	}
+	return nil
+}
+
+func newImportError(token sourceToken, format string, args ...any) *GBNFParser.ParseError {
+	return &GBNFParser.ParseError{
+		Message: fmt.Sprintf(format, args...),
+		Line:    token.line,
+		Column:  token.column,
+		Length:  token.length,
+	}
+}
+
+func (importer *importer) unexpected(token sourceToken, expected string) *GBNFParser.ParseError {
+	switch token.kind {
+	case sourceInvalid:
+		return newImportError(token, "%s", token.value)
+	case sourceEOF:
+		return newImportError(token, "expected %s, found the end of the file", expected)
+	case sourceNewline:
+		return newImportError(token, "expected %s, found the end of the line", expected)
+	default:
+		return newImportError(token, "expected %s, found `%s`", expected, token.value)
+	}
+}
+
+// skipStatement moves past the rest of a rule that could not be translated.
+func (importer *importer) skipStatement() {
+	for {
+		token := importer.peek()
+		switch {
+		case token.kind == sourceEOF:
+			return
+		case importer.format == Lark && token.kind == sourceNewline && !isPunctuation(importer.peekAt(1), "|"):
+			importer.next()
+			return
+		case importer.format == EBNF && (isPunctuation(token, ";") || isPunctuation(token, ".")):
+			importer.next()
+			return
+		case importer.format == EBNF && token.kind == sourceName && importer.isDefinition(importer.pos):
+			return
+		}
+		importer.next()
+	}
+}
+
+// statement translates one rule, or reports a Lark directive.
+func (importer *importer) statement() *GBNFParser.ParseError {
+	if importer.format == Lark {
+		for importer.peek().kind == sourceNewline {
+			importer.next()
+		}
+		if importer.peek().kind == sourceEOF {
+			return nil
+		}
+		if token := importer.peek(); token.kind == sourceDirective {
+			return larkDirectiveError(token)
+		}
+		// `?` and `!` only change the shape of Lark's parse tree.
+		if !importer.accept("?") {
+			importer.accept("!")
+		}
+	}
+
+	name := importer.next()
+	if name.kind != sourceName {
+		return importer.unexpected(name, "a rule name")
+	}
+	if importer.format == Lark {
+		if importer.accept(".") {
+			// Priorities only choose between parses of the same text.
+			if token := importer.next(); token.kind != sourceNumber {
+				return importer.unexpected(token, "a priority")
+			}
+		}
+		if token := importer.peek(); isPunctuation(token, "{") {
+			return newImportError(token, "templates are not supported")
+		}
+		if err := importer.expect(":"); err != nil {
+			return err
+		}
+	} else if !importer.accept("::=") {
+		if err := importer.expect("="); err != nil {
+			return err
+		}
+	}
+
+	body, _, err := importer.alternatives()
+	if err != nil {
+		return err
+	}
+
+	end := importer.peek()
+	switch {
+	case end.kind == sourceEOF:
+	case importer.format == Lark && end.kind == sourceNewline:
+		importer.next()
+	case importer.format == EBNF && (isPunctuation(end, ";") || isPunctuation(end, ".")):
+		importer.next()
+	case importer.format == EBNF && end.kind == sourceName && importer.isDefinition(importer.pos):
+	default:
+		return importer.unexpected(end, "the end of the rule")
+	}
+
+	importer.rules = append(importer.rules, importer.names[name.value]+" ::= "+body)
+	return nil
+}
+
+func larkDirectiveError(token sourceToken) *GBNFParser.ParseError {
+	switch token.value {
+	case "%import":
+		return newImportError(token, "%%import is not supported; copy the imported rules into the grammar")
+	case "%ignore":
+		return newImportError(token, "%%ignore is not supported, as GBNF has no implicit whitespace; add it to the rules instead")
+	default:
+		return newImportError(token, "%s is not supported", token.value)
+	}
+}
+
+// isExpressionEnd tells whether token ends a sequence.
+func (importer *importer) isExpressionEnd(token sourceToken) bool {
+	switch token.kind {
+	case sourceEOF, sourceNewline:
+		return true
+	case sourcePunctuation:
+		return strings.Contains(" | ) ] } ; . -> ", " "+token.value+" ")
+	case sourceName:
+		return importer.format == EBNF && importer.isDefinition(importer.pos)
+	}
+	return false
+}
+
+// alternatives translates branches separated by `|`. The second result tells
+// whether a repeat operator can follow the translation directly.
+func (importer *importer) alternatives() (string, bool, *GBNFParser.ParseError) {
+	branches := []string{}
+	atomic := true
+	for {
+		branch, branchAtomic, err := importer.sequence()
+		if err != nil {
+			return "", false, err
+		}
+		if importer.format == Lark && importer.accept("->") {
+			// Aliases only rename nodes of Lark's parse tree.
+			if token := importer.next(); token.kind != sourceName {
+				return "", false, importer.unexpected(token, "an alias name")
+			}
+		}
+		branches = append(branches, branch)
+		atomic = branchAtomic
+
+		// Lark continues rules on lines starting with `|`.
+		offset := 0
+		for importer.format == Lark && importer.peekAt(offset).kind == sourceNewline {
+			offset++
+		}
+		if !isPunctuation(importer.peekAt(offset), "|") {
+			break
+		}
+		importer.pos += offset + 1
+	}
+	if len(branches) > 1 {
+		return strings.Join(branches, " | "), false, nil
+	}
+	return branches[0], atomic, nil
+}
+
+// sequence translates terms up to the end of a branch. ISO EBNF separates
+// them with commas.
+func (importer *importer) sequence() (string, bool, *GBNFParser.ParseError) {
+	terms := []string{}
+	atomic := true
+	for !importer.isExpressionEnd(importer.peek()) {
+		term, termAtomic, err := importer.term()
+		if err != nil {
+			return "", false, err
+		}
+		terms = append(terms, term)
+		atomic = termAtomic
+		if importer.format == EBNF {
+			importer.accept(",")
+		}
+	}
+	switch len(terms) {
+	case 0:
+		return `""`, true, nil
+	case 1:
+		return terms[0], atomic, nil
+	default:
+		return strings.Join(terms, " "), false, nil
+	}
+}
+
+// term translates a factor with its repeat operators.
+func (importer *importer) term() (string, bool, *GBNFParser.ParseError) {
+	// ISO EBNF writes repeats as `3 * factor`.
+	if count := importer.peek(); count.kind == sourceNumber && importer.format == EBNF {
+		importer.next()
+		if err := importer.expect("*"); err != nil {
+			return "", false, err
+		}
+		factor, atomic, err := importer.factor()
+		if err != nil {
+			return "", false, err
+		}
+		return parenthesize(factor, atomic) + "{" + count.value + "}", true, nil
+	}
+
+	text, atomic, err := importer.factor()
+	if err != nil {
+		return "", false, err
+	}
+	for {
+		token := importer.peek()
+		switch {
+		case isPunctuation(token, "?") || isPunctuation(token, "*") || isPunctuation(token, "+"):
+			importer.next()
+			text, atomic = parenthesize(text, atomic)+token.value, false
+		case importer.format == Lark && isPunctuation(token, "~"):
+			importer.next()
+			repeat, err := importer.larkRepeat()
+			if err != nil {
+				return "", false, err
+			}
+			text, atomic = parenthesize(text, atomic)+repeat, false
+		case importer.format == EBNF && isPunctuation(token, "-"):
+			return "", false, newImportError(token, "exceptions (`A - B`) are not supported, as GBNF has no way to exclude matches")
+		default:
+			return text, atomic, nil
+		}
+	}
+}
+
+// larkRepeat translates the `n` or `n..m` following `~`.
+func (importer *importer) larkRepeat() (string, *GBNFParser.ParseError) {
+	min := importer.next()
+	if min.kind != sourceNumber {
+		return "", importer.unexpected(min, "a repeat count")
+	}
+	if !importer.accept("..") {
+		return "{" + min.value + "}", nil
+	}
+	max := importer.next()
+	if max.kind != sourceNumber {
+		return "", importer.unexpected(max, "a repeat count")
+	}
+	return "{" + min.value + "," + max.value + "}", nil
+}
+
+func parenthesize(text string, atomic bool) string {
+	if atomic {
+		return text
+	}
+	return "(" + text + ")"
+}
+
+func (importer *importer) factor() (string, bool, *GBNFParser.ParseError) {
+	token := importer.next()
+	switch token.kind {
+	case sourceName:
+		if importer.format == Lark && isPunctuation(importer.peek(), "{") {
+			return "", false, newImportError(importer.peek(), "templates are not supported")
+		}
+		name, ok := importer.names[token.value]
+		if !ok {
+			return "", false, newImportError(token, "rule `%s` is not declared", token.value)
+		}
+		return name, true, nil
+	case sourceLiteral:
+		if importer.format == Lark && importer.accept("..") {
+			return importer.larkRange(token)
+		}
+		return literal(token), !token.insensitive || len([]rune(token.value)) <= 1, nil
+	case sourceClass:
+		return token.value, true, nil
+	case sourceRegexp:
+		if err := lookaroundError(token); err != nil {
+			return "", false, err
+		}
+		return "", false, newImportError(token, "regular expression terminals are not supported; write the terminal as rules instead")
+	case sourceSpecial:
+		return "", false, newImportError(token, "special sequences are not supported")
+	case sourcePunctuation:
+		closing := map[string]string{"(": ")", "[": "]", "{": "}"}[token.value]
+		if closing == "" || (importer.format == Lark && token.value == "{") {
+			break
+		}
+		inner, atomic, err := importer.alternatives()
+		if err != nil {
+			return "", false, err
+		}
+		if err := importer.expect(closing); err != nil {
+			return "", false, err
+		}
+		switch token.value {
+		case "[":
+			return parenthesize(inner, atomic) + "?", false, nil
+		case "{":
+			return parenthesize(inner, atomic) + "*", false, nil
+		default:
+			return parenthesize(inner, atomic), true, nil
+		}
+	}
+	return "", false, importer.unexpected(token, "an expression")
+}
+
+// lookarounds are the groups of regular expressions that look ahead or
+// behind, by the prefix they start with.
+var lookarounds = []struct {
+	prefix string
+	name   string
+}{
+	{"(?=", "lookahead"},
+	{"(?!", "negative lookahead"},
+	{"(?<=", "lookbehind"},
+	{"(?<!", "negative lookbehind"},
+}
+
+// lookaroundError reports the first lookaround group of a regular expression
+// token at its own position, or returns nil if there is none.
+func lookaroundError(token sourceToken) *GBNFParser.ParseError {
+	text := []rune(token.value)
+	inClass := false
+	for start := 0; start < len(text); start++ {
+		switch {
+		case text[start] == '\\':
+			start++
+			continue
+		case inClass || text[start] == '[':
+			inClass = text[start] != ']' || !inClass
+			continue
+		}
+		for _, lookaround := range lookarounds {
+			if !strings.HasPrefix(string(text[start:]), lookaround.prefix) {
+				continue
+			}
+			end, depth := start, 0
+			for ; end < len(text); end++ {
+				if text[end] == '\\' {
+					end++
+				} else if text[end] == '(' {
+					depth++
+				} else if text[end] == ')' {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+			end = min(end+1, len(text))
+			group := string(text[start:end])
+			err := newImportError(token, "%s `%s` is not supported, as GBNF cannot look ahead or behind", lookaround.name, group)
+			err.Column, err.Length = token.column+start, end-start
+			return err
+		}
+	}
+	return nil
+}
+
+// larkRange translates `"a".."z"`.
+func (importer *importer) larkRange(low sourceToken) (string, bool, *GBNFParser.ParseError) {
+	high := importer.next()
+	if high.kind != sourceLiteral {
+		return "", false, importer.unexpected(high, "a string")
+	}
+	lowRunes, highRunes := []rune(low.value), []rune(high.value)
+	if len(lowRunes) != 1 || len(highRunes) != 1 || highRunes[0] < lowRunes[0] {
+		return "", false, newImportError(low, "ranges must go from one character to a later one")
+	}
+	ranges := []GBNFParser.CharRange{{Low: lowRunes[0], High: highRunes[0]}}
+	return GBNFParser.FormatCharClass(ranges, false), true, nil
+}
+
+// literal translates a string token, matching letters of case-insensitive
+// Lark literals with character classes.
+func literal(token sourceToken) string {
+	if !token.insensitive {
+		return GBNFParser.QuoteLiteral(token.value)
+	}
+	parts := []string{}
+	plain := ""
+	for _, char := range token.value {
+		lower, upper := unicode.ToLower(char), unicode.ToUpper(char)
+		if lower == upper {
+			plain += string(char)
+			continue
+		}
+		if plain != "" {
+			parts = append(parts, GBNFParser.QuoteLiteral(plain))
+			plain = ""
+		}
+		ranges := []GBNFParser.CharRange{{Low: upper, High: upper}, {Low: lower, High: lower}}
+		parts = append(parts, GBNFParser.FormatCharClass(ranges, false))
+	}
+	if plain != "" || len(parts) == 0 {
+		parts = append(parts, GBNFParser.QuoteLiteral(plain))
+	}
+	return strings.Join(parts, " ")
+}
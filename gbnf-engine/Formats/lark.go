@@ -0,0 +1,60 @@
+package Formats
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"strings"
+	"unicode"
+)
+
+// larkDialect writes grammars for Lark's Earley parser. Every rule becomes a
+// Lark rule, with character classes as regular expression terminals.
+type larkDialect struct{}
+
+func (larkDialect) ruleName(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(name, "-", "_"))
+	if !unicode.IsLetter([]rune(name)[0]) {
+		// Names starting with an underscore are inlined by Lark.
+		name = "r_" + name
+	}
+	return name
+}
+
+func (larkDialect) reserved() []string {
+	return []string{"start"}
+}
+
+func (larkDialect) literal(text string) string {
+	return GBNFParser.QuoteLiteral(text)
+}
+
+func (larkDialect) charClass(ranges []GBNFParser.CharRange, negated bool) string {
+	// Lark regular expressions use Python's syntax, which understands the
+	// escapes of GBNF classes.
+	return "/" + strings.ReplaceAll(GBNFParser.FormatCharClass(ranges, negated), "/", `\/`) + "/"
+}
+
+func (larkDialect) repeat(atom string, min int, max int) (string, bool) {
+	switch {
+	case max == -1:
+		return fmt.Sprintf("%s ~ %d %s*", atom, min, atom), true
+	case min == max:
+		return fmt.Sprintf("%s ~ %d", atom, min), true
+	case min == 0:
+		return fmt.Sprintf("(%s ~ 1..%d)?", atom, max), true
+	default:
+		return fmt.Sprintf("%s ~ %d..%d", atom, min, max), true
+	}
+}
+
+func (larkDialect) header(grammarName string, start string) string {
+	header := "// Generated by gbnf-engine export. Parse with lark.Lark(grammar, parser=\"earley\").\n\n"
+	if start != "" {
+		header += "start: " + start + "\n\n"
+	}
+	return header
+}
+
+func (larkDialect) rule(name string, body string, start bool) string {
+	return name + ": " + body + "\n"
+}
@@ -0,0 +1,170 @@
+package Formats
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// lexLark splits a Lark grammar into tokens. Newlines are kept outside of
+// parentheses and brackets, as they end rules.
+func lexLark(text string) []sourceToken {
+	lexer := &sourceLexer{input: []rune(text)}
+	tokens := []sourceToken{}
+	depth := 0
+	for {
+		char := lexer.peekAt(0)
+		line, column := lexer.line, lexer.column
+		switch {
+		case char == 0:
+			return append(tokens, lexer.token(sourceEOF, "", line, column))
+		case char == '\n':
+			lexer.next()
+			if depth == 0 && len(tokens) > 0 && tokens[len(tokens)-1].kind != sourceNewline {
+				tokens = append(tokens, sourceToken{kind: sourceNewline, line: line, column: column, length: 1})
+			}
+		case unicode.IsSpace(char):
+			lexer.next()
+		case lexer.hasPrefix("//"):
+			for lexer.peekAt(0) != '\n' && lexer.peekAt(0) != 0 {
+				lexer.next()
+			}
+		case char == '"':
+			tokens = append(tokens, lexLarkString(lexer))
+		case char == '/':
+			tokens = append(tokens, lexLarkRegexp(lexer))
+		case char == '%':
+			lexer.next()
+			name := lexer.lexName(false)
+			tokens = append(tokens, lexer.token(sourceDirective, "%"+name.value, line, column))
+		case unicode.IsLetter(char) || char == '_':
+			tokens = append(tokens, lexer.lexName(false))
+		case unicode.IsDigit(char):
+			tokens = append(tokens, lexer.lexNumber())
+		default:
+			value := string(char)
+			for _, punctuation := range []string{"..", "->"} {
+				if lexer.hasPrefix(punctuation) {
+					value = punctuation
+				}
+			}
+			for range value {
+				lexer.next()
+			}
+			switch value {
+			case "(", "[":
+				depth++
+			case ")", "]":
+				depth = max(depth-1, 0)
+			}
+			kind := sourcePunctuation
+			if !strings.Contains("|:?!*+~()[]{}.,", value) && value != ".." && value != "->" {
+				kind = sourceInvalid
+				value = "unexpected character `" + value + "`"
+			}
+			tokens = append(tokens, lexer.token(kind, value, line, column))
+		}
+	}
+}
+
+// lexLarkString reads a string literal with Python's escapes and an optional
+// `i` flag.
+func lexLarkString(lexer *sourceLexer) sourceToken {
+	line, column := lexer.line, lexer.column
+	lexer.next()
+	var builder strings.Builder
+	for {
+		char := lexer.peekAt(0)
+		switch {
+		case char == 0 || char == '\n':
+			return lexer.token(sourceInvalid, "unterminated string", line, column)
+		case char == '"':
+			lexer.next()
+			token := lexer.token(sourceLiteral, builder.String(), line, column)
+			if lexer.peekAt(0) == 'i' {
+				lexer.next()
+				token = lexer.token(sourceLiteral, builder.String(), line, column)
+				token.insensitive = true
+			}
+			return token
+		case char == '\\':
+			lexer.next()
+			escaped, ok := lexPythonEscape(lexer)
+			if !ok {
+				return lexer.token(sourceInvalid, "invalid escape sequence", line, column)
+			}
+			builder.WriteString(escaped)
+		default:
+			builder.WriteRune(lexer.next())
+		}
+	}
+}
+
+// lexPythonEscape reads the escape after a backslash. Unknown escapes keep
+// their backslash, as in Python.
+func lexPythonEscape(lexer *sourceLexer) (string, bool) {
+	char := lexer.peekAt(0)
+	if char == 0 {
+		return "", false
+	}
+	lexer.next()
+	digits := 0
+	switch char {
+	case 'n':
+		return "\n", true
+	case 'r':
+		return "\r", true
+	case 't':
+		return "\t", true
+	case '\\', '"', '\'':
+		return string(char), true
+	case 'x':
+		digits = 2
+	case 'u':
+		digits = 4
+	case 'U':
+		digits = 8
+	default:
+		return `\` + string(char), true
+	}
+	var hex strings.Builder
+	for range digits {
+		if lexer.peekAt(0) == 0 {
+			return "", false
+		}
+		hex.WriteRune(lexer.next())
+	}
+	value, err := strconv.ParseUint(hex.String(), 16, 32)
+	if err != nil || value > unicode.MaxRune {
+		return "", false
+	}
+	return string(rune(value)), true
+}
+
+// lexLarkRegexp reads a regular expression with its flags. The expression
+// is kept as written, since it is only reported.
+func lexLarkRegexp(lexer *sourceLexer) sourceToken {
+	line, column := lexer.line, lexer.column
+	var builder strings.Builder
+	builder.WriteRune(lexer.next())
+	for {
+		char := lexer.peekAt(0)
+		switch {
+		case char == 0 || char == '\n':
+			return lexer.token(sourceInvalid, "unterminated regular expression", line, column)
+		case char == '\\':
+			builder.WriteRune(lexer.next())
+			if lexer.peekAt(0) != 0 && lexer.peekAt(0) != '\n' {
+				builder.WriteRune(lexer.next())
+			}
+		case char == '/':
+			builder.WriteRune(lexer.next())
+			for unicode.IsLetter(lexer.peekAt(0)) {
+				builder.WriteRune(lexer.next())
+			}
+			return lexer.token(sourceRegexp, builder.String(), line, column)
+		default:
+			builder.WriteRune(lexer.next())
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package GBNFParser
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// BundledRule records where a rule of a bundle was declared.
+type BundledRule struct {
+	// Name is the name of the rule in the bundle.
+	Name string
+	// OriginalName is the name of the rule in its source file.
+	OriginalName string
+	Path         string
+	Line         int
+}
+
+// Bundle is a self-contained grammar built from a grammar and its imports.
+type Bundle struct {
+	AST   *Node
+	Rules []BundledRule
+}
+
+// ruleKey identifies a rule by the file declaring it, as imported files may
+// declare rules with the same name.
+type ruleKey struct {
+	path string
+	name string
+}
+
+// BundleGrammar combines root and the files it imports into one grammar. Only
+// rules reachable from the `root` rule of root are kept. References are
+// resolved in the referencing file first, then in the files it imports, so
+// rules with the same name in different files do not interfere; such rules
+// are renamed with the name of their file as prefix.
+func BundleGrammar(root *GrammarFile, imported []*GrammarFile) (*Bundle, []string) {
+	files, declarations := indexDeclarations(root, imported)
+
+	errors := []string{}
+	start := ruleKey{filepath.Clean(root.Path), "root"}
+	if _, ok := declarations[start]; !ok {
+		return nil, []string{"no `root` rule declared in " + root.Path}
+	}
+
+	// Walk the rules reachable from root, remembering what each identifier
+	// refers to.
+	order := []ruleKey{}
+	references := map[*Token]ruleKey{}
+	visited := map[ruleKey]bool{}
+	var visit func(key ruleKey)
+	visit = func(key ruleKey) {
+		if visited[key] {
+			return
+		}
+		visited[key] = true
+		order = append(order, key)
+
+		for _, declaration := range declarations[key] {
+			for _, token := range referencedIdentifiers(declaration.Children) {
+				target, ok := resolveReference(files, declarations, key.path, token.Value)
+				if !ok {
+					errors = append(errors, fmt.Sprintf("%s:%d:%d: rule `%s` is not declared", key.path, token.Line+1, token.Column+1, token.Value))
+					continue
+				}
+				references[token] = target
+				visit(target)
+			}
+		}
+	}
+	visit(start)
+
+	names := bundledNames(order, start)
+	bundle := &Bundle{AST: &Node{Type: NodeRoot}}
+	for _, key := range order {
+		for _, declaration := range declarations[key] {
+			renamed := renameIdentifiers(declaration, func(token *Token) string {
+				if token == declaration.Token {
+					return names[key]
+				}
+				return names[references[token]]
+			})
+			bundle.AST.Children = append(bundle.AST.Children, renamed)
+			bundle.Rules = append(bundle.Rules, BundledRule{
+				Name:         names[key],
+				OriginalName: key.name,
+				Path:         files[key.path].Path,
+				Line:         declaration.Token.Line,
+			})
+		}
+	}
+	return bundle, errors
+}
+
+// Format prints the bundle with a header mapping every rule to its source.
+// Paths in the header are relative to baseDir.
+func (bundle *Bundle) Format(baseDir string) string {
+	relativePath := func(path string) string {
+		if relative, err := filepath.Rel(baseDir, path); err == nil {
+			return filepath.ToSlash(relative)
+		}
+		return path
+	}
+
+	var builder strings.Builder
+	builder.WriteString("# Generated by gbnf-engine bundle from " + relativePath(bundle.Rules[0].Path) + ". Do not edit.\n")
+	builder.WriteString("# Source map:\n")
+	for _, rule := range bundle.Rules {
+		source := fmt.Sprintf("%s:%d", relativePath(rule.Path), rule.Line+1)
+		if rule.Name != rule.OriginalName {
+			source += " (" + rule.OriginalName + ")"
+		}
+		builder.WriteString("#   " + rule.Name + " <- " + source + "\n")
+	}
+	builder.WriteString("\n")
+	builder.WriteString(Format(bundle.AST))
+	return builder.String()
+}
+
+// indexDeclarations maps the files by path and their declarations by rule.
+func indexDeclarations(root *GrammarFile, imported []*GrammarFile) (map[string]*GrammarFile, map[ruleKey][]*Node) {
+	files := map[string]*GrammarFile{}
+	for _, file := range append([]*GrammarFile{root}, imported...) {
+		files[filepath.Clean(file.Path)] = file
+	}
+	declarations := map[ruleKey][]*Node{}
+	for path, file := range files {
+		for _, node := range file.AST.Children {
+			if node.Type == NodeDeclaration {
+				key := ruleKey{path, node.Token.Value}
+				declarations[key] = append(declarations[key], node)
+			}
+		}
+	}
+	return files, declarations
+}
+
+// ResolveRule returns the path of the file declaring the rule name refers to
+// from the file at path, one of root and the files it imports. References
+// resolve as in BundleGrammar.
+func ResolveRule(root *GrammarFile, imported []*GrammarFile, path string, name string) (string, bool) {
+	files, declarations := indexDeclarations(root, imported)
+	key, ok := resolveReference(files, declarations, filepath.Clean(path), name)
+	return key.path, ok
+}
+
+// resolveReference finds the rule name refers to from the file at path: a
+// rule in that file, or else the first one found in its imports, nearest
+// first.
+func resolveReference(files map[string]*GrammarFile, declarations map[ruleKey][]*Node, path string, name string) (ruleKey, bool) {
+	queue := []string{path}
+	seen := map[string]bool{path: true}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if _, ok := declarations[ruleKey{current, name}]; ok {
+			return ruleKey{current, name}, true
+		}
+		file, ok := files[current]
+		if !ok {
+			continue
+		}
+		for _, node := range GetImports(file.AST) {
+			importedPath := ResolveImportPath(file.Path, node.Token.Value)
+			if !seen[importedPath] {
+				seen[importedPath] = true
+				queue = append(queue, importedPath)
+			}
+		}
+	}
+	return ruleKey{}, false
+}
+
+// bundledNames picks a unique name for every rule. Rules keep their name
+// unless another rule has the same name, in which case all but the rule from
+// the root file are prefixed with the name of their file.
+func bundledNames(order []ruleKey, start ruleKey) map[ruleKey]string {
+	count := map[string]int{}
+	for _, key := range order {
+		count[key.name]++
+	}
+
+	names := map[ruleKey]string{}
+	taken := map[string]bool{}
+	for _, key := range order {
+		if count[key.name] == 1 || key.path == start.path {
+			names[key] = key.name
+			taken[key.name] = true
+		}
+	}
+	for _, key := range order {
+		if _, ok := names[key]; ok {
+			continue
+		}
+		base := identifierPrefix(key.path) + "-" + key.name
+		name := base
+		for suffix := 2; taken[name]; suffix++ {
+			name = fmt.Sprintf("%s-%d", base, suffix)
+		}
+		names[key] = name
+		taken[name] = true
+	}
+	return names
+}
+
+// identifierPrefix turns the name of the file at path into a valid rule name.
+func identifierPrefix(path string) string {
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var builder strings.Builder
+	for _, char := range stem {
+		switch {
+		case unicode.IsLetter(char) || unicode.IsDigit(char):
+			builder.WriteRune(char)
+		default:
+			builder.WriteRune('-')
+		}
+	}
+	prefix := strings.Trim(builder.String(), "-")
+	if prefix == "" || !unicode.IsLetter([]rune(prefix)[0]) {
+		prefix = "file-" + prefix
+	}
+	return prefix
+}
+
+// referencedIdentifiers returns the identifier tokens used in an expression.
+func referencedIdentifiers(nodes []*Node) []*Token {
+	tokens := []*Token{}
+	for _, node := range nodes {
+		if node.Type == NodeToken && node.Token.Type == TokenIdentifier {
+			tokens = append(tokens, node.Token)
+		}
+		tokens = append(tokens, referencedIdentifiers(node.Children)...)
+	}
+	return tokens
+}
+
+// renameIdentifiers returns a copy of node in which every identifier token,
+// including the name of a declaration, is named by rename.
+func renameIdentifiers(node *Node, rename func(token *Token) string) *Node {
+	copied := *node
+	if node.Token != nil && node.Token.Type == TokenIdentifier && (node.Type == NodeToken || node.Type == NodeDeclaration) {
+		token := *node.Token
+		token.Value = rename(node.Token)
+		copied.Token = &token
+	}
+	copied.Children = make([]*Node, len(node.Children))
+	for index, child := range node.Children {
+		copied.Children[index] = renameIdentifiers(child, rename)
+	}
+	return &copied
+}
@@ -0,0 +1,235 @@
+package GBNFParser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// MaxRune is the largest character a grammar can match.
+const MaxRune = unicode.MaxRune
+
+// CharRange is an inclusive range of characters.
+type CharRange struct {
+	Low  rune
+	High rune
+}
+
+// QuoteLiteral returns a GBNF string literal matching text exactly.
+func QuoteLiteral(text string) string {
+	var builder strings.Builder
+	builder.WriteRune('"')
+	for _, char := range text {
+		builder.WriteString(escapeRune(char, `"`))
+	}
+	builder.WriteRune('"')
+	return builder.String()
+}
+
+// StringValue returns the string token value of a literal matching text
+// exactly, that is QuoteLiteral(text) without the quotes.
+func StringValue(text string) string {
+	quoted := QuoteLiteral(text)
+	return quoted[1 : len(quoted)-1]
+}
+
+// FormatCharClass returns a GBNF character class matching ranges, or every
+// character outside them if negated.
+func FormatCharClass(ranges []CharRange, negated bool) string {
+	var builder strings.Builder
+	builder.WriteRune('[')
+	if negated {
+		builder.WriteRune('^')
+	}
+	for _, charRange := range ranges {
+		builder.WriteString(escapeRune(charRange.Low, "[]^-"))
+		if charRange.High != charRange.Low {
+			if charRange.High > charRange.Low+1 {
+				builder.WriteRune('-')
+			}
+			builder.WriteString(escapeRune(charRange.High, "[]^-"))
+		}
+	}
+	builder.WriteRune(']')
+	return builder.String()
+}
+
+// escapeRune escapes char for use in a GBNF string or character class.
+// Characters in special are escaped as well; llama.cpp only accepts a few
+// named escapes, so all but quotes and brackets are written in hex.
+func escapeRune(char rune, special string) string {
+	switch char {
+	case '\\':
+		return `\\`
+	case '\n':
+		return `\n`
+	case '\r':
+		return `\r`
+	case '\t':
+		return `\t`
+	}
+	if strings.ContainsRune(special, char) {
+		if strings.ContainsRune(`"[]`, char) {
+			return `\` + string(char)
+		}
+		return fmt.Sprintf(`\x%02X`, char)
+	}
+	switch {
+	case unicode.IsPrint(char) || char == ' ':
+		return string(char)
+	case char < 0x100:
+		return fmt.Sprintf(`\x%02X`, char)
+	case char < 0x10000:
+		return fmt.Sprintf(`\u%04X`, char)
+	default:
+		return fmt.Sprintf(`\U%08X`, char)
+	}
+}
+
+// ParseCharClass returns the ranges of a character class token value such as
+// `[^a-z\n]` and whether the class is negated.
+func ParseCharClass(value string) ([]CharRange, bool, error) {
+	runes := []rune(value)
+	if len(runes) < 2 || runes[0] != '[' || runes[len(runes)-1] != ']' {
+		return nil, false, fmt.Errorf("invalid character class %s", value)
+	}
+	runes = runes[1 : len(runes)-1]
+
+	negated := len(runes) > 0 && runes[0] == '^'
+	if negated {
+		runes = runes[1:]
+	}
+
+	ranges := []CharRange{}
+	for len(runes) > 0 {
+		low, rest, err := parseRune(runes)
+		if err != nil {
+			return nil, false, err
+		}
+		high := low
+		if len(rest) > 1 && rest[0] == '-' {
+			high, rest, err = parseRune(rest[1:])
+			if err != nil {
+				return nil, false, err
+			}
+			if high < low {
+				return nil, false, fmt.Errorf("invalid range %c-%c in character class", low, high)
+			}
+		}
+		ranges = append(ranges, CharRange{Low: low, High: high})
+		runes = rest
+	}
+	return ranges, negated, nil
+}
+
+// UnescapeString decodes the escape sequences of a string token value, which
+// the lexer keeps as written. It is the only place literals are decoded.
+func UnescapeString(value string) (string, error) {
+	runes := []rune(value)
+	var builder strings.Builder
+	for len(runes) > 0 {
+		char, rest, err := parseRune(runes)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteRune(char)
+		runes = rest
+	}
+	return builder.String(), nil
+}
+
+// parseRune reads one possibly escaped character, as in llama.cpp's
+// parse_char, and returns it with the remaining input.
+func parseRune(runes []rune) (rune, []rune, error) {
+	if runes[0] != '\\' || len(runes) == 1 {
+		return runes[0], runes[1:], nil
+	}
+
+	digits := 0
+	switch runes[1] {
+	case 'x':
+		digits = 2
+	case 'u':
+		digits = 4
+	case 'U':
+		digits = 8
+	case 'n':
+		return '\n', runes[2:], nil
+	case 'r':
+		return '\r', runes[2:], nil
+	case 't':
+		return '\t', runes[2:], nil
+	default:
+		return runes[1], runes[2:], nil
+	}
+
+	if len(runes) < 2+digits {
+		return 0, nil, fmt.Errorf("expected %d hex digits after \\%c", digits, runes[1])
+	}
+	var char rune
+	for _, digit := range runes[2 : 2+digits] {
+		var value rune
+		switch {
+		case '0' <= digit && digit <= '9':
+			value = digit - '0'
+		case 'a' <= digit && digit <= 'f':
+			value = digit - 'a' + 10
+		case 'A' <= digit && digit <= 'F':
+			value = digit - 'A' + 10
+		default:
+			return 0, nil, fmt.Errorf("invalid hex digit %q after \\%c", digit, runes[1])
+		}
+		char = char*16 + value
+	}
+	return char, runes[2+digits:], nil
+}
+
+// MergeRanges sorts ranges and merges those that overlap or touch.
+func MergeRanges(ranges []CharRange) []CharRange {
+	sorted := slices.Clone(ranges)
+	slices.SortFunc(sorted, func(a, b CharRange) int { return int(a.Low - b.Low) })
+	merged := []CharRange{}
+	for _, charRange := range sorted {
+		if last := len(merged) - 1; last >= 0 && charRange.Low <= merged[last].High+1 {
+			merged[last].High = max(merged[last].High, charRange.High)
+			continue
+		}
+		merged = append(merged, charRange)
+	}
+	return merged
+}
+
+// InvertRanges returns the characters outside ranges.
+func InvertRanges(ranges []CharRange) []CharRange {
+	result := []CharRange{}
+	low := rune(0)
+	for _, charRange := range MergeRanges(ranges) {
+		if charRange.Low > low {
+			result = append(result, CharRange{Low: low, High: charRange.Low - 1})
+		}
+		low = charRange.High + 1
+	}
+	if low <= MaxRune {
+		result = append(result, CharRange{Low: low, High: MaxRune})
+	}
+	return result
+}
+
+// IntersectRanges returns the characters in both a and b.
+func IntersectRanges(a []CharRange, b []CharRange) []CharRange {
+	result := []CharRange{}
+	a, b = MergeRanges(a), MergeRanges(b)
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		low, high := max(a[i].Low, b[j].Low), min(a[i].High, b[j].High)
+		if low <= high {
+			result = append(result, CharRange{Low: low, High: high})
+		}
+		if a[i].High < b[j].High {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
@@ -0,0 +1,21 @@
+package GBNFParser
+
+// EffectiveDeclarations returns the declaration of every rule of ast, in the
+// order the rules are first declared. Like in llama.cpp, a rule declared more
+// than once is defined by its last declaration.
+func EffectiveDeclarations(ast *Node) []*Node {
+	declarations := []*Node{}
+	indices := map[string]int{}
+	for _, node := range ast.Children {
+		if node.Type != NodeDeclaration {
+			continue
+		}
+		if index, ok := indices[node.Token.Value]; ok {
+			declarations[index] = node
+			continue
+		}
+		indices[node.Token.Value] = len(declarations)
+		declarations = append(declarations, node)
+	}
+	return declarations
+}
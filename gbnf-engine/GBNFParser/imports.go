@@ -0,0 +1,164 @@
+package GBNFParser
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// GrammarFile is a parsed grammar file.
+type GrammarFile struct {
+	Path   string
+	Text   string
+	Tokens []Token
+	AST    *Node
+	Errors []*ParseError
+}
+
+// ParseGrammarFile lexes and parses the text of the grammar at path.
+func ParseGrammarFile(path string, text string) *GrammarFile {
+	lexer := NewLexer(text)
+	tokens := lexer.LexAllTokens()
+	parser := NewParser(tokens)
+	ast, errors := parser.ParseAllRules()
+	return &GrammarFile{
+		Path:   path,
+		Text:   text,
+		Tokens: tokens,
+		AST:    ast,
+		Errors: errors,
+	}
+}
+
+// ReadGrammarFile reads and parses the grammar at path.
+func ReadGrammarFile(path string) (*GrammarFile, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseGrammarFile(path, string(text)), nil
+}
+
+// GetImports returns the import nodes of a grammar.
+func GetImports(ast *Node) []*Node {
+	imports := []*Node{}
+	if ast == nil {
+		return imports
+	}
+	for _, node := range ast.Children {
+		if node.Type == NodeImport {
+			imports = append(imports, node)
+		}
+	}
+	return imports
+}
+
+// ResolveImportPath returns the path an import refers to. Relative imports
+// are resolved against the directory of the importing file.
+func ResolveImportPath(fromPath string, importPath string) string {
+	importPath = filepath.FromSlash(importPath)
+	if filepath.IsAbs(importPath) {
+		return filepath.Clean(importPath)
+	}
+	return filepath.Join(filepath.Dir(fromPath), importPath)
+}
+
+// ImportError is a failure to resolve an import.
+type ImportError struct {
+	Message string
+	// Path is the file containing the failing import and Token its path.
+	Path  string
+	Token *Token
+	// Via is the import in the root file through which the failing import
+	// was reached. It equals Token for imports in the root file itself.
+	Via *Token
+}
+
+// ImportResolver collects the grammars imported by a file.
+type ImportResolver struct {
+	// Load returns the parsed grammar at path. Editors use this to serve
+	// unsaved files.
+	Load func(path string) (*GrammarFile, error)
+}
+
+func NewImportResolver() *ImportResolver {
+	return &ImportResolver{Load: ReadGrammarFile}
+}
+
+// Resolve returns every file imported by root, directly or transitively, in
+// the order they are first reached. Each file is returned once, even if it
+// is imported several times.
+func (resolver *ImportResolver) Resolve(root *GrammarFile) ([]*GrammarFile, []*ImportError) {
+	files := []*GrammarFile{}
+	errors := []*ImportError{}
+	visited := map[string]bool{filepath.Clean(root.Path): true}
+
+	var visit func(file *GrammarFile, via *Token, stack []string)
+	visit = func(file *GrammarFile, via *Token, stack []string) {
+		for _, node := range GetImports(file.AST) {
+			importVia := via
+			if file == root {
+				importVia = node.Token
+			}
+			path := ResolveImportPath(file.Path, node.Token.Value)
+
+			for _, ancestor := range stack {
+				if ancestor == path {
+					errors = append(errors, &ImportError{
+						Message: "import cycle through " + node.Token.Value,
+						Path:    file.Path,
+						Token:   node.Token,
+						Via:     importVia,
+					})
+				}
+			}
+			if visited[path] {
+				continue
+			}
+			visited[path] = true
+
+			imported, err := resolver.Load(path)
+			if err != nil {
+				errors = append(errors, &ImportError{
+					Message: "cannot read " + node.Token.Value + ": " + err.Error(),
+					Path:    file.Path,
+					Token:   node.Token,
+					Via:     importVia,
+				})
+				continue
+			}
+			files = append(files, imported)
+			visit(imported, importVia, append(stack, path))
+		}
+	}
+	visit(root, nil, []string{filepath.Clean(root.Path)})
+
+	return files, errors
+}
+
+// Flatten combines root and the files it imports into a single grammar
+// without imports. Rules keep the order of their files, root first. A rule
+// declared in more than one file is reported as an error, as the files would
+// silently change each other's rules once combined.
+func Flatten(root *GrammarFile, imported []*GrammarFile) (*Node, []string) {
+	flattened := &Node{Type: NodeRoot}
+	errors := []string{}
+	declaredIn := map[string]string{}
+
+	for _, file := range append([]*GrammarFile{root}, imported...) {
+		fileDeclarations := map[string]bool{}
+		for _, node := range file.AST.Children {
+			if node.Type != NodeDeclaration {
+				continue
+			}
+			name := node.Token.Value
+			if path, ok := declaredIn[name]; ok && !fileDeclarations[name] {
+				errors = append(errors, "rule `"+name+"` is declared in both "+path+" and "+file.Path)
+				continue
+			}
+			declaredIn[name] = file.Path
+			fileDeclarations[name] = true
+			flattened.Children = append(flattened.Children, node)
+		}
+	}
+	return flattened, errors
+}
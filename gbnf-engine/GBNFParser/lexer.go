@@ -18,6 +18,7 @@ const (
 	TokenIdentifier
 	TokenRepeat
 	TokenEOL
+	TokenImport
 )
 
 type Token struct {
@@ -25,7 +26,11 @@ type Token struct {
 	Value  string
 	Line   int
 	Column int
-	Error  string
+	// EndLine and EndColumn are the position just after the token in the
+	// source, which Value may not span as escapes are resolved.
+	EndLine   int
+	EndColumn int
+	Error     string
 }
 
 type Lexer struct {
@@ -57,6 +62,7 @@ func (lexer *Lexer) LexAllTokens() []Token {
 			tokens = append(tokens, loopToken)
 			break
 		}
+		newToken.EndLine, newToken.EndColumn = lexer.line, lexer.column
 		tokens = append(tokens, newToken)
 	}
 	return tokens
@@ -151,14 +157,11 @@ func (lexer *Lexer) lexString() Token {
 			return Token{Type: TokenString, Value: string(value), Error: "unterminated string", Line: startLine, Column: startColumn}
 		}
 
-		if char == '\\' {
-			nextChar := lexer.peek()
-			switch nextChar {
-			case '"', '\\':
-				lexer.next()
-				value = append(value, nextChar)
-				continue
-			}
+		// Escape sequences are kept as written, so the value is exactly the
+		// source text of the literal. UnescapeString decodes them.
+		if char == '\\' && lexer.peek() != '\n' && lexer.peek() != 0 {
+			value = append(value, char, lexer.next())
+			continue
 		}
 
 		if char == '"' {
@@ -190,6 +193,10 @@ func (lexer *Lexer) lexRegex() Token {
 			return Token{Type: TokenRegexp, Value: string(value), Line: startLine, Column: startColumn, Error: "unterminated regex"}
 		}
 		value = append(value, char)
+		if char == '\\' && lexer.peek() != '\n' && lexer.peek() != 0 {
+			// Escaped characters, such as \], never open or close the class.
+			value = append(value, lexer.next())
+		}
 	}
 	return Token{Type: TokenRegexp, Value: string(value), Line: startLine, Column: startColumn}
 }
@@ -229,13 +236,28 @@ func (lexer *Lexer) lexRange() Token {
 	return Token{Type: TokenRepeat, Value: string(value), Line: startLine, Column: startColumn}
 }
 
+// IsValidIdentifier tells whether name lexes as a single rule name: a letter
+// followed by letters, digits and dashes.
+func IsValidIdentifier(name string) bool {
+	for index, char := range name {
+		if index == 0 && !unicode.IsLetter(char) || !isIdentifierRune(char) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func isIdentifierRune(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '-'
+}
+
 func (lexer *Lexer) lexIdentifier() Token {
 	startLine, startColumn := lexer.line, lexer.column
 	breakCharacters := "\n{*+?)"
 	var value []rune
 	for {
 		peek := lexer.peek()
-		if unicode.IsLetter(peek) || unicode.IsDigit(peek) || peek == '-' {
+		if isIdentifierRune(peek) {
 			value = append(value, lexer.next())
 		} else if unicode.IsSpace(peek) || peek == 0 || strings.Contains(breakCharacters, string(peek)) {
 			break
@@ -248,6 +270,10 @@ func (lexer *Lexer) lexIdentifier() Token {
 }
 
 func (lexer *Lexer) lexComment() Token {
+	if lexer.hasPragma("import") {
+		return lexer.lexImport()
+	}
+
 	char := lexer.next()
 	for char != '\n' && char != 0 {
 		char = lexer.next()
@@ -255,6 +281,71 @@ func (lexer *Lexer) lexComment() Token {
 	return Token{Type: TokenEOL, Line: lexer.line, Column: lexer.column}
 }
 
+// hasPragma reports whether the comment at the current position is the pragma
+// `# @name`.
+func (lexer *Lexer) hasPragma(name string) bool {
+	pos := lexer.pos + 1
+	for pos < len(lexer.input) && lexer.input[pos] != '\n' && unicode.IsSpace(lexer.input[pos]) {
+		pos++
+	}
+	pragma := []rune("@" + name)
+	if pos+len(pragma) > len(lexer.input) || string(lexer.input[pos:pos+len(pragma)]) != string(pragma) {
+		return false
+	}
+	pos += len(pragma)
+	return pos == len(lexer.input) || unicode.IsSpace(lexer.input[pos])
+}
+
+// skipPragma consumes the comment marker and the pragma name.
+func (lexer *Lexer) skipPragma() {
+	for lexer.peek() != '@' {
+		lexer.next()
+	}
+	for lexer.pos < len(lexer.input) && !unicode.IsSpace(lexer.peek()) {
+		lexer.next()
+	}
+	lexer.skipWhitespace()
+}
+
+// lexImport lexes `# @import "path"`. The newline ending the pragma is left
+// for the next token.
+func (lexer *Lexer) lexImport() Token {
+	startLine, startColumn := lexer.line, lexer.column
+	lexer.skipPragma()
+
+	if lexer.peek() != '"' {
+		lexer.skipLine()
+		return Token{Type: TokenImport, Line: startLine, Column: startColumn, Error: "expected a quoted path after @import"}
+	}
+
+	path := lexer.lexString()
+	path.Type = TokenImport
+	if path.Error == "" {
+		// Unlike string literals, the path is used decoded.
+		decoded, err := UnescapeString(path.Value)
+		if err != nil {
+			path.Error = err.Error()
+		}
+		path.Value = decoded
+	}
+	if path.Error == "" && path.Value == "" {
+		path.Error = "empty import path"
+	}
+	lexer.skipWhitespace()
+	if path.Error == "" && lexer.peek() != '\n' && lexer.peek() != 0 {
+		path.Error = "unexpected text after import path"
+	}
+	lexer.skipLine()
+	return path
+}
+
+// skipLine consumes the remainder of the line, excluding the newline.
+func (lexer *Lexer) skipLine() {
+	for lexer.peek() != '\n' && lexer.peek() != 0 {
+		lexer.next()
+	}
+}
+
 func (lexer *Lexer) lexUnknown() Token {
 
 	startLine, startColumn := lexer.line, lexer.column
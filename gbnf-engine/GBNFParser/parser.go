@@ -16,6 +16,7 @@ const (
 	NodeRoot
 	NodeDeclaration
 	NodeRepeat
+	NodeImport
 )
 
 func (t TokenType) String() string {
@@ -38,6 +39,8 @@ func (t TokenType) String() string {
 		return "TokenRepeat"
 	case TokenEOL:
 		return "TokenEOL"
+	case TokenImport:
+		return "TokenImport"
 	default:
 		return "TokenUnknown"
 	}
@@ -65,6 +68,27 @@ type Node struct {
 	Children []*Node
 	Token    *Token
 	Type     NodeType
+	// Span is the part of the source the node was parsed from. It is zero
+	// for empty branches and for nodes that were not parsed.
+	Span Span
+}
+
+// Span is a range of the source, from the start of a first token to the end
+// of a last one, including the parentheses of groups.
+type Span struct {
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int
+}
+
+func tokenSpan(token *Token) Span {
+	return Span{Line: token.Line, Column: token.Column, EndLine: token.EndLine, EndColumn: token.EndColumn}
+}
+
+// joinSpans returns the span from the start of first to the end of last.
+func joinSpans(first Span, last Span) Span {
+	return Span{Line: first.Line, Column: first.Column, EndLine: last.EndLine, EndColumn: last.EndColumn}
 }
 
 type Parser struct {
@@ -147,6 +171,14 @@ func (parser *Parser) ParseRule() (*Node, *ParseError) {
 		return nil, nil
 	}
 
+	if parser.peek().Type == TokenImport {
+		token := parser.next()
+		if token.Error != "" {
+			return nil, NewParseError("%s", token, token.Error)
+		}
+		return &Node{Token: token, Type: NodeImport}, nil
+	}
+
 	nameToken, err := parser.expect(TokenIdentifier)
 	if err != nil {
 		parser.forwardTillNextLine()
@@ -171,6 +203,7 @@ func (parser *Parser) ParseRule() (*Node, *ParseError) {
 		parser.forwardTillNextLine()
 		return nil, err
 	}
+	root.Span = joinSpans(tokenSpan(nameToken), children[len(children)-1].Span)
 	return &root, nil
 }
 
@@ -220,6 +253,8 @@ Loop:
 				Length:  len(token.Value),
 			}
 			return nil, &err
+		case TokenImport:
+			return nil, NewParseError("imports must be declared outside of rules", token)
 		case TokenAssignment:
 			err := ParseError{
 				Message: "unexpected assignment",
@@ -233,7 +268,7 @@ Loop:
 			// Alternatives are done after parsing the entire expression.
 			nodes = append(nodes, &Node{Type: NodeAlternative, Min: 1, Max: 1, Token: token})
 		case TokenString, TokenRegexp, TokenIdentifier:
-			nodes = append(nodes, &Node{Token: token, Min: 1, Max: 1, Type: NodeToken})
+			nodes = append(nodes, &Node{Token: token, Min: 1, Max: 1, Type: NodeToken, Span: tokenSpan(token)})
 
 		case TokenOperator:
 			if len(nodes) == 0 {
@@ -269,6 +304,10 @@ Loop:
 				}
 				newNode := Node{Type: NodeSubExpression}
 				newNode.Children = children
+				newNode.Span = joinSpans(tokenSpan(token), children[len(children)-1].Span)
+				if closing := &parser.Tokens[parser.pos-1]; closing.Type == TokenSubExpression && closing.Value == ")" {
+					newNode.Span = joinSpans(tokenSpan(token), tokenSpan(closing))
+				}
 				nodes = append(nodes, &newNode)
 			} else {
 				break Loop
@@ -288,45 +327,55 @@ Loop:
 	return nodes, nil
 }
 
+// parseAlternatives groups an expression on its alternatives. Alternatives
+// bind loosest, so `a | b c` yields a NodeAlternative with children `a` and
+// a NodeSubExpression holding `b c`.
 func (parser *Parser) parseAlternatives(nodes []*Node) ([]*Node, *ParseError) {
-	newNodes := []*Node{}
-	for index := 0; index < len(nodes); index++ {
-		node := nodes[index]
+	var alternative *Node
+	groups := [][]*Node{{}}
+	for index, node := range nodes {
 		if node.Type != NodeAlternative {
-			newNodes = append(newNodes, node)
+			groups[len(groups)-1] = append(groups[len(groups)-1], node)
 			continue
 		}
 
 		if index == len(nodes)-1 {
 			return []*Node{}, NewParseError("alternative found at end of expression", node.Token)
 		}
-
-		var previousNode *Node
-		if index == 0 {
-			// | at the start of an expression is legal.
-			previousNode = &Node{Type: NodeUnknown}
-		} else {
-			previousNode = newNodes[len(newNodes)-1]
-		}
-		nextNode := nodes[index+1]
-
-		if nextNode.Type == NodeAlternative {
+		if nodes[index+1].Type == NodeAlternative {
 			return []*Node{}, NewParseError("cannot have two alternatives in succession", node.Token)
 		}
-		if previousNode.Type == NodeAlternative {
-			previousNode.Children = append(previousNode.Children, nextNode)
-		} else {
-			node.Children = []*Node{previousNode, nextNode}
-			if len(newNodes) == 0 {
-				newNodes = append(newNodes, node)
-			} else {
-				newNodes[len(newNodes)-1] = node
-			}
+		if alternative == nil {
+			alternative = node
 		}
-		index++
+		groups = append(groups, []*Node{})
+	}
+
+	if alternative == nil {
+		return nodes, nil
 	}
 
-	return newNodes, nil
+	for _, group := range groups {
+		switch len(group) {
+		case 0:
+			// | at the start of an expression is legal.
+			alternative.Children = append(alternative.Children, &Node{Type: NodeUnknown})
+		case 1:
+			alternative.Children = append(alternative.Children, group[0])
+		default:
+			alternative.Children = append(alternative.Children, &Node{
+				Type:     NodeSubExpression,
+				Children: group,
+				Span:     joinSpans(group[0].Span, group[len(group)-1].Span),
+			})
+		}
+	}
+	start := tokenSpan(alternative.Token)
+	if first := alternative.Children[0]; first.Type != NodeUnknown {
+		start = first.Span
+	}
+	alternative.Span = joinSpans(start, alternative.Children[len(alternative.Children)-1].Span)
+	return []*Node{alternative}, nil
 }
 
 func (parser *Parser) parseOperator(previousNode *Node, token *Token) (*Node, *ParseError) {
@@ -357,6 +406,7 @@ func (parser *Parser) parseOperator(previousNode *Node, token *Token) (*Node, *P
 			Max:      maxRepeats,
 			Type:     NodeRepeat,
 			Children: []*Node{previousNode},
+			Span:     joinSpans(previousNode.Span, tokenSpan(token)),
 		}, nil
 	default:
 		return nil, NewParseError("cannot apply operator to this token type", token)
@@ -402,11 +452,16 @@ func (parser *Parser) parseRepeat(previousNode *Node, token *Token) (*Node, *Par
 		return nil, NewParseError("expected 1 or 2 repeat parts, got %d", token, len(parts))
 	}
 
+	if max != -1 && max < min {
+		return nil, NewParseError("repeat maximum %d is less than minimum %d", token, max, min)
+	}
+
 	return &Node{
 		Token:    token,
 		Min:      min,
 		Max:      max,
 		Type:     NodeRepeat,
 		Children: []*Node{previousNode},
+		Span:     joinSpans(previousNode.Span, tokenSpan(token)),
 	}, nil
 }
@@ -0,0 +1,97 @@
+package GBNFParser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format prints the imports and rules of a grammar, one per line. The output
+// only depends on the AST, not on the formatting of the source.
+func Format(root *Node) string {
+	var builder strings.Builder
+	for _, node := range root.Children {
+		switch node.Type {
+		case NodeImport:
+			builder.WriteString("# @import " + QuoteLiteral(node.Token.Value) + "\n")
+		case NodeDeclaration:
+			builder.WriteString(FormatRule(node) + "\n")
+		}
+	}
+	return builder.String()
+}
+
+// FormatRule prints a single declaration as `name ::= body`.
+func FormatRule(rule *Node) string {
+	return rule.Token.Value + " ::= " + FormatExpression(rule.Children)
+}
+
+// FormatExpression prints a sequence of expression nodes.
+func FormatExpression(nodes []*Node) string {
+	parts := []string{}
+	for _, node := range nodes {
+		if part := formatNode(node); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatNode(node *Node) string {
+	switch node.Type {
+	case NodeToken:
+		return formatToken(node.Token)
+	case NodeSubExpression:
+		return "(" + FormatExpression(node.Children) + ")"
+	case NodeAlternative:
+		parts := []string{}
+		for _, child := range node.Children {
+			if child.Type == NodeSubExpression {
+				// Alternatives bind loosest, so sequences need no parentheses.
+				parts = append(parts, FormatExpression(child.Children))
+			} else {
+				parts = append(parts, formatNode(child))
+			}
+		}
+		return strings.TrimSpace(strings.Join(parts, " | "))
+	case NodeRepeat:
+		return formatNode(node.Children[0]) + formatRepeat(node)
+	default:
+		return ""
+	}
+}
+
+func formatToken(token *Token) string {
+	switch token.Type {
+	case TokenString:
+		// The value is the literal as written, escapes included.
+		return `"` + token.Value + `"`
+	default:
+		return token.Value
+	}
+}
+
+// formatRepeat prints the operator of a repeat, keeping `*`, `+` and `?` as
+// written and normalising `{m,n}`.
+func formatRepeat(node *Node) string {
+	if node.Token != nil && node.Token.Type == TokenOperator {
+		return node.Token.Value
+	}
+	if node.Token == nil {
+		switch {
+		case node.Min == 0 && node.Max == -1:
+			return "*"
+		case node.Min == 1 && node.Max == -1:
+			return "+"
+		case node.Min == 0 && node.Max == 1:
+			return "?"
+		}
+	}
+	switch {
+	case node.Max == -1:
+		return fmt.Sprintf("{%d,}", node.Min)
+	case node.Min == node.Max:
+		return fmt.Sprintf("{%d}", node.Min)
+	default:
+		return fmt.Sprintf("{%d,%d}", node.Min, node.Max)
+	}
+}
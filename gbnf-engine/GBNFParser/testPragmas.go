@@ -0,0 +1,99 @@
+package GBNFParser
+
+import (
+	"strings"
+	"unicode"
+)
+
+// GrammarTest is a test case written in a comment at the start of a line:
+//
+//	# @test accept "{\"a\":1}"
+//	# @test reject value "[1,"
+//
+// The optional rule name defaults to root.
+type GrammarTest struct {
+	Accept bool
+	Rule   string
+	// Text is the test string with its escapes resolved.
+	Text string
+	// Line, Column and EndColumn span the pragma.
+	Line      int
+	Column    int
+	EndColumn int
+}
+
+// ParseTests returns the test pragmas of a grammar, and errors for pragmas
+// that are malformed.
+func ParseTests(text string) ([]*GrammarTest, []*ParseError) {
+	tests := []*GrammarTest{}
+	errors := []*ParseError{}
+	for lineNumber, line := range strings.Split(text, "\n") {
+		runes := []rune(strings.TrimRight(line, "\r"))
+		column := 0
+		for column < len(runes) && unicode.IsSpace(runes[column]) {
+			column++
+		}
+		if column == len(runes) || runes[column] != '#' {
+			continue
+		}
+
+		lexer := NewLexer(string(runes))
+		lexer.pos, lexer.column = column, column
+		if !lexer.hasPragma("test") {
+			continue
+		}
+		lexer.skipPragma()
+		test, err := parseTestPragma(lexer.LexAllTokens(), lineNumber, column, len(runes))
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		tests = append(tests, test)
+	}
+	return tests, errors
+}
+
+// parseTestPragma reads the mode, rule and text of a test from the tokens
+// following `@test`.
+func parseTestPragma(tokens []Token, line int, column int, endColumn int) (*GrammarTest, *ParseError) {
+	pragma := &Token{Line: line, Column: column, Value: strings.Repeat(" ", endColumn-column)}
+	significant := []*Token{}
+	for index := range tokens {
+		tokens[index].Line = line
+		if tokens[index].Type != TokenEOL {
+			significant = append(significant, &tokens[index])
+		}
+	}
+
+	test := &GrammarTest{Rule: "root", Line: line, Column: column, EndColumn: endColumn}
+	if len(significant) == 0 || significant[0].Type != TokenIdentifier ||
+		(significant[0].Value != "accept" && significant[0].Value != "reject") {
+		return nil, NewParseError("expected accept or reject after @test", pragma)
+	}
+	test.Accept = significant[0].Value == "accept"
+	significant = significant[1:]
+
+	if len(significant) > 0 && significant[0].Type == TokenIdentifier {
+		if significant[0].Error != "" {
+			return nil, NewParseError("invalid rule name %s", significant[0], significant[0].Value)
+		}
+		test.Rule = significant[0].Value
+		significant = significant[1:]
+	}
+
+	if len(significant) == 0 || significant[0].Type != TokenString {
+		return nil, NewParseError("expected a quoted test string", pragma)
+	}
+	if significant[0].Error != "" {
+		return nil, NewParseError("%s", significant[0], significant[0].Error)
+	}
+	text, err := UnescapeString(significant[0].Value)
+	if err != nil {
+		return nil, NewParseError("%v", significant[0], err)
+	}
+	test.Text = text
+	if len(significant) > 1 {
+		return nil, NewParseError("unexpected text after the test string", significant[1])
+	}
+	return test, nil
+}
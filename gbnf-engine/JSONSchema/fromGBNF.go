@@ -0,0 +1,941 @@
+package JSONSchema
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"strings"
+)
+
+// jsonTypes are the types a schema without a type accepts.
+var jsonTypes = []string{"object", "array", "string", "number", "boolean", "null"}
+
+const (
+	whitespaceCharacters = " \t\n\r"
+	numberCharacters     = "0123456789-+.eE"
+)
+
+type inferrer struct {
+	rules      map[string]*GBNFParser.Node
+	schemas    map[string]*Object
+	inProgress map[string]bool
+	recursive  map[string]bool
+	defs       *Object
+	whitespace map[string]bool
+	// expanding holds the rules inlined into an object, to stop recursion.
+	expanding map[string]bool
+	current   string
+	unmapped  []string
+	reported  map[string]bool
+}
+
+// Infer recovers a JSON Schema for the JSON documents accepted by the `root`
+// rule of a grammar, by recognising the shapes of JSON objects, arrays,
+// strings, numbers and literals. Rules that cannot be mapped are returned as
+// messages; they accept any value in the schema, which is then more
+// permissive than the grammar. So are strings whose characters the schema
+// cannot restrict.
+func Infer(ast *GBNFParser.Node) (*Object, []string) {
+	inferrer := &inferrer{
+		rules:      map[string]*GBNFParser.Node{},
+		schemas:    map[string]*Object{},
+		inProgress: map[string]bool{},
+		recursive:  map[string]bool{},
+		defs:       NewObject(),
+		whitespace: map[string]bool{},
+		expanding:  map[string]bool{},
+		reported:   map[string]bool{},
+	}
+	for _, node := range ast.Children {
+		if node.Type == GBNFParser.NodeDeclaration {
+			if _, ok := inferrer.rules[node.Token.Value]; !ok {
+				inferrer.rules[node.Token.Value] = node
+			}
+		}
+	}
+	if _, ok := inferrer.rules["root"]; !ok {
+		return nil, []string{"no `root` rule declared"}
+	}
+
+	root := inferrer.inferRule("root")
+	schema := NewObject()
+	schema.Set("$schema", "https://json-schema.org/draft/2020-12/schema")
+	for _, key := range root.Keys {
+		schema.Set(key, root.Values[key])
+	}
+
+	// Recursive rules that accept any value, like `value`, need no $defs.
+	defs, anyValue := NewObject(), map[string]bool{}
+	for _, name := range inferrer.defs.Keys {
+		if definition := inferrer.defs.Values[name].(*Object); len(definition.Keys) == 0 {
+			anyValue["#/$defs/"+name] = true
+		} else {
+			defs.Set(name, definition)
+		}
+	}
+	if len(defs.Keys) > 0 {
+		schema.Set("$defs", defs)
+	}
+	return simplify(schema, anyValue).(*Object), inferrer.unmapped
+}
+
+func (inferrer *inferrer) report(format string, args ...any) {
+	message := fmt.Sprintf("rule `%s`: ", inferrer.current) + fmt.Sprintf(format, args...)
+	if !inferrer.reported[message] {
+		inferrer.reported[message] = true
+		inferrer.unmapped = append(inferrer.unmapped, message)
+	}
+}
+
+func (inferrer *inferrer) inferRule(name string) *Object {
+	if schema, ok := inferrer.schemas[name]; ok {
+		return schema
+	}
+	if inferrer.inProgress[name] {
+		inferrer.recursive[name] = true
+		return refSchema(name)
+	}
+	rule, ok := inferrer.rules[name]
+	if !ok {
+		inferrer.report("rule `%s` is not declared", name)
+		return NewObject()
+	}
+
+	inferrer.inProgress[name] = true
+	previous := inferrer.current
+	inferrer.current = name
+	schema := inferrer.inferSequence(rule.Children)
+	inferrer.current = previous
+	delete(inferrer.inProgress, name)
+
+	if inferrer.recursive[name] {
+		inferrer.defs.Set(name, schema)
+		schema = refSchema(name)
+	}
+	inferrer.schemas[name] = schema
+	return schema
+}
+
+func (inferrer *inferrer) inferSequence(nodes []*GBNFParser.Node) *Object {
+	nodes = inferrer.significant(nodes)
+	if len(nodes) == 0 {
+		inferrer.report("only matches whitespace")
+		return NewObject()
+	}
+
+	if text, ok := literalText(nodes); ok {
+		if value, err := Decode([]byte(text)); err == nil {
+			return constSchema(value)
+		}
+	}
+
+	first, _ := literalText(nodes[:1])
+	first = strings.TrimLeft(first, whitespaceCharacters)
+	switch {
+	case strings.HasPrefix(first, "{"):
+		return inferrer.inferObject(nodes)
+	case strings.HasPrefix(first, "["):
+		return inferrer.inferArray(nodes)
+	case strings.HasPrefix(first, `"`):
+		return inferrer.inferString(nodes)
+	}
+
+	if len(nodes) == 1 {
+		switch nodes[0].Type {
+		case GBNFParser.NodeSubExpression:
+			return inferrer.inferSequence(nodes[0].Children)
+		case GBNFParser.NodeAlternative:
+			return inferrer.inferAlternative(nodes[0])
+		case GBNFParser.NodeToken:
+			if nodes[0].Token.Type == GBNFParser.TokenIdentifier {
+				return inferrer.inferRule(nodes[0].Token.Value)
+			}
+		}
+	}
+
+	if chars, ok := inferrer.characters(nodes, map[string]bool{}); ok && isNumeric(chars) {
+		if chars['.'] || chars['e'] || chars['E'] {
+			return typeSchema("number")
+		}
+		return typeSchema("integer")
+	}
+
+	inferrer.report("cannot map `%s` to a JSON value", GBNFParser.FormatExpression(nodes))
+	return NewObject()
+}
+
+func (inferrer *inferrer) inferAlternative(node *GBNFParser.Node) *Object {
+	schemas := []*Object{}
+	for _, child := range node.Children {
+		switch child.Type {
+		case GBNFParser.NodeUnknown:
+			inferrer.report("an alternative is empty")
+		case GBNFParser.NodeSubExpression:
+			schemas = append(schemas, inferrer.inferSequence(child.Children))
+		default:
+			schemas = append(schemas, inferrer.inferSequence([]*GBNFParser.Node{child}))
+		}
+	}
+	return union(schemas)
+}
+
+// inferString maps a sequence between double quotes to a string. Only a
+// repeat of JSON string characters maps exactly, with its bounds as the
+// length; strings of other characters are reported, as a schema without a
+// pattern accepts any characters.
+func (inferrer *inferrer) inferString(nodes []*GBNFParser.Node) *Object {
+	last, ok := literalText(nodes[len(nodes)-1:])
+	if len(nodes) < 2 || !ok || !strings.HasSuffix(strings.TrimRight(last, whitespaceCharacters), `"`) {
+		inferrer.report("string `%s` does not end with a quote", GBNFParser.FormatExpression(nodes))
+		return typeSchema("string")
+	}
+
+	schema := typeSchema("string")
+	first, _ := literalText(nodes[:1])
+	if len(nodes) != 3 || first != `"` || last != `"` || nodes[1].Type != GBNFParser.NodeRepeat {
+		inferrer.report("string `%s` is mapped to a string of any characters", GBNFParser.FormatExpression(nodes))
+		return schema
+	}
+	repeat := nodes[1]
+	if !inferrer.isJSONCharacter(repeat.Children, map[string]bool{}) {
+		inferrer.report("string `%s` is mapped to a string of any characters", GBNFParser.FormatExpression(nodes))
+		if !isCharClass(repeat.Children) {
+			// Only a repeat of single characters bounds the length.
+			return schema
+		}
+	}
+	if repeat.Min > 0 {
+		schema.Set("minLength", repeat.Min)
+	}
+	if repeat.Max != -1 {
+		schema.Set("maxLength", repeat.Max)
+	}
+	return schema
+}
+
+// jsonCharacterExclusions are the characters a JSON string cannot contain
+// without an escape sequence.
+var jsonCharacterExclusions = []GBNFParser.CharRange{{Low: '"', High: '"'}, {Low: '\\', High: '\\'}, {Low: 0x00, High: 0x1F}, {Low: 0x7F, High: 0x7F}}
+
+// isJSONCharacter reports whether nodes match any character of a JSON
+// string, like the `char` rule of JSON grammars: a negated class excluding
+// only characters that must be escaped, possibly followed by the escape
+// sequences as further alternatives.
+func (inferrer *inferrer) isJSONCharacter(nodes []*GBNFParser.Node, visiting map[string]bool) bool {
+	if len(nodes) != 1 {
+		return false
+	}
+	node := nodes[0]
+	switch node.Type {
+	case GBNFParser.NodeSubExpression:
+		return inferrer.isJSONCharacter(node.Children, visiting)
+	case GBNFParser.NodeAlternative:
+		return inferrer.isJSONCharacter(node.Children[:1], visiting)
+	case GBNFParser.NodeToken:
+		switch node.Token.Type {
+		case GBNFParser.TokenRegexp:
+			ranges, negated, err := GBNFParser.ParseCharClass(node.Token.Value)
+			if err != nil || !negated {
+				return false
+			}
+			for _, charRange := range ranges {
+				excluded := false
+				for _, exclusion := range jsonCharacterExclusions {
+					excluded = excluded || charRange.Low >= exclusion.Low && charRange.High <= exclusion.High
+				}
+				if !excluded {
+					return false
+				}
+			}
+			return true
+		case GBNFParser.TokenIdentifier:
+			rule, ok := inferrer.rules[node.Token.Value]
+			if !ok || visiting[node.Token.Value] {
+				return false
+			}
+			visiting[node.Token.Value] = true
+			return inferrer.isJSONCharacter(rule.Children, visiting)
+		}
+	}
+	return false
+}
+
+// isCharClass reports whether nodes are a single character class.
+func isCharClass(nodes []*GBNFParser.Node) bool {
+	return len(nodes) == 1 && nodes[0].Type == GBNFParser.NodeToken && nodes[0].Token.Type == GBNFParser.TokenRegexp
+}
+
+// inferArray maps a sequence between brackets to an array, counting how
+// often the items can occur.
+func (inferrer *inferrer) inferArray(nodes []*GBNFParser.Node) *Object {
+	first, _ := literalText(nodes[:1])
+	last, ok := literalText(nodes[len(nodes)-1:])
+	if len(nodes) < 2 || !ok || strings.TrimSpace(last) != "]" || strings.TrimSpace(first) != "[" {
+		inferrer.report("array `%s` is not of the form \"[\" items \"]\"", GBNFParser.FormatExpression(nodes))
+		return typeSchema("array")
+	}
+
+	items := inferrer.countItems(nodes[1 : len(nodes)-1])
+	schema := typeSchema("array")
+	switch {
+	case len(items.schemas) == 0:
+	case items.tuple && !allEqual(items.schemas):
+		prefixItems := []any{}
+		for _, item := range items.schemas {
+			prefixItems = append(prefixItems, item)
+		}
+		schema.Set("prefixItems", prefixItems)
+		schema.Set("items", false)
+	default:
+		schema.Set("items", union(items.schemas))
+	}
+	if items.min > 0 {
+		schema.Set("minItems", items.min)
+	}
+	if items.max != -1 {
+		schema.Set("maxItems", items.max)
+	}
+	return schema
+}
+
+type itemCount struct {
+	schemas []*Object
+	min     int
+	max     int
+	// tuple is set when the items always occur in the same order.
+	tuple bool
+}
+
+func (inferrer *inferrer) countItems(nodes []*GBNFParser.Node) itemCount {
+	count := itemCount{tuple: true}
+	add := func(other itemCount) {
+		count.schemas = append(count.schemas, other.schemas...)
+		count.min += other.min
+		if count.max == -1 || other.max == -1 {
+			count.max = -1
+		} else {
+			count.max += other.max
+		}
+		count.tuple = count.tuple && other.tuple
+	}
+	single := func(schema *Object) {
+		add(itemCount{schemas: []*Object{schema}, min: 1, max: 1, tuple: true})
+	}
+
+	for _, node := range inferrer.significant(nodes) {
+		switch node.Type {
+		case GBNFParser.NodeToken:
+			if text, ok := literalText([]*GBNFParser.Node{node}); ok {
+				text = strings.Trim(text, whitespaceCharacters+",")
+				if text == "" {
+					continue
+				}
+				value, err := Decode([]byte(text))
+				if err != nil {
+					inferrer.report("cannot map `%s` in an array", GBNFParser.FormatExpression([]*GBNFParser.Node{node}))
+					single(NewObject())
+					continue
+				}
+				single(constSchema(value))
+				continue
+			}
+			single(inferrer.inferSequence([]*GBNFParser.Node{node}))
+		case GBNFParser.NodeSubExpression:
+			add(inferrer.countItems(node.Children))
+		case GBNFParser.NodeRepeat:
+			repeated := inferrer.countItems(node.Children)
+			repeated.min *= node.Min
+			if repeated.max != -1 && node.Max == -1 && repeated.max > 0 {
+				repeated.max = -1
+			} else if repeated.max != -1 {
+				repeated.max *= node.Max
+			}
+			repeated.tuple = false
+			add(repeated)
+		case GBNFParser.NodeAlternative:
+			branches := itemCount{min: -1}
+			for _, child := range node.Children {
+				branch := inferrer.countItems([]*GBNFParser.Node{child})
+				branches.schemas = append(branches.schemas, branch.schemas...)
+				if branches.min == -1 || branch.min < branches.min {
+					branches.min = branch.min
+				}
+				if branch.max == -1 || branches.max != -1 && branch.max > branches.max {
+					branches.max = branch.max
+				}
+			}
+			if branches.min == -1 {
+				branches.min = 0
+			}
+			add(branches)
+		}
+	}
+	return count
+}
+
+// objectPhase is the part of a JSON object an object parser expects next.
+type objectPhase int
+
+const (
+	objectStart objectPhase = iota
+	objectKey
+	objectInKey
+	objectColon
+	objectValue
+	objectEnd
+)
+
+type objectParser struct {
+	phase objectPhase
+	key   strings.Builder
+	// additionalKey is set when the key is not a literal.
+	additionalKey bool
+	// optional is set when the property being parsed may be left out.
+	optional bool
+	// valueParts holds the expression of the value being parsed, literal
+	// characters being collected in pending.
+	valueParts []*GBNFParser.Node
+	pending    strings.Builder
+	inString   bool
+	depth      int
+
+	properties *Object
+	required   []string
+	additional *Object
+	failure    string
+}
+
+// inferObject maps a sequence between braces to an object. Rules in key
+// position, such as the rules of llama.cpp for optional properties, are
+// inlined; properties in optional parts of the grammar are optional.
+func (inferrer *inferrer) inferObject(nodes []*GBNFParser.Node) *Object {
+	parser := &objectParser{properties: NewObject()}
+	inferrer.walkObject(parser, nodes, false)
+	if parser.failure == "" && parser.phase != objectEnd {
+		parser.failure = "the object is not closed"
+	}
+	if parser.failure != "" {
+		inferrer.report("cannot map object `%s`: %s", GBNFParser.FormatExpression(nodes), parser.failure)
+		return typeSchema("object")
+	}
+
+	schema := typeSchema("object")
+	if len(parser.properties.Keys) > 0 {
+		schema.Set("properties", parser.properties)
+	}
+	if len(parser.required) > 0 {
+		required := []any{}
+		for _, name := range parser.required {
+			required = append(required, name)
+		}
+		schema.Set("required", required)
+	}
+	if parser.additional == nil {
+		schema.Set("additionalProperties", false)
+	} else {
+		schema.Set("additionalProperties", parser.additional)
+	}
+	return schema
+}
+
+func (inferrer *inferrer) walkObject(parser *objectParser, nodes []*GBNFParser.Node, optional bool) {
+	for _, node := range inferrer.significant(nodes) {
+		if parser.failure != "" {
+			return
+		}
+
+		if text, ok := literalText([]*GBNFParser.Node{node}); ok {
+			for _, char := range text {
+				inferrer.objectCharacter(parser, char, optional)
+			}
+			continue
+		}
+
+		if parser.phase == objectValue && (len(parser.valueParts) > 0 || parser.pending.Len() > 0) {
+			// Optional properties follow a value in groups starting with a
+			// comma, which end the value.
+			if char, ok := inferrer.firstCharacter(node, map[string]bool{}); ok && !parser.inString && parser.depth == 0 && (char == ',' || char == '}') {
+				inferrer.endValue(parser)
+			}
+		}
+
+		switch parser.phase {
+		case objectInKey:
+			parser.additionalKey = true
+		case objectValue:
+			parser.flushPending()
+			parser.valueParts = append(parser.valueParts, node)
+		case objectKey:
+			switch node.Type {
+			case GBNFParser.NodeToken:
+				if node.Token.Type != GBNFParser.TokenIdentifier {
+					parser.failure = fmt.Sprintf("unexpected `%s` in place of a key", node.Token.Value)
+					return
+				}
+				name := node.Token.Value
+				rule, ok := inferrer.rules[name]
+				if !ok || inferrer.expanding[name] {
+					parser.failure = fmt.Sprintf("cannot inline rule `%s`", name)
+					return
+				}
+				inferrer.expanding[name] = true
+				inferrer.walkObject(parser, rule.Children, optional)
+				delete(inferrer.expanding, name)
+			case GBNFParser.NodeSubExpression:
+				inferrer.walkObject(parser, node.Children, optional)
+			case GBNFParser.NodeRepeat:
+				inferrer.walkObject(parser, node.Children, optional || node.Min == 0)
+			case GBNFParser.NodeAlternative:
+				for _, child := range node.Children {
+					inferrer.walkObject(parser, []*GBNFParser.Node{child}, true)
+					if parser.phase == objectValue && (len(parser.valueParts) > 0 || parser.pending.Len() > 0) {
+						// Each alternative ends with a complete property.
+						inferrer.endValue(parser)
+					}
+				}
+			}
+		default:
+			parser.failure = fmt.Sprintf("unexpected `%s`", GBNFParser.FormatExpression([]*GBNFParser.Node{node}))
+		}
+	}
+}
+
+func (inferrer *inferrer) objectCharacter(parser *objectParser, char rune, optional bool) {
+	if parser.failure != "" {
+		return
+	}
+	if parser.phase == objectValue {
+		switch {
+		case parser.inString:
+			if char == '"' {
+				parser.inString = false
+			}
+		case char == '"':
+			parser.inString = true
+		case char == '{' || char == '[':
+			parser.depth++
+		case (char == '}' || char == ']') && parser.depth > 0:
+			parser.depth--
+		case parser.depth == 0 && (char == ',' || char == '}'):
+			inferrer.endValue(parser)
+			inferrer.objectCharacter(parser, char, optional)
+			return
+		}
+		parser.pending.WriteRune(char)
+		return
+	}
+
+	if parser.phase == objectInKey {
+		if char == '"' {
+			parser.phase = objectColon
+		} else {
+			parser.key.WriteRune(char)
+		}
+		return
+	}
+
+	if strings.ContainsRune(whitespaceCharacters, char) {
+		return
+	}
+	switch {
+	case parser.phase == objectStart && char == '{':
+		parser.phase = objectKey
+	case parser.phase == objectKey && char == '"':
+		parser.phase = objectInKey
+		parser.key.Reset()
+		parser.additionalKey = false
+		parser.optional = optional
+	case parser.phase == objectKey && char == ',':
+	case parser.phase == objectKey && char == '}':
+		parser.phase = objectEnd
+	case parser.phase == objectColon && char == ':':
+		parser.phase = objectValue
+	default:
+		parser.failure = fmt.Sprintf("unexpected %q", char)
+	}
+}
+
+func (parser *objectParser) flushPending() {
+	if parser.pending.Len() == 0 {
+		return
+	}
+	parser.valueParts = append(parser.valueParts, &GBNFParser.Node{
+		Type:  GBNFParser.NodeToken,
+		Token: &GBNFParser.Token{Type: GBNFParser.TokenString, Value: GBNFParser.StringValue(parser.pending.String())},
+		Min:   1,
+		Max:   1,
+	})
+	parser.pending.Reset()
+}
+
+// endValue adds the property whose value has been collected.
+func (inferrer *inferrer) endValue(parser *objectParser) {
+	parser.flushPending()
+	value := inferrer.inferSequence(parser.valueParts)
+	parser.valueParts = nil
+	parser.phase = objectKey
+
+	if parser.additionalKey {
+		if parser.additional == nil {
+			parser.additional = value
+		} else {
+			parser.additional = union([]*Object{parser.additional, value})
+		}
+		return
+	}
+
+	key := parser.key.String()
+	if existing, ok := parser.properties.Get(key); ok {
+		value = union([]*Object{existing.(*Object), value})
+	}
+	parser.properties.Set(key, value)
+	if !parser.optional {
+		for _, name := range parser.required {
+			if name == key {
+				return
+			}
+		}
+		parser.required = append(parser.required, key)
+	}
+}
+
+// firstCharacter returns the first literal character node can match.
+func (inferrer *inferrer) firstCharacter(node *GBNFParser.Node, visited map[string]bool) (rune, bool) {
+	switch node.Type {
+	case GBNFParser.NodeToken:
+		if text, ok := literalText([]*GBNFParser.Node{node}); ok {
+			text = strings.TrimLeft(text, whitespaceCharacters)
+			if text == "" {
+				return 0, false
+			}
+			return []rune(text)[0], true
+		}
+		rule, ok := inferrer.rules[node.Token.Value]
+		if node.Token.Type != GBNFParser.TokenIdentifier || !ok || visited[node.Token.Value] {
+			return 0, false
+		}
+		visited[node.Token.Value] = true
+		return inferrer.firstCharacterOf(rule.Children, visited)
+	case GBNFParser.NodeSubExpression, GBNFParser.NodeRepeat:
+		return inferrer.firstCharacterOf(node.Children, visited)
+	case GBNFParser.NodeAlternative:
+		for _, child := range node.Children {
+			if char, ok := inferrer.firstCharacter(child, visited); ok {
+				return char, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (inferrer *inferrer) firstCharacterOf(nodes []*GBNFParser.Node, visited map[string]bool) (rune, bool) {
+	nodes = inferrer.significant(nodes)
+	if len(nodes) == 0 {
+		return 0, false
+	}
+	return inferrer.firstCharacter(nodes[0], visited)
+}
+
+// characters returns the characters nodes can match, if there are few.
+func (inferrer *inferrer) characters(nodes []*GBNFParser.Node, visited map[string]bool) (map[rune]bool, bool) {
+	chars := map[rune]bool{}
+	for _, node := range nodes {
+		switch node.Type {
+		case GBNFParser.NodeToken:
+			switch node.Token.Type {
+			case GBNFParser.TokenString:
+				text, ok := literalText([]*GBNFParser.Node{node})
+				if !ok {
+					return nil, false
+				}
+				for _, char := range text {
+					chars[char] = true
+				}
+			case GBNFParser.TokenRegexp:
+				ranges, negated, err := GBNFParser.ParseCharClass(node.Token.Value)
+				if err != nil || negated {
+					return nil, false
+				}
+				for _, charRange := range ranges {
+					if charRange.High-charRange.Low > 64 {
+						return nil, false
+					}
+					for char := charRange.Low; char <= charRange.High; char++ {
+						chars[char] = true
+					}
+				}
+			case GBNFParser.TokenIdentifier:
+				rule, ok := inferrer.rules[node.Token.Value]
+				if !ok {
+					return nil, false
+				}
+				if visited[node.Token.Value] {
+					continue
+				}
+				visited[node.Token.Value] = true
+				ruleChars, ok := inferrer.characters(rule.Children, visited)
+				if !ok {
+					return nil, false
+				}
+				for char := range ruleChars {
+					chars[char] = true
+				}
+			}
+		case GBNFParser.NodeSubExpression, GBNFParser.NodeRepeat, GBNFParser.NodeAlternative:
+			childChars, ok := inferrer.characters(node.Children, visited)
+			if !ok {
+				return nil, false
+			}
+			for char := range childChars {
+				chars[char] = true
+			}
+		}
+	}
+	return chars, true
+}
+
+func isNumeric(chars map[rune]bool) bool {
+	hasDigit := false
+	for char := range chars {
+		if !strings.ContainsRune(numberCharacters, char) {
+			return false
+		}
+		hasDigit = hasDigit || '0' <= char && char <= '9'
+	}
+	return hasDigit
+}
+
+// significant drops the nodes that only match whitespace.
+func (inferrer *inferrer) significant(nodes []*GBNFParser.Node) []*GBNFParser.Node {
+	result := []*GBNFParser.Node{}
+	for _, node := range nodes {
+		if !inferrer.isWhitespace([]*GBNFParser.Node{node}) {
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
+// isWhitespace reports whether nodes only match whitespace, like the `ws`
+// and `space` rules of JSON grammars.
+func (inferrer *inferrer) isWhitespace(nodes []*GBNFParser.Node) bool {
+	for _, node := range nodes {
+		switch node.Type {
+		case GBNFParser.NodeToken:
+			switch node.Token.Type {
+			case GBNFParser.TokenString:
+				text, ok := literalText([]*GBNFParser.Node{node})
+				if !ok || strings.Trim(text, whitespaceCharacters) != "" {
+					return false
+				}
+			case GBNFParser.TokenRegexp:
+				ranges, negated, err := GBNFParser.ParseCharClass(node.Token.Value)
+				if err != nil || negated {
+					return false
+				}
+				for _, charRange := range ranges {
+					for char := charRange.Low; char <= charRange.High; char++ {
+						if !strings.ContainsRune(whitespaceCharacters, char) {
+							return false
+						}
+					}
+				}
+			case GBNFParser.TokenIdentifier:
+				if !inferrer.isWhitespaceRule(node.Token.Value) {
+					return false
+				}
+			}
+		case GBNFParser.NodeSubExpression, GBNFParser.NodeRepeat, GBNFParser.NodeAlternative:
+			if !inferrer.isWhitespace(node.Children) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (inferrer *inferrer) isWhitespaceRule(name string) bool {
+	if whitespace, ok := inferrer.whitespace[name]; ok {
+		return whitespace
+	}
+	rule, ok := inferrer.rules[name]
+	if !ok {
+		return false
+	}
+	// Assume recursive references are whitespace; the rule decides.
+	inferrer.whitespace[name] = true
+	inferrer.whitespace[name] = inferrer.isWhitespace(rule.Children)
+	return inferrer.whitespace[name]
+}
+
+// literalText returns the text matched by nodes if they are all literals.
+func literalText(nodes []*GBNFParser.Node) (string, bool) {
+	var builder strings.Builder
+	for _, node := range nodes {
+		if node.Type != GBNFParser.NodeToken || node.Token.Type != GBNFParser.TokenString {
+			return "", false
+		}
+		text, err := GBNFParser.UnescapeString(node.Token.Value)
+		if err != nil {
+			return "", false
+		}
+		builder.WriteString(text)
+	}
+	return builder.String(), true
+}
+
+func typeSchema(name string) *Object {
+	schema := NewObject()
+	schema.Set("type", name)
+	return schema
+}
+
+func refSchema(name string) *Object {
+	schema := NewObject()
+	schema.Set("$ref", "#/$defs/"+name)
+	return schema
+}
+
+func constSchema(value any) *Object {
+	if value == nil {
+		return typeSchema("null")
+	}
+	schema := NewObject()
+	schema.Set("const", value)
+	return schema
+}
+
+// union returns a schema accepting the values of any of schemas, merging
+// constants into an enum.
+func union(schemas []*Object) *Object {
+	distinct := []*Object{}
+	seen := map[string]bool{}
+	for _, schema := range schemas {
+		if anyOf, ok := schema.Get("anyOf"); ok && len(schema.Keys) == 1 {
+			for _, alternative := range anyOf.([]any) {
+				distinct = append(distinct, alternative.(*Object))
+			}
+			continue
+		}
+		distinct = append(distinct, schema)
+	}
+	schemas, distinct = distinct, []*Object{}
+	for _, schema := range schemas {
+		if encoded := Encode(schema); !seen[encoded] {
+			seen[encoded] = true
+			distinct = append(distinct, schema)
+		}
+	}
+	if seen[`{"const":true}`] && seen[`{"const":false}`] {
+		schemas, distinct = distinct, []*Object{}
+		for _, schema := range schemas {
+			if encoded := Encode(schema); encoded != `{"const":true}` && encoded != `{"const":false}` {
+				distinct = append(distinct, schema)
+			}
+		}
+		distinct = append(distinct, typeSchema("boolean"))
+	}
+
+	switch {
+	case len(distinct) == 0:
+		return NewObject()
+	case len(distinct) == 1:
+		return distinct[0]
+	case seen["{}"]:
+		return NewObject()
+	}
+
+	values := []any{}
+	types := map[string]bool{}
+	for _, schema := range distinct {
+		if value, ok := schema.Get("const"); ok && len(schema.Keys) == 1 {
+			values = append(values, value)
+		}
+		if schemaType, ok := schema.Get("type"); ok && onlyConstrainsType(schema) {
+			types[schemaType.(string)] = true
+		}
+	}
+	if len(values) == len(distinct) {
+		schema := NewObject()
+		schema.Set("enum", values)
+		return schema
+	}
+	if len(types) == len(jsonTypes) {
+		anyType := true
+		for _, name := range jsonTypes {
+			anyType = anyType && types[name]
+		}
+		if anyType {
+			return NewObject()
+		}
+	}
+
+	alternatives := []any{}
+	for _, schema := range distinct {
+		alternatives = append(alternatives, schema)
+	}
+	schema := NewObject()
+	schema.Set("anyOf", alternatives)
+	return schema
+}
+
+func allEqual(schemas []*Object) bool {
+	for _, schema := range schemas {
+		if Encode(schema) != Encode(schemas[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+// onlyConstrainsType reports whether schema accepts any value of its type.
+// Object and array contents that refer to other rules are assumed to accept
+// any value, as in the recursive `value` rule of JSON grammars.
+func onlyConstrainsType(schema *Object) bool {
+	for _, key := range schema.Keys {
+		switch key {
+		case "type":
+		case "additionalProperties", "items":
+			content, ok := schema.Values[key].(*Object)
+			if !ok {
+				return false
+			}
+			if _, isRef := content.Get("$ref"); len(content.Keys) > 0 && !(isRef && len(content.Keys) == 1) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// simplify drops keywords that do not constrain anything, such as
+// `"additionalProperties": {}`, and replaces references to the definitions
+// in anyValue by {}.
+func simplify(value any, anyValue map[string]bool) any {
+	switch value := value.(type) {
+	case *Object:
+		if ref, ok := value.Get("$ref"); ok && len(value.Keys) == 1 && anyValue[ref.(string)] {
+			return NewObject()
+		}
+		for _, key := range value.Keys {
+			value.Values[key] = simplify(value.Values[key], anyValue)
+		}
+		simplified := NewObject()
+		for _, key := range value.Keys {
+			child := value.Values[key]
+			if object, ok := child.(*Object); ok && len(object.Keys) == 0 && (key == "additionalProperties" || key == "items") {
+				continue
+			}
+			simplified.Set(key, child)
+		}
+		return simplified
+	case []any:
+		for index, item := range value {
+			value[index] = simplify(item, anyValue)
+		}
+		return value
+	default:
+		return value
+	}
+}
@@ -0,0 +1,131 @@
+package JSONSchema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Object is a decoded JSON object that remembers the order of its keys, as
+// the order of properties in a schema is the order they are generated in.
+type Object struct {
+	Keys   []string
+	Values map[string]any
+}
+
+func (object *Object) Get(key string) (any, bool) {
+	value, ok := object.Values[key]
+	return value, ok
+}
+
+// Set adds or replaces the value of key, keeping the position of an
+// existing key.
+func (object *Object) Set(key string, value any) {
+	if _, ok := object.Values[key]; !ok {
+		object.Keys = append(object.Keys, key)
+	}
+	object.Values[key] = value
+}
+
+// NewObject creates an empty object.
+func NewObject() *Object {
+	return &Object{Values: map[string]any{}}
+}
+
+// Decode parses JSON into nil, bool, json.Number, string, []any and *Object
+// values.
+func Decode(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	value, err := decodeValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return value, nil
+}
+
+func decodeValue(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := &Object{Values: map[string]any{}}
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := keyToken.(string)
+			value, err := decodeValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := object.Values[key]; !ok {
+				object.Keys = append(object.Keys, key)
+			}
+			object.Values[key] = value
+		}
+		_, err := decoder.Token()
+		return object, err
+	case json.Delim('['):
+		array := []any{}
+		for decoder.More() {
+			value, err := decodeValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err := decoder.Token()
+		return array, err
+	default:
+		return token, nil
+	}
+}
+
+// Encode serialises a decoded value as compact JSON, keeping the key order of
+// objects.
+func Encode(value any) string {
+	switch value := value.(type) {
+	case *Object:
+		parts := []string{}
+		for _, key := range value.Keys {
+			parts = append(parts, Encode(key)+":"+Encode(value.Values[key]))
+		}
+		return "{" + strings.Join(parts, ",") + "}"
+	case []any:
+		parts := []string{}
+		for _, item := range value {
+			parts = append(parts, Encode(item))
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	case json.Number:
+		return value.String()
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		var buffer bytes.Buffer
+		encoder := json.NewEncoder(&buffer)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(value)
+		return strings.TrimSuffix(buffer.String(), "\n")
+	}
+}
+
+// Pretty serialises a decoded value as indented JSON.
+func Pretty(value any) string {
+	var buffer bytes.Buffer
+	json.Indent(&buffer, []byte(Encode(value)), "", "  ")
+	return buffer.String() + "\n"
+}
@@ -0,0 +1,578 @@
+package JSONSchema
+
+import (
+	"encoding/json"
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/Matcher"
+	"gbnflsp/gbnf-engine/Regex"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type primitiveRule struct {
+	body         string
+	dependencies []string
+}
+
+// primitiveRules are the building blocks of converted schemas. They match the
+// rules emitted by llama.cpp's json_schema_to_grammar, so grammars from both
+// tools read the same.
+var primitiveRules = map[string]primitiveRule{
+	"space":            {`| " " | "\n"{1,2} [ \t]{0,20}`, nil},
+	"boolean":          {`("true" | "false") space`, []string{"space"}},
+	"decimal-part":     {`[0-9]{1,16}`, nil},
+	"integral-part":    {`[0] | [1-9] [0-9]{0,15}`, nil},
+	"number":           {`("-"? integral-part) ("." decimal-part)? ([eE] [-+]? integral-part)? space`, []string{"integral-part", "decimal-part", "space"}},
+	"integer":          {`("-"? integral-part) space`, []string{"integral-part", "space"}},
+	"value":            {`object | array | string | number | boolean | null`, []string{"object", "array", "string", "number", "boolean", "null"}},
+	"object":           {`"{" space ( string ":" space value ("," space string ":" space value)* )? "}" space`, []string{"string", "value", "space"}},
+	"array":            {`"[" space ( value ("," space value)* )? "]" space`, []string{"value", "space"}},
+	"char":             {`[^"\\\x7F\x00-\x1F] | [\\] (["\\bfnrt] | "u" [0-9a-fA-F]{4})`, nil},
+	"string":           {`"\"" char* "\"" space`, []string{"char", "space"}},
+	"null":             {`"null" space`, []string{"space"}},
+	"uuid":             {`"\"" [0-9a-fA-F]{8} "-" [0-9a-fA-F]{4} "-" [0-9a-fA-F]{4} "-" [0-9a-fA-F]{4} "-" [0-9a-fA-F]{12} "\"" space`, []string{"space"}},
+	"date":             {`[0-9]{4} "-" ("0" [1-9] | "1" [0-2]) "-" ("0" [1-9] | [1-2] [0-9] | "3" [0-1])`, nil},
+	"time":             {`([01] [0-9] | "2" [0-3]) ":" [0-5] [0-9] ":" [0-5] [0-9] ("." [0-9]{3})? ("Z" | ("+" | "-") ([01] [0-9] | "2" [0-3]) ":" [0-5] [0-9])`, nil},
+	"date-time":        {`date "T" time`, []string{"date", "time"}},
+	"date-string":      {`"\"" date "\"" space`, []string{"date", "space"}},
+	"time-string":      {`"\"" time "\"" space`, []string{"time", "space"}},
+	"date-time-string": {`"\"" date-time "\"" space`, []string{"date-time", "space"}},
+}
+
+// PrimitiveRuleNames lists the rules converted schemas build on, such as
+// `string` and `number`, in alphabetical order.
+func PrimitiveRuleNames() []string {
+	names := make([]string, 0, len(primitiveRules))
+	for name := range primitiveRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PrimitiveRule returns the body of the primitive rule name and the
+// primitives it refers to.
+func PrimitiveRule(name string) (string, []string, bool) {
+	primitive, ok := primitiveRules[name]
+	return primitive.body, primitive.dependencies, ok
+}
+
+// stringFormats maps supported values of the `format` keyword to rules.
+var stringFormats = map[string]string{
+	"uuid":      "uuid",
+	"date":      "date-string",
+	"time":      "time-string",
+	"date-time": "date-time-string",
+}
+
+// unsupportedKeywords change which documents a schema accepts but cannot be
+// expressed in a grammar.
+var unsupportedKeywords = []string{
+	"allOf", "not", "if", "then", "else", "patternProperties", "propertyNames",
+	"dependentRequired", "dependentSchemas", "dependencies", "uniqueItems",
+	"contains", "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum",
+	"multipleOf", "minProperties", "maxProperties",
+}
+
+var invalidRuleCharacters = regexp.MustCompile(`[^a-zA-Z0-9-]+`)
+
+type converter struct {
+	document any
+	rules    map[string]string
+	// reserved holds rule names promised to a $ref before its rule exists,
+	// so recursive references can use them.
+	reserved map[string]bool
+	refs     map[string]string
+	warnings []string
+	err      error
+}
+
+// Convert turns a JSON Schema into a GBNF grammar whose `root` rule accepts
+// the JSON documents valid under the schema. Keywords that cannot be
+// expressed are returned as warnings; the grammar then accepts more
+// documents than the schema does.
+func Convert(data []byte) (string, []string, error) {
+	document, err := Decode(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	converter := &converter{
+		document: document,
+		rules:    map[string]string{},
+		reserved: map[string]bool{},
+		refs:     map[string]string{},
+	}
+	if rootRule := converter.visit(document, "root"); rootRule != "root" {
+		converter.rules["root"] = rootRule
+	}
+	if converter.err != nil {
+		return "", converter.warnings, converter.err
+	}
+
+	grammar := converter.format()
+	file := GBNFParser.ParseGrammarFile("", grammar)
+	if len(file.Errors) > 0 {
+		return "", converter.warnings, fmt.Errorf("generated an invalid grammar: %s", file.Errors[0].Message)
+	}
+	if _, err := Matcher.Compile(file.AST); err != nil {
+		return "", converter.warnings, fmt.Errorf("generated an invalid grammar: %w", err)
+	}
+	return grammar, converter.warnings, nil
+}
+
+// format prints the rules, root first and the others sorted by name.
+func (converter *converter) format() string {
+	names := []string{}
+	for name := range converter.rules {
+		if name != "root" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	for _, name := range append([]string{"root"}, names...) {
+		builder.WriteString(name + " ::= " + converter.rules[name] + "\n")
+	}
+	return builder.String()
+}
+
+func (converter *converter) warn(format string, args ...any) {
+	converter.warnings = append(converter.warnings, fmt.Sprintf(format, args...))
+}
+
+func (converter *converter) fail(format string, args ...any) string {
+	if converter.err == nil {
+		converter.err = fmt.Errorf(format, args...)
+	}
+	return converter.addPrimitive("value")
+}
+
+// addRule adds a rule and returns its name. A different rule with the same
+// name gets a numeric suffix; an identical rule is shared.
+func (converter *converter) addRule(name string, body string) string {
+	name = ruleName(name)
+	if converter.reserved[name] {
+		delete(converter.reserved, name)
+		converter.rules[name] = body
+		return name
+	}
+
+	key := name
+	if existing, ok := converter.rules[key]; ok && existing != body {
+		for index := 0; ; index++ {
+			key = fmt.Sprintf("%s%d", name, index)
+			if existing, ok := converter.rules[key]; !ok || existing == body {
+				break
+			}
+		}
+	}
+	converter.rules[key] = body
+	return key
+}
+
+// reserve claims a unique rule name whose body is added later.
+func (converter *converter) reserve(name string) string {
+	name = ruleName(name)
+	key := name
+	for index := 0; ; index++ {
+		if _, ok := converter.rules[key]; !ok && !converter.reserved[key] {
+			break
+		}
+		key = fmt.Sprintf("%s%d", name, index)
+	}
+	converter.reserved[key] = true
+	return key
+}
+
+func (converter *converter) addPrimitive(name string) string {
+	if _, ok := converter.rules[name]; ok {
+		return name
+	}
+	primitive := primitiveRules[name]
+	converter.rules[name] = primitive.body
+	for _, dependency := range primitive.dependencies {
+		converter.addPrimitive(dependency)
+	}
+	return name
+}
+
+// ruleName turns text into a valid rule name.
+func ruleName(text string) string {
+	name := strings.Trim(invalidRuleCharacters.ReplaceAllString(text, "-"), "-")
+	if name == "" || !('a' <= name[0] && name[0] <= 'z' || 'A' <= name[0] && name[0] <= 'Z') {
+		name = "r-" + name
+	}
+	return name
+}
+
+// visit returns the name of a rule accepting the documents valid under
+// schema, adding it as name if a new rule is needed.
+func (converter *converter) visit(schema any, name string) string {
+	switch schema := schema.(type) {
+	case bool:
+		if !schema {
+			return converter.fail("schema `false` at %s accepts no documents", name)
+		}
+		return converter.addPrimitive("value")
+	case *Object:
+		return converter.visitObject(schema, name)
+	default:
+		return converter.fail("invalid schema at %s: %s", name, Encode(schema))
+	}
+}
+
+func (converter *converter) visitObject(schema *Object, name string) string {
+	for _, keyword := range unsupportedKeywords {
+		if _, ok := schema.Get(keyword); ok {
+			converter.warn("%s: `%s` is not supported and is ignored", name, keyword)
+		}
+	}
+
+	if ref, ok := schema.Get("$ref"); ok {
+		return converter.resolveRef(fmt.Sprint(ref), name)
+	}
+	for _, keyword := range []string{"anyOf", "oneOf"} {
+		if alternatives, ok := schema.Get(keyword); ok {
+			return converter.visitUnion(alternatives, name)
+		}
+	}
+	if value, ok := schema.Get("const"); ok {
+		converter.addPrimitive("space")
+		return converter.addRule(name, GBNFParser.QuoteLiteral(Encode(value))+" space")
+	}
+	if values, ok := schema.Get("enum"); ok {
+		literals := []string{}
+		for _, value := range asArray(values) {
+			literals = append(literals, GBNFParser.QuoteLiteral(Encode(value)))
+		}
+		converter.addPrimitive("space")
+		return converter.addRule(name, "("+strings.Join(literals, " | ")+") space")
+	}
+
+	schemaType, _ := schema.Get("type")
+	if types, ok := schemaType.([]any); ok {
+		// A list of types is a union of the schema restricted to each type.
+		alternatives := []any{}
+		for _, singleType := range types {
+			restricted := &Object{Keys: schema.Keys, Values: map[string]any{}}
+			for key, value := range schema.Values {
+				restricted.Values[key] = value
+			}
+			restricted.Values["type"] = singleType
+			alternatives = append(alternatives, restricted)
+		}
+		return converter.visitUnion(alternatives, name)
+	}
+
+	_, hasProperties := schema.Get("properties")
+	_, hasAdditional := schema.Get("additionalProperties")
+	_, hasItems := schema.Get("items")
+	_, hasPrefixItems := schema.Get("prefixItems")
+	switch {
+	case schemaType == "object" || schemaType == nil && (hasProperties || hasAdditional):
+		return converter.visitObjectType(schema, name)
+	case schemaType == "array" || schemaType == nil && (hasItems || hasPrefixItems):
+		return converter.visitArrayType(schema, name)
+	case schemaType == "string":
+		return converter.visitStringType(schema, name)
+	case schemaType == "number" || schemaType == "integer" || schemaType == "boolean" || schemaType == "null":
+		return converter.addPrimitive(schemaType.(string))
+	case schemaType == nil:
+		return converter.addPrimitive("value")
+	default:
+		return converter.fail("%s: unknown type %s", name, Encode(schemaType))
+	}
+}
+
+func (converter *converter) visitUnion(alternatives any, name string) string {
+	names := []string{}
+	for index, alternative := range asArray(alternatives) {
+		names = append(names, converter.visit(alternative, fmt.Sprintf("%s-%d", name, index)))
+	}
+	return converter.addRule(name, strings.Join(names, " | "))
+}
+
+func (converter *converter) resolveRef(ref string, name string) string {
+	if ruleName, ok := converter.refs[ref]; ok {
+		return ruleName
+	}
+	if !strings.HasPrefix(ref, "#") {
+		return converter.fail("%s: only references within the schema are supported, got %s", name, ref)
+	}
+	target, ok := resolvePointer(converter.document, ref[1:])
+	if !ok {
+		return converter.fail("%s: cannot resolve $ref %s", name, ref)
+	}
+
+	if ref == "#" {
+		if name == "root" {
+			return converter.fail("root: the schema refers only to itself")
+		}
+		// The whole document is the root rule, which is always generated.
+		converter.refs[ref] = "root"
+		return "root"
+	}
+
+	segments := strings.Split(ref, "/")
+	reserved := converter.reserve(segments[len(segments)-1])
+	converter.refs[ref] = reserved
+
+	if ruleName := converter.visit(target, reserved); ruleName != reserved {
+		// The schema is a primitive or an existing rule; alias it.
+		converter.addRule(reserved, ruleName)
+	}
+	return reserved
+}
+
+// resolvePointer follows a JSON pointer such as /$defs/address.
+func resolvePointer(document any, pointer string) (any, bool) {
+	if decoded, err := url.PathUnescape(pointer); err == nil {
+		pointer = decoded
+	}
+	current := document
+	for _, segment := range strings.Split(pointer, "/")[1:] {
+		segment = strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+		switch value := current.(type) {
+		case *Object:
+			next, ok := value.Get(segment)
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, false
+			}
+			current = value[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func (converter *converter) visitObjectType(schema *Object, name string) string {
+	properties, _ := schema.Get("properties")
+	propertyObject, _ := properties.(*Object)
+	additional, hasAdditional := schema.Get("additionalProperties")
+	if propertyObject == nil && !hasAdditional {
+		return converter.addPrimitive("object")
+	}
+	if propertyObject == nil {
+		propertyObject = &Object{Values: map[string]any{}}
+	}
+
+	required := map[string]bool{}
+	requiredValue, _ := schema.Get("required")
+	for _, property := range asArray(requiredValue) {
+		required[fmt.Sprint(property)] = true
+	}
+
+	converter.addPrimitive("space")
+	keyValueRules := map[string]string{}
+	requiredProperties, optionalProperties := []string{}, []string{}
+	for _, property := range propertyObject.Keys {
+		propertyRule := converter.visit(propertyObject.Values[property], name+"-"+property)
+		key := GBNFParser.QuoteLiteral(Encode(property))
+		keyValueRules[property] = converter.addRule(name+"-"+property+"-kv", key+` space ":" space `+propertyRule)
+		if required[property] {
+			requiredProperties = append(requiredProperties, property)
+		} else {
+			optionalProperties = append(optionalProperties, property)
+		}
+	}
+
+	if hasAdditional && additional != false {
+		var valueRule string
+		if additional == true {
+			valueRule = converter.addPrimitive("value")
+		} else {
+			valueRule = converter.visit(additional, name+"-additional-value")
+		}
+		keyValueRules["*"] = converter.addRule(name+"-additional-kv", converter.addPrimitive("string")+` ":" space `+valueRule)
+		optionalProperties = append(optionalProperties, "*")
+	}
+
+	requiredRules := []string{}
+	for _, property := range requiredProperties {
+		requiredRules = append(requiredRules, keyValueRules[property])
+	}
+	body := `"{" space`
+	if len(requiredRules) > 0 {
+		body += " " + strings.Join(requiredRules, ` "," space `)
+	}
+
+	if len(optionalProperties) > 0 {
+		// Optional properties may be left out but keep their order, which
+		// takes a rule per property for the properties that may follow it.
+		var optionalRefs func(properties []string, firstIsOptional bool) string
+		optionalRefs = func(properties []string, firstIsOptional bool) string {
+			property, rest := properties[0], properties[1:]
+			keyValueRule := keyValueRules[property]
+			commaRef := `( "," space ` + keyValueRule + ` )`
+			var result string
+			switch {
+			case firstIsOptional && property == "*":
+				result = commaRef + "*"
+			case firstIsOptional:
+				result = commaRef + "?"
+			case property == "*":
+				result = keyValueRule + " " + commaRef + "*"
+			default:
+				result = keyValueRule
+			}
+			if len(rest) > 0 {
+				result += " " + converter.addRule(name+"-"+property+"-rest", optionalRefs(rest, true))
+			}
+			return result
+		}
+
+		alternatives := []string{}
+		for index := range optionalProperties {
+			alternatives = append(alternatives, optionalRefs(optionalProperties[index:], false))
+		}
+		body += " ("
+		if len(requiredProperties) > 0 {
+			body += ` "," space ( ` + strings.Join(alternatives, " | ") + " )"
+		} else {
+			body += " " + strings.Join(alternatives, " | ")
+		}
+		body += " )?"
+	}
+	body += ` "}" space`
+	return converter.addRule(name, body)
+}
+
+func (converter *converter) visitArrayType(schema *Object, name string) string {
+	converter.addPrimitive("space")
+
+	items, _ := schema.Get("items")
+	tuple, isTuple := items.([]any)
+	if prefixItems, ok := schema.Get("prefixItems"); ok {
+		tuple, isTuple = asArray(prefixItems), true
+	}
+	if isTuple {
+		itemRules := []string{}
+		for index, item := range tuple {
+			itemRules = append(itemRules, converter.visit(item, fmt.Sprintf("%s-tuple-%d", name, index)))
+		}
+		return converter.addRule(name, `"[" space `+strings.Join(itemRules, ` "," space `)+` "]" space`)
+	}
+
+	if items == nil {
+		items = true
+	}
+	itemRule := converter.visit(items, name+"-item")
+	minItems, maxItems := integerKeyword(schema, "minItems", 0), integerKeyword(schema, "maxItems", -1)
+	return converter.addRule(name, `"[" space `+buildRepetition(itemRule, minItems, maxItems, `"," space`)+` "]" space`)
+}
+
+func (converter *converter) visitStringType(schema *Object, name string) string {
+	if pattern, ok := schema.Get("pattern"); ok {
+		// The rules of named groups are reserved as they are named, so the
+		// references to them need no renaming.
+		reserved := []string{}
+		rules, err := Regex.Translate(fmt.Sprint(pattern), Regex.Options{
+			Name:    ruleName(name),
+			AnyChar: "char",
+			RuleName: func(name string) string {
+				name = converter.reserve(name)
+				reserved = append(reserved, name)
+				return name
+			},
+		})
+		if err == nil {
+			converter.addPrimitive("char")
+			converter.addPrimitive("space")
+			for _, rule := range rules[1:] {
+				converter.addRule(rule.Name, rule.Expression)
+			}
+			return converter.addRule(name, `"\"" `+rules[0].Expression+` "\"" space`)
+		}
+		for _, name := range reserved {
+			delete(converter.reserved, name)
+		}
+		converter.warn("%s: pattern %q is not supported and is ignored: %v", name, pattern, err)
+	}
+
+	if format, ok := schema.Get("format"); ok {
+		if rule, ok := stringFormats[fmt.Sprint(format)]; ok {
+			return converter.addPrimitive(rule)
+		}
+		converter.warn("%s: format %q is not supported and is ignored", name, format)
+	}
+
+	minLength, maxLength := integerKeyword(schema, "minLength", 0), integerKeyword(schema, "maxLength", -1)
+	if minLength == 0 && maxLength == -1 {
+		return converter.addPrimitive("string")
+	}
+	converter.addPrimitive("char")
+	converter.addPrimitive("space")
+	return converter.addRule(name, `"\"" `+buildRepetition("char", minLength, maxLength, "")+` "\"" space`)
+}
+
+// buildRepetition repeats item between min and max times, -1 meaning
+// unbounded, with separator between the repetitions.
+func buildRepetition(item string, min int, max int, separator string) string {
+	if max == 0 {
+		return ""
+	}
+	if min == 0 && max == 1 {
+		return item + "?"
+	}
+	if separator == "" {
+		switch {
+		case min == 1 && max == -1:
+			return item + "+"
+		case min == 0 && max == -1:
+			return item + "*"
+		case max == -1:
+			return fmt.Sprintf("%s{%d,}", item, min)
+		case min == max:
+			return fmt.Sprintf("%s{%d}", item, min)
+		default:
+			return fmt.Sprintf("%s{%d,%d}", item, min, max)
+		}
+	}
+
+	restMin, restMax := min-1, max-1
+	if restMin < 0 {
+		restMin = 0
+	}
+	if max == -1 {
+		restMax = -1
+	}
+	result := item + " " + buildRepetition("("+separator+" "+item+")", restMin, restMax, "")
+	if min == 0 {
+		return "(" + result + ")?"
+	}
+	return result
+}
+
+func integerKeyword(schema *Object, keyword string, fallback int) int {
+	value, ok := schema.Get(keyword)
+	if !ok {
+		return fallback
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return fallback
+	}
+	integer, err := strconv.Atoi(number.String())
+	if err != nil {
+		return fallback
+	}
+	return integer
+}
+
+func asArray(value any) []any {
+	array, _ := value.([]any)
+	return array
+}
@@ -0,0 +1,68 @@
+package Matcher
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"strings"
+)
+
+// Expansion is how llama.cpp rewrites a repeat when it loads a grammar.
+type Expansion struct {
+	// Expression replaces the repeat in its rule. It is empty if the repeat
+	// matches nothing but the empty string.
+	Expression string
+	// Rules are the helper rules the expansion adds, in the order llama.cpp
+	// creates them, up to the limit passed to ExpandRepeat.
+	Rules []string
+	// RuleCount is the number of helper rules, including those left out of
+	// Rules.
+	RuleCount int
+}
+
+// ExpandRepeat rewrites a repeat of the declaration rule as llama.cpp does:
+// `x{m,n}` becomes m copies of x followed by a chain of n-m optional rules,
+// `x{m,}` becomes m copies followed by `h ::= x h |`, and a group is moved
+// into a rule of its own first. Helper rules are named `rule_1`, `rule_2` and
+// so on; llama.cpp numbers them across the whole grammar instead. At most
+// limit rules are printed.
+func ExpandRepeat(rule string, repeat *GBNFParser.Node, limit int) Expansion {
+	expansion := Expansion{}
+	addRule := func(body string) string {
+		expansion.RuleCount++
+		name := fmt.Sprintf("%s_%d", rule, expansion.RuleCount)
+		if len(expansion.Rules) < limit {
+			expansion.Rules = append(expansion.Rules, strings.TrimSpace(name+" ::= "+body))
+		}
+		return name
+	}
+
+	child := repeat.Children[0]
+	item := GBNFParser.FormatExpression([]*GBNFParser.Node{child})
+	if child.Type == GBNFParser.NodeSubExpression {
+		item = addRule(GBNFParser.FormatExpression(child.Children))
+	}
+
+	copies := make([]string, repeat.Min)
+	for index := range copies {
+		copies[index] = item
+	}
+	optional := repeat.Max - repeat.Min
+	if repeat.Max == -1 {
+		optional = 1
+	}
+	last := ""
+	for index := range optional {
+		body := item
+		if repeat.Max == -1 {
+			body += fmt.Sprintf(" %s_%d", rule, expansion.RuleCount+1)
+		} else if index > 0 {
+			body += " " + last
+		}
+		last = addRule(body + " |")
+	}
+	if last != "" {
+		copies = append(copies, last)
+	}
+	expansion.Expression = strings.Join(copies, " ")
+	return expansion
+}
@@ -0,0 +1,284 @@
+package Matcher
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"strconv"
+)
+
+type elementKind int
+
+const (
+	elementChars elementKind = iota
+	elementRule
+)
+
+// element is a character set or a reference to a rule.
+type element struct {
+	kind    elementKind
+	ranges  []GBNFParser.CharRange
+	negated bool
+	rule    int
+}
+
+func (element element) matches(char rune) bool {
+	for _, charRange := range element.ranges {
+		if charRange.Low <= char && char <= charRange.High {
+			return !element.negated
+		}
+	}
+	return element.negated
+}
+
+// rule is a list of alternatives, each a sequence of elements. Like in
+// llama.cpp, groups and repeats are compiled into rules of their own.
+type rule struct {
+	name string
+	// declaration is the name of the declaration a helper rule belongs to.
+	declaration  string
+	alternatives [][]element
+}
+
+// Grammar is a grammar compiled for matching.
+type Grammar struct {
+	rules []rule
+	ids   map[string]int
+}
+
+// Compile prepares a grammar for matching. It fails if a rule refers to an
+// undeclared rule or is left-recursive, which llama.cpp rejects as well.
+func Compile(ast *GBNFParser.Node) (*Grammar, error) {
+	grammar := &Grammar{ids: map[string]int{}}
+	declarations := map[string]*GBNFParser.Node{}
+	for _, declaration := range GBNFParser.EffectiveDeclarations(ast) {
+		grammar.ruleID(declaration.Token.Value)
+		declarations[declaration.Token.Value] = declaration
+	}
+
+	compiler := &compiler{grammar: grammar}
+	for index := 0; index < len(declarations); index++ {
+		name := grammar.rules[index].name
+		compiler.name, compiler.helpers = name, 0
+		grammar.rules[index].alternatives = compiler.alternatives(declarations[name].Children)
+		if compiler.err != nil {
+			return nil, compiler.err
+		}
+	}
+
+	if name, ok := grammar.leftRecursion(); ok {
+		return nil, fmt.Errorf("rule `%s` is left-recursive", name)
+	}
+	return grammar, nil
+}
+
+func (grammar *Grammar) ruleID(name string) int {
+	if id, ok := grammar.ids[name]; ok {
+		return id
+	}
+	grammar.ids[name] = len(grammar.rules)
+	grammar.rules = append(grammar.rules, rule{name: name, declaration: name})
+	return len(grammar.rules) - 1
+}
+
+// HasRule tells whether the grammar declares name.
+func (grammar *Grammar) HasRule(name string) bool {
+	_, ok := grammar.ids[name]
+	return ok
+}
+
+type compiler struct {
+	grammar *Grammar
+	// name is the declaration being compiled, which helper rules are named
+	// after.
+	name    string
+	helpers int
+	err     error
+}
+
+// helper adds a rule for a group or repeat of the current declaration.
+func (compiler *compiler) helper(alternatives [][]element) element {
+	compiler.helpers++
+	name := compiler.name + "-" + strconv.Itoa(compiler.helpers)
+	compiler.grammar.rules = append(compiler.grammar.rules, rule{name: name, declaration: compiler.name, alternatives: alternatives})
+	return element{kind: elementRule, rule: len(compiler.grammar.rules) - 1}
+}
+
+// alternatives compiles an expression into the alternatives of a rule.
+func (compiler *compiler) alternatives(nodes []*GBNFParser.Node) [][]element {
+	if len(nodes) == 1 && nodes[0].Type == GBNFParser.NodeAlternative {
+		alternatives := [][]element{}
+		for _, branch := range nodes[0].Children {
+			if branch.Type == GBNFParser.NodeSubExpression {
+				alternatives = append(alternatives, compiler.sequence(branch.Children))
+			} else {
+				alternatives = append(alternatives, compiler.sequence([]*GBNFParser.Node{branch}))
+			}
+		}
+		return alternatives
+	}
+	return [][]element{compiler.sequence(nodes)}
+}
+
+func (compiler *compiler) sequence(nodes []*GBNFParser.Node) []element {
+	elements := []element{}
+	for _, node := range nodes {
+		elements = append(elements, compiler.node(node)...)
+	}
+	return elements
+}
+
+func (compiler *compiler) node(node *GBNFParser.Node) []element {
+	switch node.Type {
+	case GBNFParser.NodeToken:
+		return compiler.token(node.Token)
+	case GBNFParser.NodeSubExpression:
+		alternatives := compiler.alternatives(node.Children)
+		if len(alternatives) == 1 {
+			return alternatives[0]
+		}
+		return []element{compiler.helper(alternatives)}
+	case GBNFParser.NodeAlternative:
+		return []element{compiler.helper(compiler.alternatives([]*GBNFParser.Node{node}))}
+	case GBNFParser.NodeRepeat:
+		return compiler.repeat(compiler.node(node.Children[0]), node.Min, node.Max)
+	default:
+		return nil
+	}
+}
+
+func (compiler *compiler) token(token *GBNFParser.Token) []element {
+	switch token.Type {
+	case GBNFParser.TokenString:
+		text, err := GBNFParser.UnescapeString(token.Value)
+		if err != nil {
+			compiler.fail("rule `%s`: %v", compiler.name, err)
+			return nil
+		}
+		elements := []element{}
+		for _, char := range text {
+			elements = append(elements, element{kind: elementChars, ranges: []GBNFParser.CharRange{{Low: char, High: char}}})
+		}
+		return elements
+	case GBNFParser.TokenRegexp:
+		ranges, negated, err := GBNFParser.ParseCharClass(token.Value)
+		if err != nil {
+			compiler.fail("rule `%s`: %v", compiler.name, err)
+			return nil
+		}
+		return []element{{kind: elementChars, ranges: ranges, negated: negated}}
+	case GBNFParser.TokenIdentifier:
+		id, ok := compiler.grammar.ids[token.Value]
+		if !ok {
+			compiler.fail("rule `%s` is not declared", token.Value)
+			return nil
+		}
+		return []element{{kind: elementRule, rule: id}}
+	default:
+		return nil
+	}
+}
+
+// repeat expands a repeat as llama.cpp does: `x{2,4}` becomes `x x h1` with
+// `h1 ::= x h2 |` and `h2 ::= x |`, and unbounded repeats end in a rule
+// `h ::= x h |`.
+func (compiler *compiler) repeat(elements []element, min int, max int) []element {
+	repeated := []element{}
+	for range min {
+		repeated = append(repeated, elements...)
+	}
+	if max == -1 {
+		star := compiler.helper(nil)
+		rules := compiler.grammar.rules
+		rules[star.rule].alternatives = [][]element{append(append([]element{}, elements...), star), {}}
+		return append(repeated, star)
+	}
+
+	var optional []element
+	for range max - min {
+		optional = []element{compiler.helper([][]element{append(append([]element{}, elements...), optional...), {}})}
+	}
+	return append(repeated, optional...)
+}
+
+func (compiler *compiler) fail(format string, args ...any) {
+	if compiler.err == nil {
+		compiler.err = fmt.Errorf(format, args...)
+	}
+}
+
+// leftRecursion returns a rule that can refer to itself before matching any
+// character, which would make matching loop forever. Helper rules are
+// reported by the declaration they belong to.
+func (grammar *Grammar) leftRecursion() (string, bool) {
+	nullable := make([]bool, len(grammar.rules))
+	for changed := true; changed; {
+		changed = false
+		for id, rule := range grammar.rules {
+			if nullable[id] {
+				continue
+			}
+			for _, alternative := range rule.alternatives {
+				if grammar.sequenceNullable(alternative, nullable) {
+					nullable[id], changed = true, true
+					break
+				}
+			}
+		}
+	}
+
+	// leftmost[id] lists the rules id can start with.
+	leftmost := make([][]int, len(grammar.rules))
+	for id, rule := range grammar.rules {
+		for _, alternative := range rule.alternatives {
+			for _, element := range alternative {
+				if element.kind == elementChars {
+					break
+				}
+				leftmost[id] = append(leftmost[id], element.rule)
+				if !nullable[element.rule] {
+					break
+				}
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(grammar.rules))
+	var visit func(id int) (int, bool)
+	visit = func(id int) (int, bool) {
+		state[id] = visiting
+		for _, next := range leftmost[id] {
+			if state[next] == visiting {
+				return next, true
+			}
+			if state[next] == unvisited {
+				if found, ok := visit(next); ok {
+					return found, true
+				}
+			}
+		}
+		state[id] = visited
+		return 0, false
+	}
+	for id := range grammar.rules {
+		if state[id] == unvisited {
+			if found, ok := visit(id); ok {
+				return grammar.rules[found].declaration, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (grammar *Grammar) sequenceNullable(elements []element, nullable []bool) bool {
+	for _, element := range elements {
+		if element.kind == elementChars || !nullable[element.rule] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,221 @@
+package Matcher
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"slices"
+	"strings"
+)
+
+// position points at the next element to match in an alternative.
+type position struct {
+	rule        int
+	alternative int
+	element     int
+}
+
+// stack lists the positions still to be matched, innermost last. An empty
+// stack means the text matched so far is complete.
+type stack []position
+
+// Matcher follows a grammar one character at a time, keeping every stack
+// the text so far can be in, as llama.cpp does during sampling.
+type Matcher struct {
+	grammar *Grammar
+	stacks  []stack
+}
+
+// NewMatcher creates a matcher for the text of rule.
+func (grammar *Grammar) NewMatcher(rule string) (*Matcher, error) {
+	id, ok := grammar.ids[rule]
+	if !ok {
+		return nil, fmt.Errorf("rule `%s` is not declared", rule)
+	}
+	matcher := &Matcher{grammar: grammar}
+	expanded := newStackSet()
+	for alternative := range grammar.rules[id].alternatives {
+		grammar.expand(grammar.push(nil, id, alternative), expanded)
+	}
+	matcher.stacks = expanded.stacks
+	return matcher, nil
+}
+
+// push adds the start of an alternative to a stack, unless it is empty.
+func (grammar *Grammar) push(base stack, rule int, alternative int) stack {
+	next := slices.Clone(base)
+	if len(grammar.rules[rule].alternatives[alternative]) > 0 {
+		next = append(next, position{rule: rule, alternative: alternative})
+	}
+	return next
+}
+
+// advance returns the stack after the element at its top was matched.
+func (grammar *Grammar) advance(current stack) stack {
+	top := current[len(current)-1]
+	next := slices.Clone(current[:len(current)-1])
+	if top.element+1 < len(grammar.rules[top.rule].alternatives[top.alternative]) {
+		top.element++
+		next = append(next, top)
+	}
+	return next
+}
+
+// expand replaces rule references at the top of current by the alternatives
+// of the rule until every stack has a character set at its top or is empty.
+func (grammar *Grammar) expand(current stack, expanded *stackSet) {
+	if len(current) == 0 {
+		expanded.add(current)
+		return
+	}
+	top := current[len(current)-1]
+	element := grammar.rules[top.rule].alternatives[top.alternative][top.element]
+	if element.kind == elementChars {
+		expanded.add(current)
+		return
+	}
+	base := grammar.advance(current)
+	for alternative := range grammar.rules[element.rule].alternatives {
+		grammar.expand(grammar.push(base, element.rule, alternative), expanded)
+	}
+}
+
+// stackSet collects stacks without duplicates, which ambiguous grammars
+// would otherwise multiply.
+type stackSet struct {
+	stacks []stack
+	seen   map[string]bool
+}
+
+func newStackSet() *stackSet {
+	return &stackSet{stacks: []stack{}, seen: map[string]bool{}}
+}
+
+func (set *stackSet) add(current stack) {
+	key := fmt.Sprint(current)
+	if !set.seen[key] {
+		set.seen[key] = true
+		set.stacks = append(set.stacks, current)
+	}
+}
+
+func (matcher *Matcher) top(current stack) element {
+	top := current[len(current)-1]
+	return matcher.grammar.rules[top.rule].alternatives[top.alternative][top.element]
+}
+
+// Accept advances the matcher past char and reports whether the grammar
+// allows it. A rejected character leaves the matcher unchanged.
+func (matcher *Matcher) Accept(char rune) bool {
+	expanded := newStackSet()
+	for _, current := range matcher.stacks {
+		if len(current) > 0 && matcher.top(current).matches(char) {
+			matcher.grammar.expand(matcher.grammar.advance(current), expanded)
+		}
+	}
+	if len(expanded.stacks) == 0 {
+		return false
+	}
+	matcher.stacks = expanded.stacks
+	return true
+}
+
+// IsComplete tells whether the text accepted so far is a full match.
+func (matcher *Matcher) IsComplete() bool {
+	for _, current := range matcher.stacks {
+		if len(current) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the sorted, merged ranges of the characters the grammar
+// allows next.
+func (matcher *Matcher) Next() []GBNFParser.CharRange {
+	ranges := []GBNFParser.CharRange{}
+	for _, current := range matcher.stacks {
+		if len(current) == 0 {
+			continue
+		}
+		element := matcher.top(current)
+		if element.negated {
+			ranges = append(ranges, GBNFParser.InvertRanges(element.ranges)...)
+		} else {
+			ranges = append(ranges, element.ranges...)
+		}
+	}
+	return GBNFParser.MergeRanges(ranges)
+}
+
+// Clone returns an independent copy of the matcher.
+func (matcher *Matcher) Clone() *Matcher {
+	return &Matcher{grammar: matcher.grammar, stacks: slices.Clone(matcher.stacks)}
+}
+
+// maxForcedLength bounds Forced for grammars that force endless text.
+const maxForcedLength = 1000
+
+// Prediction describes what a grammar allows after a prefix.
+type Prediction struct {
+	// Accepted is the number of characters of the prefix the grammar
+	// accepts. It is less than the length of the prefix if a character was
+	// rejected, in which case the other fields describe the text before it.
+	Accepted int
+	Rejected bool
+	// Complete tells whether the accepted text is a full match.
+	Complete bool
+	// Next lists the characters allowed next.
+	Next []GBNFParser.CharRange
+	// Forced is the text that must follow, up to the first point where the
+	// grammar allows a choice or the match may end.
+	Forced string
+}
+
+// Predict matches prefix against rule and describes what may follow.
+func Predict(grammar *Grammar, rule string, prefix string) (*Prediction, error) {
+	matcher, err := grammar.NewMatcher(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	prediction := &Prediction{}
+	for _, char := range prefix {
+		if !matcher.Accept(char) {
+			prediction.Rejected = true
+			break
+		}
+		prediction.Accepted++
+	}
+	prediction.Complete = matcher.IsComplete()
+	prediction.Next = matcher.Next()
+
+	var forced strings.Builder
+	for forcing, length := matcher.Clone(), 0; !forcing.IsComplete() && length < maxForcedLength; length++ {
+		next := forcing.Next()
+		if len(next) != 1 || next[0].Low != next[0].High {
+			break
+		}
+		forcing.Accept(next[0].Low)
+		forced.WriteRune(next[0].Low)
+	}
+	prediction.Forced = forced.String()
+	return prediction, nil
+}
+
+// FullMatch tells whether the whole prefix is a complete match.
+func (prediction *Prediction) FullMatch() bool {
+	return !prediction.Rejected && prediction.Complete
+}
+
+// Failure explains why text, the prefix of the prediction, is not a full
+// match.
+func (prediction *Prediction) Failure(text string) string {
+	expected := "the end of the text"
+	if len(prediction.Next) > 0 {
+		expected = GBNFParser.FormatCharClass(prediction.Next, false)
+	}
+	if prediction.Rejected {
+		return fmt.Sprintf("character %d (%q) is not allowed; expected %s", prediction.Accepted, []rune(text)[prediction.Accepted], expected)
+	}
+	return fmt.Sprintf("the text ends early; expected %s", expected)
+}
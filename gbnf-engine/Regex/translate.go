@@ -0,0 +1,315 @@
+package Regex
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Rule is a rule of a grammar translated from a regular expression.
+type Rule struct {
+	Name       string
+	Expression string
+}
+
+// Options configure a translation.
+type Options struct {
+	// Name is the name of the rule matching the whole pattern. Named groups
+	// become rules prefixed with it, such as `date-year` for (?P<year>...).
+	Name string
+	// AnyChar is an expression matching any character, used for the ends of
+	// the pattern that are not anchored. If empty, a rule `<Name>-char` is
+	// added for them.
+	AnyChar string
+	// Anchored matches the pattern against whole strings, as if it started
+	// with ^ and ended with $.
+	Anchored bool
+	// RuleName, if set, picks the name of a new rule from the one suggested,
+	// such as a name that is not declared yet. Rules are referred to by the
+	// names it returns.
+	RuleName func(name string) string
+}
+
+type translator struct {
+	options Options
+	rules   []Rule
+	// taken holds the names of the rules translated so far.
+	taken map[string]bool
+}
+
+// Translate turns a regular expression in Go syntax into rules matching the
+// same strings. The first rule matches the whole pattern. A pattern only
+// matches part of a string unless it is anchored with ^ and $; anchors are
+// supported at the start and end of the pattern and of its top-level
+// alternatives.
+func Translate(pattern string, options Options) ([]Rule, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	if options.Name == "" {
+		options.Name = "root"
+	}
+
+	translator := &translator{options: options, taken: map[string]bool{options.Name: true}}
+	translator.rules = append(translator.rules, Rule{Name: options.Name})
+	expression, err := translator.translateAnchored(re)
+	if err != nil {
+		return nil, err
+	}
+	translator.rules[0].Expression = expression
+	return translator.rules, nil
+}
+
+// Format prints rules as a grammar.
+func Format(rules []Rule) string {
+	var builder strings.Builder
+	for _, rule := range rules {
+		builder.WriteString(rule.Name + " ::= " + rule.Expression + "\n")
+	}
+	return builder.String()
+}
+
+// newRuleName returns a name for a new rule based on name, unique among the
+// translated rules. Patterns may use the same group name more than once.
+func (translator *translator) newRuleName(name string) string {
+	for suffix := 1; ; suffix++ {
+		candidate := name
+		if suffix > 1 {
+			candidate = name + "-" + strconv.Itoa(suffix)
+		}
+		if translator.options.RuleName != nil {
+			candidate = translator.options.RuleName(candidate)
+		}
+		if !translator.taken[candidate] {
+			translator.taken[candidate] = true
+			return candidate
+		}
+	}
+}
+
+// anyChar returns the expression for any character, adding its rule the
+// first time it is needed.
+func (translator *translator) anyChar() string {
+	if translator.options.AnyChar == "" {
+		translator.options.AnyChar = translator.newRuleName(translator.options.Name + "-char")
+		translator.rules = append(translator.rules, Rule{
+			Name:       translator.options.AnyChar,
+			Expression: GBNFParser.FormatCharClass([]GBNFParser.CharRange{{Low: 0, High: GBNFParser.MaxRune}}, false),
+		})
+	}
+	return translator.options.AnyChar
+}
+
+// translateAnchored translates re with the anchors at its ends; unanchored
+// ends accept any characters.
+func (translator *translator) translateAnchored(re *syntax.Regexp) (string, error) {
+	switch {
+	case re.Op == syntax.OpAlternate:
+		// Every alternative is anchored on its own, as in ^a|b$.
+		expressions := []string{}
+		for _, sub := range re.Sub {
+			expression, err := translator.translateAnchored(sub)
+			if err != nil {
+				return "", err
+			}
+			expressions = append(expressions, expression)
+		}
+		return "(" + strings.Join(expressions, " | ") + ")", nil
+	case re.Op == syntax.OpCapture && re.Name == "":
+		return translator.translateAnchored(re.Sub[0])
+	}
+
+	parts := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		parts = re.Sub
+	}
+	anchoredStart, anchoredEnd := translator.options.Anchored, translator.options.Anchored
+	for len(parts) > 0 && isBeginAnchor(parts[0]) {
+		parts = parts[1:]
+		anchoredStart = true
+	}
+	for len(parts) > 0 && isEndAnchor(parts[len(parts)-1]) {
+		parts = parts[:len(parts)-1]
+		anchoredEnd = true
+	}
+
+	expressions := []string{}
+	if !anchoredStart {
+		expressions = append(expressions, translator.anyChar()+"*")
+	}
+	for _, part := range parts {
+		expression, _, err := translator.translate(part)
+		if err != nil {
+			return "", err
+		}
+		expressions = append(expressions, expression)
+	}
+	if !anchoredEnd {
+		expressions = append(expressions, translator.anyChar()+"*")
+	}
+	if expressions = dropEmpty(expressions); len(expressions) == 0 {
+		return `""`, nil
+	}
+	return strings.Join(expressions, " "), nil
+}
+
+// dropEmpty removes the empty strings from a sequence of expressions, unless
+// the sequence has nothing else.
+func dropEmpty(expressions []string) []string {
+	kept := []string{}
+	for _, expression := range expressions {
+		if expression != `""` {
+			kept = append(kept, expression)
+		}
+	}
+	if len(kept) == 0 && len(expressions) > 0 {
+		return expressions[:1]
+	}
+	return kept
+}
+
+func isBeginAnchor(re *syntax.Regexp) bool {
+	return re.Op == syntax.OpBeginText || re.Op == syntax.OpBeginLine
+}
+
+func isEndAnchor(re *syntax.Regexp) bool {
+	return re.Op == syntax.OpEndText || re.Op == syntax.OpEndLine
+}
+
+// translate returns the GBNF expression for re and whether it is a single
+// element that an operator can be applied to without parentheses.
+func (translator *translator) translate(re *syntax.Regexp) (string, bool, error) {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return `""`, true, nil
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase == 0 {
+			return GBNFParser.QuoteLiteral(string(re.Rune)), true, nil
+		}
+		classes := []string{}
+		for _, char := range re.Rune {
+			classes = append(classes, GBNFParser.FormatCharClass(foldedRanges(char), false))
+		}
+		return strings.Join(classes, " "), len(classes) == 1, nil
+	case syntax.OpCharClass:
+		return formatClass(re.Rune), true, nil
+	case syntax.OpAnyCharNotNL:
+		return `[^\n]`, true, nil
+	case syntax.OpAnyChar:
+		return GBNFParser.FormatCharClass([]GBNFParser.CharRange{{Low: 0, High: GBNFParser.MaxRune}}, false), true, nil
+	case syntax.OpCapture:
+		expression, atomic, err := translator.translate(re.Sub[0])
+		if err != nil {
+			return "", false, err
+		}
+		if re.Name != "" {
+			// Named groups become rules of their own.
+			name := translator.newRuleName(translator.options.Name + "-" + strings.ReplaceAll(re.Name, "_", "-"))
+			translator.rules = append(translator.rules, Rule{Name: name, Expression: expression})
+			return name, true, nil
+		}
+		if atomic {
+			return expression, true, nil
+		}
+		return "(" + expression + ")", true, nil
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		if re.Op == syntax.OpRepeat && re.Max == 0 {
+			// x{0} only matches the empty string, so x is left out.
+			return `""`, true, nil
+		}
+		expression, atomic, err := translator.translate(re.Sub[0])
+		if err != nil {
+			return "", false, err
+		}
+		if expression == `""` {
+			// Repeating the empty string is the empty string.
+			return expression, true, nil
+		}
+		if !atomic {
+			expression = "(" + expression + ")"
+		}
+		return expression + repeatOperator(re), true, nil
+	case syntax.OpConcat:
+		expressions := []string{}
+		for _, sub := range re.Sub {
+			expression, _, err := translator.translate(sub)
+			if err != nil {
+				return "", false, err
+			}
+			expressions = append(expressions, expression)
+		}
+		expressions = dropEmpty(expressions)
+		return strings.Join(expressions, " "), len(expressions) == 1, nil
+	case syntax.OpAlternate:
+		expressions := []string{}
+		for _, sub := range re.Sub {
+			expression, _, err := translator.translate(sub)
+			if err != nil {
+				return "", false, err
+			}
+			expressions = append(expressions, expression)
+		}
+		return "(" + strings.Join(expressions, " | ") + ")", true, nil
+	case syntax.OpBeginLine, syntax.OpBeginText, syntax.OpEndLine, syntax.OpEndText:
+		return "", false, fmt.Errorf("anchors are only supported at the start and end of a pattern")
+	case syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return "", false, fmt.Errorf("word boundaries are not supported")
+	default:
+		return "", false, fmt.Errorf("unsupported regular expression %s", re)
+	}
+}
+
+func repeatOperator(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpStar:
+		return "*"
+	case syntax.OpPlus:
+		return "+"
+	case syntax.OpQuest:
+		return "?"
+	}
+	switch {
+	case re.Max == -1:
+		return fmt.Sprintf("{%d,}", re.Min)
+	case re.Min == re.Max:
+		return fmt.Sprintf("{%d}", re.Min)
+	default:
+		return fmt.Sprintf("{%d,%d}", re.Min, re.Max)
+	}
+}
+
+// formatClass formats the rune pairs of a regexp character class, negating
+// classes that are shorter to write as their complement.
+func formatClass(runes []rune) string {
+	ranges := []GBNFParser.CharRange{}
+	for index := 0; index+1 < len(runes); index += 2 {
+		ranges = append(ranges, GBNFParser.CharRange{Low: runes[index], High: runes[index+1]})
+	}
+	if len(ranges) > 0 && ranges[len(ranges)-1].High == GBNFParser.MaxRune {
+		complement := []GBNFParser.CharRange{}
+		next := rune(0)
+		for _, charRange := range ranges {
+			if charRange.Low > next {
+				complement = append(complement, GBNFParser.CharRange{Low: next, High: charRange.Low - 1})
+			}
+			next = charRange.High + 1
+		}
+		if len(complement) > 0 {
+			return GBNFParser.FormatCharClass(complement, true)
+		}
+	}
+	return GBNFParser.FormatCharClass(ranges, false)
+}
+
+// foldedRanges returns the characters equal to char under case folding.
+func foldedRanges(char rune) []GBNFParser.CharRange {
+	ranges := []GBNFParser.CharRange{{Low: char, High: char}}
+	for folded := unicode.SimpleFold(char); folded != char; folded = unicode.SimpleFold(folded) {
+		ranges = append(ranges, GBNFParser.CharRange{Low: folded, High: folded})
+	}
+	return ranges
+}
@@ -0,0 +1,301 @@
+package Transform
+
+import (
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"strings"
+)
+
+// FlattenAlternatives lifts alternatives nested directly in the branches of
+// another, so `"a" | ("b" | "c")` becomes `"a" | "b" | "c"`. ok is false if
+// declaration has none.
+func FlattenAlternatives(declaration *GBNFParser.Node) (change Change, ok bool) {
+	// The printer leaves out the parentheses around nested alternatives,
+	// so the change cannot be told from the printed grammar.
+	children, changed := flattenSequence(declaration.Children)
+	if !changed {
+		return Change{}, false
+	}
+	copied := *declaration
+	copied.Children = children
+	return Change{Declaration: declaration, Replacement: []*GBNFParser.Node{&copied}}, true
+}
+
+func flattenSequence(nodes []*GBNFParser.Node) ([]*GBNFParser.Node, bool) {
+	flattened := make([]*GBNFParser.Node, len(nodes))
+	changed := false
+	for index, node := range nodes {
+		var nodeChanged bool
+		flattened[index], nodeChanged = flattenNode(node)
+		changed = changed || nodeChanged
+	}
+	return flattened, changed
+}
+
+func flattenNode(node *GBNFParser.Node) (*GBNFParser.Node, bool) {
+	copied := *node
+	var changed bool
+	copied.Children, changed = flattenSequence(node.Children)
+	if node.Type != GBNFParser.NodeAlternative {
+		return &copied, changed
+	}
+
+	sequences := [][]*GBNFParser.Node{}
+	for _, child := range copied.Children {
+		if nested := nestedAlternative(child); nested != nil {
+			sequences = append(sequences, branches(nested)...)
+		} else {
+			sequences = append(sequences, branches(&GBNFParser.Node{Children: []*GBNFParser.Node{child}})...)
+		}
+	}
+	if len(sequences) == len(node.Children) {
+		return &copied, changed
+	}
+	return withoutDuplicateEmptyBranches(newAlternative(sequences)), true
+}
+
+// nestedAlternative returns the alternative a branch consists of, if any.
+func nestedAlternative(branch *GBNFParser.Node) *GBNFParser.Node {
+	switch {
+	case branch.Type == GBNFParser.NodeAlternative:
+		return branch
+	case branch.Type == GBNFParser.NodeSubExpression && len(branch.Children) == 1 && branch.Children[0].Type == GBNFParser.NodeAlternative:
+		return branch.Children[0]
+	}
+	return nil
+}
+
+// withoutDuplicateEmptyBranches keeps one empty branch of alternative, as
+// GBNF only allows one at the start.
+func withoutDuplicateEmptyBranches(alternative *GBNFParser.Node) *GBNFParser.Node {
+	children := []*GBNFParser.Node{}
+	for index, child := range alternative.Children {
+		if child.Type != GBNFParser.NodeUnknown || index == 0 {
+			children = append(children, child)
+		}
+	}
+	alternative.Children = children
+	return alternative
+}
+
+// FactorPrefixes moves the start that branches of an alternative have in
+// common in front of them, so `"ab" | "ac"` becomes `"a" ("b" | "c")` and
+// `"a" | "ab"` becomes `"a" "b"?`. String literals are compared character
+// by character, other elements as a whole. ok is false if no alternative of
+// declaration has branches with a common start.
+func FactorPrefixes(declaration *GBNFParser.Node) (change Change, ok bool) {
+	children, factored := factorSequence(declaration.Children)
+	if !factored {
+		return Change{}, false
+	}
+	return changeIfDifferent(declaration, children)
+}
+
+// factorSequence factors the alternatives in nodes, reporting whether any
+// had branches with a common start. Other alternatives are kept as they are.
+func factorSequence(nodes []*GBNFParser.Node) ([]*GBNFParser.Node, bool) {
+	factored := []*GBNFParser.Node{}
+	changed := false
+	for _, node := range nodes {
+		copied := *node
+		var childrenChanged bool
+		copied.Children, childrenChanged = factorSequence(node.Children)
+		changed = changed || childrenChanged
+		if node.Type != GBNFParser.NodeAlternative {
+			factored = append(factored, &copied)
+			continue
+		}
+		sequences, branchesChanged := factorBranches(branches(&copied))
+		if !branchesChanged {
+			factored = append(factored, &copied)
+			continue
+		}
+		changed = true
+		// The parser only puts an alternative alone in its sequence, so a
+		// single remaining branch can take its place.
+		if len(sequences) == 1 && len(nodes) == 1 {
+			return sequences[0], true
+		}
+		factored = append(factored, newAlternative(sequences))
+	}
+	return factored, changed
+}
+
+// unit is a character of a string literal, kept as written, or any other
+// element of a sequence.
+type unit struct {
+	literal string
+	node    *GBNFParser.Node
+}
+
+func (unit unit) key() string {
+	if unit.node != nil {
+		return "node " + GBNFParser.FormatExpression([]*GBNFParser.Node{unit.node})
+	}
+	return "literal " + unit.literal
+}
+
+// factorBranches groups sequences by their first unit and factors each
+// group, reporting whether any group has more than one branch. The branches
+// of the other groups are kept as they are.
+func factorBranches(sequences [][]*GBNFParser.Node) ([][]*GBNFParser.Node, bool) {
+	groups := [][][]unit{}
+	originals := [][]*GBNFParser.Node{}
+	groupOf := map[string]int{}
+	empty := false
+	for _, sequence := range sequences {
+		units := toUnits(sequence)
+		if len(units) == 0 {
+			empty = true
+			continue
+		}
+		if index, ok := groupOf[units[0].key()]; ok {
+			groups[index] = append(groups[index], units)
+		} else {
+			groupOf[units[0].key()] = len(groups)
+			groups = append(groups, [][]unit{units})
+			originals = append(originals, sequence)
+		}
+	}
+
+	factored := [][]*GBNFParser.Node{}
+	if empty {
+		factored = append(factored, []*GBNFParser.Node{})
+	}
+	changed := false
+	for index, group := range groups {
+		if len(group) == 1 {
+			factored = append(factored, originals[index])
+			continue
+		}
+		changed = true
+		factored = append(factored, factorGroup(group))
+	}
+	return factored, changed
+}
+
+// factorGroup joins branches that start with the same unit.
+func factorGroup(group [][]unit) []*GBNFParser.Node {
+	common := 1
+	for ; common < len(group[0]); common++ {
+		same := true
+		for _, units := range group[1:] {
+			if common >= len(units) || units[common].key() != group[0][common].key() {
+				same = false
+				break
+			}
+		}
+		if !same {
+			break
+		}
+	}
+
+	rests := [][]*GBNFParser.Node{}
+	optional := false
+	seen := map[string]bool{}
+	for _, units := range group {
+		rest := fromUnits(units[common:])
+		text := GBNFParser.FormatExpression(rest)
+		switch {
+		case len(rest) == 0:
+			optional = true
+		case !seen[text]:
+			seen[text] = true
+			rests = append(rests, rest)
+		}
+	}
+
+	prefix := fromUnits(group[0][:common])
+	if len(rests) == 0 {
+		return prefix
+	}
+	rests, _ = factorBranches(rests)
+	var rest *GBNFParser.Node
+	if len(rests) == 1 {
+		rest = atom(rests[0])
+	} else {
+		rest = &GBNFParser.Node{Type: GBNFParser.NodeSubExpression, Children: []*GBNFParser.Node{newAlternative(rests)}}
+	}
+	if optional {
+		rest = &GBNFParser.Node{Type: GBNFParser.NodeRepeat, Min: 0, Max: 1, Children: []*GBNFParser.Node{rest}}
+	} else if len(rests) == 1 {
+		return append(prefix, rests[0]...)
+	}
+	return append(prefix, rest)
+}
+
+func toUnits(sequence []*GBNFParser.Node) []unit {
+	units := []unit{}
+	for _, node := range sequence {
+		if node.Type == GBNFParser.NodeToken && node.Token.Type == GBNFParser.TokenString {
+			for _, piece := range splitLiteral(node.Token.Value) {
+				units = append(units, unit{literal: piece})
+			}
+		} else {
+			units = append(units, unit{node: node})
+		}
+	}
+	return units
+}
+
+// fromUnits turns units back into nodes, joining adjacent characters into
+// one string literal.
+func fromUnits(units []unit) []*GBNFParser.Node {
+	nodes := []*GBNFParser.Node{}
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			nodes = append(nodes, &GBNFParser.Node{
+				Type:  GBNFParser.NodeToken,
+				Token: &GBNFParser.Token{Type: GBNFParser.TokenString, Value: literal.String()},
+				Min:   1,
+				Max:   1,
+			})
+			literal.Reset()
+		}
+	}
+	for _, unit := range units {
+		if unit.node != nil {
+			flush()
+			nodes = append(nodes, unit.node)
+		} else {
+			literal.WriteString(unit.literal)
+		}
+	}
+	flush()
+	return nodes
+}
+
+// escapeLengths are the lengths of the escape sequences of string token
+// values with hex digits, by the character after the backslash. Other escape
+// sequences are two characters long.
+var escapeLengths = map[rune]int{'x': 4, 'u': 6, 'U': 10}
+
+// splitLiteral splits a string token value into its characters, keeping
+// escape sequences whole.
+func splitLiteral(value string) []string {
+	runes := []rune(value)
+	pieces := []string{}
+	for index := 0; index < len(runes); {
+		length := 1
+		if runes[index] == '\\' && index+1 < len(runes) {
+			length = 2
+			if escape, ok := escapeLengths[runes[index+1]]; ok {
+				length = min(escape, len(runes)-index)
+			}
+		}
+		pieces = append(pieces, string(runes[index:index+length]))
+		index += length
+	}
+	return pieces
+}
+
+// changeIfDifferent replaces declaration by one with children, unless that
+// prints the same.
+func changeIfDifferent(declaration *GBNFParser.Node, children []*GBNFParser.Node) (Change, bool) {
+	if GBNFParser.FormatExpression(children) == GBNFParser.FormatExpression(declaration.Children) {
+		return Change{}, false
+	}
+	copied := *declaration
+	copied.Children = children
+	return Change{Declaration: declaration, Replacement: []*GBNFParser.Node{&copied}}, true
+}
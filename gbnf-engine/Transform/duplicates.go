@@ -0,0 +1,129 @@
+package Transform
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+)
+
+// IdenticalRules groups the rules whose bodies are the same, in the order of
+// the grammar. Bodies are compared node by node, with string literals as
+// written. Rules declared more than once are left out, as it is unclear
+// which body counts.
+func IdenticalRules(root *GBNFParser.Node) [][]*GBNFParser.Node {
+	declared := declarations(root)
+	groups := [][]*GBNFParser.Node{}
+	for _, node := range root.Children {
+		if node.Type != GBNFParser.NodeDeclaration || len(declared[node.Token.Value]) > 1 {
+			continue
+		}
+		grouped := false
+		for index, group := range groups {
+			if equalNodes(group[0].Children, node.Children) {
+				groups[index] = append(group, node)
+				grouped = true
+				break
+			}
+		}
+		if !grouped {
+			groups = append(groups, []*GBNFParser.Node{node})
+		}
+	}
+
+	identical := [][]*GBNFParser.Node{}
+	for _, group := range groups {
+		if len(group) > 1 {
+			identical = append(identical, group)
+		}
+	}
+	return identical
+}
+
+// MergeIdenticalRules keeps one rule of each group of IdenticalRules, `root`
+// if it is among them and else the first, and refers to it instead of the
+// others, which are removed.
+func MergeIdenticalRules(root *GBNFParser.Node) []Change {
+	renamed := map[string]string{}
+	removed := map[*GBNFParser.Node]bool{}
+	for _, group := range IdenticalRules(root) {
+		kept := group[0]
+		for _, node := range group {
+			if node.Token.Value == "root" {
+				kept = node
+			}
+		}
+		for _, node := range group {
+			if node != kept {
+				renamed[node.Token.Value] = kept.Token.Value
+				removed[node] = true
+			}
+		}
+	}
+
+	changes := []Change{}
+	for _, node := range root.Children {
+		if node.Type != GBNFParser.NodeDeclaration {
+			continue
+		}
+		if removed[node] {
+			changes = append(changes, Change{Declaration: node})
+			continue
+		}
+		replaced := rewriteDeclaration(node, func(_ *GBNFParser.Node, child *GBNFParser.Node) []*GBNFParser.Node {
+			if child.Type != GBNFParser.NodeToken || child.Token.Type != GBNFParser.TokenIdentifier {
+				return nil
+			}
+			if name, ok := renamed[child.Token.Value]; ok {
+				return []*GBNFParser.Node{newReference(name)}
+			}
+			return nil
+		})
+		if replaced != nil {
+			changes = append(changes, Change{Declaration: node, Replacement: []*GBNFParser.Node{replaced}})
+		}
+	}
+	return changes
+}
+
+// KeepLastDeclaration removes the declarations of a rule declared more than
+// once that llama.cpp ignores, keeping the last one. What the grammar matches
+// does not change.
+func KeepLastDeclaration(root *GBNFParser.Node, name string) ([]Change, error) {
+	declared := declarations(root)[name]
+	if len(declared) < 2 {
+		return nil, fmt.Errorf("rule `%s` is not declared more than once", name)
+	}
+	changes := []Change{}
+	for _, declaration := range declared[:len(declared)-1] {
+		changes = append(changes, Change{Declaration: declaration})
+	}
+	return changes, nil
+}
+
+// MergeDeclarations joins the declarations of a rule declared more than once
+// into one alternation in place of the first. llama.cpp only uses the last
+// declaration, so this changes what the grammar matches; it is meant for
+// grammars written as if the declarations were combined.
+func MergeDeclarations(root *GBNFParser.Node, name string) ([]Change, error) {
+	declared := declarations(root)[name]
+	if len(declared) < 2 {
+		return nil, fmt.Errorf("rule `%s` is not declared more than once", name)
+	}
+
+	sequences := [][]*GBNFParser.Node{}
+	for _, declaration := range declared {
+		body := clone(declaration.Children)
+		if len(body) == 1 && body[0].Type == GBNFParser.NodeAlternative {
+			sequences = append(sequences, branches(body[0])...)
+		} else {
+			sequences = append(sequences, body)
+		}
+	}
+	merged := *declared[0]
+	merged.Children = []*GBNFParser.Node{withoutDuplicateEmptyBranches(newAlternative(sequences))}
+
+	changes := []Change{{Declaration: declared[0], Replacement: []*GBNFParser.Node{&merged}}}
+	for _, declaration := range declared[1:] {
+		changes = append(changes, Change{Declaration: declaration})
+	}
+	return changes, nil
+}
@@ -0,0 +1,98 @@
+package Transform
+
+import "gbnflsp/gbnf-engine/GBNFParser"
+
+// Edit replaces the part of the source at Span with Text.
+type Edit struct {
+	Span GBNFParser.Span
+	Text string
+}
+
+// DeclarationEdits returns the edits turning the source of declaration into
+// replacement, limited to the nodes that differ. ok is false if the edits
+// cannot be limited to the body, in which case the whole declaration has to
+// be rewritten.
+func DeclarationEdits(declaration *GBNFParser.Node, replacement *GBNFParser.Node) (edits []Edit, ok bool) {
+	if declaration.Token.Value != replacement.Token.Value || len(declaration.Children) == 0 {
+		return nil, false
+	}
+	if edits, ok := childEdits(declaration, replacement); ok {
+		return edits, true
+	}
+	first, last := declaration.Children[0], declaration.Children[len(declaration.Children)-1]
+	if first.Span == (GBNFParser.Span{}) || last.Span == (GBNFParser.Span{}) {
+		return nil, false
+	}
+	span := GBNFParser.Span{Line: first.Span.Line, Column: first.Span.Column, EndLine: last.Span.EndLine, EndColumn: last.Span.EndColumn}
+	return []Edit{{Span: span, Text: GBNFParser.FormatExpression(replacement.Children)}}, true
+}
+
+// childEdits pairs the children of original and replacement, replacing the
+// ones that differ. ok is false if they cannot be paired.
+func childEdits(original *GBNFParser.Node, replacement *GBNFParser.Node) ([]Edit, bool) {
+	if len(original.Children) != len(replacement.Children) {
+		return nil, false
+	}
+	edits := []Edit{}
+	for index, child := range original.Children {
+		replaced := replacement.Children[index]
+		if equalNode(child, replaced) {
+			continue
+		}
+		if nested, ok := nodeEdits(child, replaced); ok {
+			edits = append(edits, nested...)
+			continue
+		}
+		if child.Span == (GBNFParser.Span{}) {
+			return nil, false
+		}
+		edits = append(edits, Edit{Span: child.Span, Text: formatChild(original, replaced)})
+	}
+	return edits, true
+}
+
+// nodeEdits edits the children of original if only they differ from
+// replacement.
+func nodeEdits(original *GBNFParser.Node, replacement *GBNFParser.Node) ([]Edit, bool) {
+	if original.Type == GBNFParser.NodeToken || original.Type != replacement.Type ||
+		original.Min != replacement.Min || original.Max != replacement.Max || !equalToken(original.Token, replacement.Token) {
+		return nil, false
+	}
+	return childEdits(original, replacement)
+}
+
+// formatChild prints node as a child of parent. Branches of alternatives
+// need no parentheses.
+func formatChild(parent *GBNFParser.Node, node *GBNFParser.Node) string {
+	if parent.Type == GBNFParser.NodeAlternative && node.Type == GBNFParser.NodeSubExpression {
+		return GBNFParser.FormatExpression(node.Children)
+	}
+	return GBNFParser.FormatExpression([]*GBNFParser.Node{node})
+}
+
+// equalNodes tells whether two sequences have the same structure and tokens,
+// whatever their source positions. String literals compare as written, so
+// literals spelled differently are different even if they match the same
+// text.
+func equalNodes(a []*GBNFParser.Node, b []*GBNFParser.Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index := range a {
+		if !equalNode(a[index], b[index]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalNode(a *GBNFParser.Node, b *GBNFParser.Node) bool {
+	return a.Type == b.Type && a.Min == b.Min && a.Max == b.Max && equalToken(a.Token, b.Token) && equalNodes(a.Children, b.Children)
+}
+
+func equalToken(a *GBNFParser.Token, b *GBNFParser.Token) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Type == b.Type && a.Value == b.Value
+}
@@ -0,0 +1,60 @@
+package Transform
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+)
+
+// ExtractRule moves parent.Children[start:end] of declaration into a new rule
+// declared right after it, and refers to the new rule in their place. parent
+// is either a sequence, in which case the nodes become the body of the new
+// rule, or an alternative, in which case the branches do. The new rule is
+// named base, numbered if that is taken; its name is returned.
+func ExtractRule(root *GBNFParser.Node, declaration *GBNFParser.Node, parent *GBNFParser.Node, start int, end int, base string) ([]Change, string, error) {
+	if start < 0 || end > len(parent.Children) || start >= end {
+		return nil, "", fmt.Errorf("nothing to extract")
+	}
+	if parent.Type == GBNFParser.NodeRepeat {
+		parent, start, end = &GBNFParser.Node{Type: GBNFParser.NodeSubExpression, Children: parent.Children}, 0, 1
+	}
+	extracted := parent.Children[start:end]
+	if parent.Type == GBNFParser.NodeSubExpression && start == 0 && end == len(parent.Children) {
+		// All of a group or branch is replaced, not just its contents.
+		extracted = []*GBNFParser.Node{parent}
+	}
+	name := UniqueName(root, base)
+
+	var body []*GBNFParser.Node
+	switch {
+	case parent.Type == GBNFParser.NodeAlternative && len(extracted) > 1:
+		body = []*GBNFParser.Node{newAlternative(branches(&GBNFParser.Node{Children: clone(extracted)}))}
+	case parent.Type == GBNFParser.NodeAlternative:
+		body = branches(&GBNFParser.Node{Children: clone(extracted)})[0]
+	case len(extracted) == 1 && extracted[0].Type == GBNFParser.NodeSubExpression:
+		// The parentheses of a group are not needed around a whole rule.
+		body = clone(extracted[0].Children)
+	default:
+		body = clone(extracted)
+	}
+	if len(body) == 0 {
+		return nil, "", fmt.Errorf("cannot extract an empty expression")
+	}
+
+	replaced := rewriteDeclaration(declaration, func(_ *GBNFParser.Node, node *GBNFParser.Node) []*GBNFParser.Node {
+		for index, selected := range extracted {
+			if node == selected && index == 0 {
+				return []*GBNFParser.Node{newReference(name)}
+			} else if node == selected {
+				return []*GBNFParser.Node{}
+			}
+		}
+		return nil
+	})
+	if replaced == nil {
+		return nil, "", fmt.Errorf("the expression is not part of rule `%s`", declaration.Token.Value)
+	}
+	return []Change{{
+		Declaration: declaration,
+		Replacement: []*GBNFParser.Node{replaced, newDeclaration(name, body)},
+	}}, name, nil
+}
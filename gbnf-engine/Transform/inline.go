@@ -0,0 +1,90 @@
+package Transform
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+)
+
+// countReferences counts the references to name in nodes.
+func countReferences(nodes []*GBNFParser.Node, name string) int {
+	count := 0
+	for _, node := range nodes {
+		if isReference(node, name) {
+			count++
+		}
+		count += countReferences(node.Children, name)
+	}
+	return count
+}
+
+// InlineCandidate tells whether name is declared once and used exactly once,
+// by another rule, so that InlineRule applies.
+func InlineCandidate(root *GBNFParser.Node, name string) bool {
+	_, err := inlineTarget(root, name)
+	return err == nil
+}
+
+// inlineTarget returns the declaration that uses name.
+func inlineTarget(root *GBNFParser.Node, name string) (*GBNFParser.Node, error) {
+	declared := declarations(root)
+	if len(declared[name]) != 1 {
+		return nil, fmt.Errorf("rule `%s` must be declared exactly once to be inlined", name)
+	}
+	if countReferences(declared[name][0].Children, name) > 0 {
+		return nil, fmt.Errorf("rule `%s` is recursive", name)
+	}
+
+	var target *GBNFParser.Node
+	for _, node := range root.Children {
+		if node.Type != GBNFParser.NodeDeclaration {
+			continue
+		}
+		switch count := countReferences(node.Children, name); {
+		case count == 0:
+		case count > 1 || target != nil:
+			return nil, fmt.Errorf("rule `%s` is used more than once", name)
+		default:
+			target = node
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("rule `%s` is not used", name)
+	}
+	return target, nil
+}
+
+// InlineRule replaces the only reference to name by the body of its
+// declaration, which is removed. The body is parenthesised where the
+// reference stands in a sequence or under a repeat and needs it.
+func InlineRule(root *GBNFParser.Node, name string) ([]Change, error) {
+	target, err := inlineTarget(root, name)
+	if err != nil {
+		return nil, err
+	}
+	declaration := declarations(root)[name][0]
+	body := declaration.Children
+
+	replaced := rewriteDeclaration(target, func(parent *GBNFParser.Node, node *GBNFParser.Node) []*GBNFParser.Node {
+		if !isReference(node, name) {
+			return nil
+		}
+		switch parent.Type {
+		case GBNFParser.NodeAlternative:
+			if body[0].Type == GBNFParser.NodeAlternative {
+				return clone(body[0].Children)
+			}
+			return []*GBNFParser.Node{branch(clone(body))}
+		case GBNFParser.NodeRepeat:
+			return []*GBNFParser.Node{atom(clone(body))}
+		default:
+			if body[0].Type == GBNFParser.NodeAlternative && len(parent.Children) > 1 {
+				return []*GBNFParser.Node{{Type: GBNFParser.NodeSubExpression, Children: clone(body)}}
+			}
+			return clone(body)
+		}
+	})
+	return []Change{
+		{Declaration: target, Replacement: []*GBNFParser.Node{replaced}},
+		{Declaration: declaration},
+	}, nil
+}
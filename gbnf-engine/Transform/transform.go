@@ -0,0 +1,176 @@
+package Transform
+
+import (
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"strconv"
+)
+
+// Change replaces a declaration of a grammar. Replacement holds the new
+// version of the declaration followed by any rules added after it; an empty
+// Replacement removes the declaration. Declarations without a change are
+// left as they are, so editors can rewrite only the declarations that
+// change.
+type Change struct {
+	Declaration *GBNFParser.Node
+	Replacement []*GBNFParser.Node
+}
+
+// Apply returns a grammar with changes made to root. root is not modified.
+func Apply(root *GBNFParser.Node, changes []Change) *GBNFParser.Node {
+	replacements := map[*GBNFParser.Node][]*GBNFParser.Node{}
+	for _, change := range changes {
+		replacements[change.Declaration] = change.Replacement
+	}
+	result := &GBNFParser.Node{Type: GBNFParser.NodeRoot}
+	for _, node := range root.Children {
+		if replacement, ok := replacements[node]; ok {
+			result.Children = append(result.Children, replacement...)
+		} else {
+			result.Children = append(result.Children, node)
+		}
+	}
+	return result
+}
+
+// declarations returns the declarations of root by name. Names declared
+// more than once map to all their declarations.
+func declarations(root *GBNFParser.Node) map[string][]*GBNFParser.Node {
+	declared := map[string][]*GBNFParser.Node{}
+	for _, node := range root.Children {
+		if node.Type == GBNFParser.NodeDeclaration {
+			declared[node.Token.Value] = append(declared[node.Token.Value], node)
+		}
+	}
+	return declared
+}
+
+// UniqueName returns base, or base followed by a number, such that it is
+// not declared in root.
+func UniqueName(root *GBNFParser.Node, base string) string {
+	declared := declarations(root)
+	name := base
+	for suffix := 2; len(declared[name]) > 0; suffix++ {
+		name = base + "-" + strconv.Itoa(suffix)
+	}
+	return name
+}
+
+func newDeclaration(name string, children []*GBNFParser.Node) *GBNFParser.Node {
+	return &GBNFParser.Node{
+		Type:     GBNFParser.NodeDeclaration,
+		Token:    &GBNFParser.Token{Type: GBNFParser.TokenIdentifier, Value: name},
+		Children: children,
+	}
+}
+
+func newReference(name string) *GBNFParser.Node {
+	return &GBNFParser.Node{
+		Type:  GBNFParser.NodeToken,
+		Token: &GBNFParser.Token{Type: GBNFParser.TokenIdentifier, Value: name},
+		Min:   1,
+		Max:   1,
+	}
+}
+
+func isReference(node *GBNFParser.Node, name string) bool {
+	return node.Type == GBNFParser.NodeToken && node.Token.Type == GBNFParser.TokenIdentifier && node.Token.Value == name
+}
+
+// clone copies nodes deeply, sharing only their tokens.
+func clone(nodes []*GBNFParser.Node) []*GBNFParser.Node {
+	copies := make([]*GBNFParser.Node, len(nodes))
+	for index, node := range nodes {
+		copied := *node
+		copied.Children = clone(node.Children)
+		copies[index] = &copied
+	}
+	return copies
+}
+
+// atom turns a sequence into a node that a repeat can apply to: a token or
+// group as is, or else the sequence in parentheses.
+func atom(nodes []*GBNFParser.Node) *GBNFParser.Node {
+	if len(nodes) == 1 && (nodes[0].Type == GBNFParser.NodeToken || nodes[0].Type == GBNFParser.NodeSubExpression) {
+		return nodes[0]
+	}
+	return &GBNFParser.Node{Type: GBNFParser.NodeSubExpression, Children: nodes}
+}
+
+// branch turns a sequence into a branch of an alternative.
+func branch(nodes []*GBNFParser.Node) *GBNFParser.Node {
+	switch len(nodes) {
+	case 0:
+		return &GBNFParser.Node{Type: GBNFParser.NodeUnknown}
+	case 1:
+		return nodes[0]
+	default:
+		return &GBNFParser.Node{Type: GBNFParser.NodeSubExpression, Children: nodes}
+	}
+}
+
+// branches returns the sequences of the branches of an alternative.
+func branches(alternative *GBNFParser.Node) [][]*GBNFParser.Node {
+	sequences := [][]*GBNFParser.Node{}
+	for _, child := range alternative.Children {
+		switch child.Type {
+		case GBNFParser.NodeSubExpression:
+			sequences = append(sequences, child.Children)
+		case GBNFParser.NodeUnknown:
+			sequences = append(sequences, []*GBNFParser.Node{})
+		default:
+			sequences = append(sequences, []*GBNFParser.Node{child})
+		}
+	}
+	return sequences
+}
+
+// newAlternative builds an alternative from sequences. Empty branches come
+// first, where GBNF allows them.
+func newAlternative(sequences [][]*GBNFParser.Node) *GBNFParser.Node {
+	alternative := &GBNFParser.Node{
+		Type:  GBNFParser.NodeAlternative,
+		Token: &GBNFParser.Token{Type: GBNFParser.TokenAlternative, Value: "|"},
+		Min:   1,
+		Max:   1,
+	}
+	for _, sequence := range sequences {
+		if len(sequence) == 0 {
+			alternative.Children = append([]*GBNFParser.Node{branch(nil)}, alternative.Children...)
+		} else {
+			alternative.Children = append(alternative.Children, branch(sequence))
+		}
+	}
+	return alternative
+}
+
+// rewrite copies the children of parent, letting replace substitute each
+// of them. replace returns nil to keep a node, after which its own children
+// are rewritten. changed tells whether anything was substituted.
+func rewrite(parent *GBNFParser.Node, replace func(parent *GBNFParser.Node, node *GBNFParser.Node) []*GBNFParser.Node) (children []*GBNFParser.Node, changed bool) {
+	children = []*GBNFParser.Node{}
+	for _, node := range parent.Children {
+		if replacement := replace(parent, node); replacement != nil {
+			children = append(children, replacement...)
+			changed = true
+			continue
+		}
+		copied := *node
+		var childChanged bool
+		copied.Children, childChanged = rewrite(node, replace)
+		changed = changed || childChanged
+		children = append(children, &copied)
+	}
+	return children, changed
+}
+
+// rewriteDeclaration applies rewrite to a declaration, returning nil if
+// nothing changed.
+func rewriteDeclaration(declaration *GBNFParser.Node, replace func(parent *GBNFParser.Node, node *GBNFParser.Node) []*GBNFParser.Node) *GBNFParser.Node {
+	children, changed := rewrite(declaration, replace)
+	if !changed {
+		return nil
+	}
+	copied := *declaration
+	copied.Children = children
+	return &copied
+}
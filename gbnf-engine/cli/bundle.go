@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"os"
+	"path/filepath"
+)
+
+func runBundle(args []string) int {
+	flags := flag.NewFlagSet("bundle", flag.ContinueOnError)
+	output := flags.String("o", "", "write the grammar to this file instead of stdout")
+	positional, err := parseArgs(flags, args)
+	if err != nil || len(positional) != 1 {
+		return usageError("bundle")
+	}
+
+	root, imported, ok := loadGrammar(positional[0])
+	if !ok {
+		return 1
+	}
+
+	bundle, errors := GBNFParser.BundleGrammar(root, imported)
+	for _, err := range errors {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errors) > 0 {
+		return 1
+	}
+	return writeOutput(*output, bundle.Format(filepath.Dir(root.Path)))
+}
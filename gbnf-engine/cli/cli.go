@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"io"
+	"os"
+)
+
+type command struct {
+	name        string
+	usage       string
+	description string
+	run         func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{
+			name:        "flatten",
+			usage:       "flatten <grammar.gbnf> [-o <out.gbnf>]",
+			description: "Combine a grammar and its imports into one self-contained grammar.",
+			run:         runFlatten,
+		},
+		{
+			name:        "bundle",
+			usage:       "bundle <grammar.gbnf> [-o <out.gbnf>]",
+			description: "Combine a grammar and its imports into one llama.cpp grammar, dropping unreachable rules and renaming clashing ones.",
+			run:         runBundle,
+		},
+		{
+			name:        "from-json-schema",
+			usage:       "from-json-schema <schema.json> [-o <out.gbnf>]",
+			description: "Convert a JSON Schema into a grammar accepting the JSON documents it describes.",
+			run:         runFromJSONSchema,
+		},
+		{
+			name:        "to-json-schema",
+			usage:       "to-json-schema <grammar.gbnf> [-o <schema.json>]",
+			description: "Recover a JSON Schema from a grammar describing JSON, reporting the rules that could not be mapped.",
+			run:         runToJSONSchema,
+		},
+		{
+			name:        "from-regex",
+			usage:       "from-regex <pattern> [-name <rule>] [-o <out.gbnf>]",
+			description: "Translate a regular expression in Go syntax into rules matching the same strings.",
+			run:         runFromRegex,
+		},
+		{
+			name:        "export",
+			usage:       "export <grammar.gbnf> -format lark|antlr4|ebnf [-o <out>]",
+			description: "Translate a grammar into Lark, ANTLR 4 or W3C EBNF, reporting what cannot be translated faithfully.",
+			run:         runExport,
+		},
+		{
+			name:        "import",
+			usage:       "import <grammar> [-format lark|ebnf] [-start <rule>] [-o <out.gbnf>]",
+			description: "Translate a Lark or EBNF grammar into GBNF, reporting constructs that have no GBNF equivalent.",
+			run:         runImport,
+		},
+		{
+			name:        "next",
+			usage:       "next <grammar.gbnf> [-prefix <text> | -prefix-file <file>] [-rule <rule>]",
+			description: "Replay generated text against a grammar and show where it was rejected, whether it is complete and which characters may come next.",
+			run:         runNext,
+		},
+		{
+			name:        "test",
+			usage:       "test <grammar.gbnf> <fixtures-dir> [-rule <rule>] [-junit <report.xml>]",
+			description: "Match *.accept.txt and *.reject.txt fixtures against a grammar and report the position of each mismatch. One trailing newline (\\n or \\r\\n) is not part of a fixture; end it with two to match one.",
+			run:         runTest,
+		},
+		{
+			name:        "stats",
+			usage:       "stats <grammar.gbnf> [-max-depth <n>] [-max-size <n>] [-max-fan-out <n>]",
+			description: "Print the nesting depth, expanded size, alternation fan-out and recursion of each rule, warning about rules likely to slow down sampling.",
+			run:         runStats,
+		},
+	}
+}
+
+// Run executes the command named by args[0] and returns the exit code.
+func Run(args []string) int {
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+	printUsage(os.Stderr)
+	return 2
+}
+
+func printUsage(writer io.Writer) {
+	fmt.Fprintln(writer, "Usage: gbnf-engine [--debug]")
+	fmt.Fprintln(writer, "       gbnf-engine <command> [arguments]")
+	fmt.Fprintln(writer, "")
+	fmt.Fprintln(writer, "Without a command, the language server is started on stdin/stdout.")
+	fmt.Fprintln(writer, "")
+	fmt.Fprintln(writer, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(writer, "  %s\n      %s\n", cmd.usage, cmd.description)
+	}
+}
+
+// parseArgs parses flags that may appear before, between or after the
+// positional arguments and returns the positional arguments.
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+// usageError reports a malformed command line for the command name.
+func usageError(name string) int {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			fmt.Fprintf(os.Stderr, "Usage: gbnf-engine %s\n", cmd.usage)
+		}
+	}
+	return 2
+}
+
+// loadGrammar reads the grammar at path and the files it imports. Syntax and
+// import errors are printed to stderr, in which case ok is false.
+func loadGrammar(path string) (root *GBNFParser.GrammarFile, imported []*GBNFParser.GrammarFile, ok bool) {
+	root, err := GBNFParser.ReadGrammarFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return nil, nil, false
+	}
+
+	imported, importErrors := GBNFParser.NewImportResolver().Resolve(root)
+	ok = true
+	for _, file := range append([]*GBNFParser.GrammarFile{root}, imported...) {
+		for _, err := range file.Errors {
+			fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", file.Path, err.Line+1, err.Column+1, err.Message)
+			ok = false
+		}
+	}
+	for _, err := range importErrors {
+		fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", err.Path, err.Token.Line+1, err.Token.Column+1, err.Message)
+		ok = false
+	}
+	return root, imported, ok
+}
+
+// writeOutput writes text to the file at path, or to stdout if path is empty.
+func writeOutput(path string, text string) int {
+	if path == "" {
+		fmt.Print(text)
+		return 0
+	}
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
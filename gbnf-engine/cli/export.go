@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gbnflsp/gbnf-engine/Formats"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "", "format to export to: "+strings.Join(Formats.Names, ", "))
+	output := flags.String("o", "", "write the grammar to this file instead of stdout")
+	positional, err := parseArgs(flags, args)
+	if err != nil || len(positional) != 1 || *format == "" {
+		return usageError("export")
+	}
+
+	root, imported, ok := loadGrammar(positional[0])
+	if !ok {
+		return 1
+	}
+	flattened, errors := GBNFParser.Flatten(root, imported)
+	for _, err := range errors {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errors) > 0 {
+		return 1
+	}
+
+	// ANTLR requires the grammar to be named after its file.
+	namedAfter := positional[0]
+	if *output != "" {
+		namedAfter = *output
+	}
+	grammarName := strings.TrimSuffix(filepath.Base(namedAfter), filepath.Ext(namedAfter))
+
+	exported, issues, err := Formats.Export(flattened, *format, grammarName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	for _, issue := range issues {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", positional[0], issue)
+	}
+	return writeOutput(*output, exported)
+}
@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"os"
+)
+
+func runFlatten(args []string) int {
+	flags := flag.NewFlagSet("flatten", flag.ContinueOnError)
+	output := flags.String("o", "", "write the grammar to this file instead of stdout")
+	positional, err := parseArgs(flags, args)
+	if err != nil || len(positional) != 1 {
+		return usageError("flatten")
+	}
+
+	root, imported, ok := loadGrammar(positional[0])
+	if !ok {
+		return 1
+	}
+
+	flattened, errors := GBNFParser.Flatten(root, imported)
+	for _, err := range errors {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errors) > 0 {
+		return 1
+	}
+	return writeOutput(*output, GBNFParser.Format(flattened))
+}
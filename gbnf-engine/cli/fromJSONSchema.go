@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gbnflsp/gbnf-engine/JSONSchema"
+	"os"
+)
+
+func runFromJSONSchema(args []string) int {
+	flags := flag.NewFlagSet("from-json-schema", flag.ContinueOnError)
+	output := flags.String("o", "", "write the grammar to this file instead of stdout")
+	positional, err := parseArgs(flags, args)
+	if err != nil || len(positional) != 1 {
+		return usageError("from-json-schema")
+	}
+
+	data, err := os.ReadFile(positional[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	grammar, warnings, err := JSONSchema.Convert(data)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", positional[0], warning)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", positional[0], err)
+		return 1
+	}
+	return writeOutput(*output, grammar)
+}
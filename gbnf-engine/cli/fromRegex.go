@@ -0,0 +1,25 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gbnflsp/gbnf-engine/Regex"
+	"os"
+)
+
+func runFromRegex(args []string) int {
+	flags := flag.NewFlagSet("from-regex", flag.ContinueOnError)
+	output := flags.String("o", "", "write the grammar to this file instead of stdout")
+	name := flags.String("name", "root", "name of the rule matching the pattern")
+	positional, err := parseArgs(flags, args)
+	if err != nil || len(positional) != 1 {
+		return usageError("from-regex")
+	}
+
+	rules, err := Regex.Translate(positional[0], Regex.Options{Name: *name})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return writeOutput(*output, Regex.Format(rules))
+}
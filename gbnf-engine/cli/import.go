@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gbnflsp/gbnf-engine/Formats"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runImport(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "format to import from: "+strings.Join(Formats.ImportNames, ", ")+"; defaults to the file extension")
+	start := flags.String("start", "", "rule to translate into root; defaults to start for Lark and the first rule for EBNF")
+	output := flags.String("o", "", "write the grammar to this file instead of stdout")
+	positional, err := parseArgs(flags, args)
+	if err != nil || len(positional) != 1 {
+		return usageError("import")
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(positional[0]), ".")
+	}
+
+	data, err := os.ReadFile(positional[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	ast, errors, err := Formats.Import(string(data), *format, *start)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	for _, err := range errors {
+		fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", positional[0], err.Line+1, err.Column+1, err.Message)
+	}
+	if len(errors) > 0 {
+		return 1
+	}
+	return writeOutput(*output, GBNFParser.Format(ast))
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/Matcher"
+	"os"
+)
+
+func runNext(args []string) int {
+	flags := flag.NewFlagSet("next", flag.ContinueOnError)
+	prefix := flags.String("prefix", "", "text generated so far")
+	prefixFile := flags.String("prefix-file", "", "read the text generated so far from this file")
+	rule := flags.String("rule", "root", "rule the text should match")
+	positional, err := parseArgs(flags, args)
+	if err != nil || len(positional) != 1 || (*prefix != "" && *prefixFile != "") {
+		return usageError("next")
+	}
+	if *prefixFile != "" {
+		data, err := os.ReadFile(*prefixFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		*prefix = string(data)
+	}
+
+	grammar, ok := compileGrammar(positional[0])
+	if !ok {
+		return 1
+	}
+	prediction, err := Matcher.Predict(grammar, *rule, *prefix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", positional[0], err)
+		return 1
+	}
+
+	length := len([]rune(*prefix))
+	if prediction.Rejected {
+		rejected := []rune(*prefix)[prediction.Accepted]
+		fmt.Printf("rejected: %q at character %d; only the first %d of %d characters match\n", rejected, prediction.Accepted, prediction.Accepted, length)
+	} else {
+		fmt.Printf("accepted: all %d characters\n", length)
+	}
+	fmt.Printf("complete: %t\n", prediction.Complete)
+	if len(prediction.Next) > 0 {
+		fmt.Printf("next: %s\n", GBNFParser.FormatCharClass(prediction.Next, false))
+	} else {
+		fmt.Println("next: nothing")
+	}
+	if prediction.Forced != "" {
+		fmt.Printf("forced: %s\n", GBNFParser.QuoteLiteral(prediction.Forced))
+	}
+	if prediction.Rejected {
+		return 1
+	}
+	return 0
+}
+
+// compileGrammar loads the grammar at path with its imports and compiles it
+// for matching, printing any errors to stderr.
+func compileGrammar(path string) (*Matcher.Grammar, bool) {
+	root, imported, ok := loadGrammar(path)
+	if !ok {
+		return nil, false
+	}
+	flattened, errors := GBNFParser.Flatten(root, imported)
+	for _, err := range errors {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errors) > 0 {
+		return nil, false
+	}
+	grammar, err := Matcher.Compile(flattened)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return nil, false
+	}
+	return grammar, true
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gbnflsp/gbnf-engine/Analysis"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"os"
+	"text/tabwriter"
+)
+
+func runStats(args []string) int {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	maxDepth := flags.Int("max-depth", Analysis.DefaultThresholds.MaxDepth, "warn about rules nesting deeper than this; 0 disables the check")
+	maxSize := flags.Int("max-size", Analysis.DefaultThresholds.MaxExpandedSize, "warn about rules expanding to more elements than this; 0 disables the check")
+	maxFanOut := flags.Int("max-fan-out", Analysis.DefaultThresholds.MaxFanOut, "warn about alternatives with more branches than this; 0 disables the check")
+	positional, err := parseArgs(flags, args)
+	if err != nil || len(positional) != 1 {
+		return usageError("stats")
+	}
+
+	root, imported, ok := loadGrammar(positional[0])
+	if !ok {
+		return 1
+	}
+	flattened, errors := GBNFParser.Flatten(root, imported)
+	for _, err := range errors {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errors) > 0 {
+		return 1
+	}
+
+	thresholds := Analysis.Thresholds{MaxDepth: *maxDepth, MaxExpandedSize: *maxSize, MaxFanOut: *maxFanOut}
+	analysis := Analysis.Analyze(flattened)
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "rule\tdepth\texpanded size\tfan-out\trecursive")
+	for _, rule := range analysis.Rules() {
+		metrics := analysis.Metrics(rule)
+		recursive := "no"
+		if metrics.Recursive {
+			recursive = "yes"
+		}
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%s\n", rule, metrics.Depth, metrics.ExpandedSize, metrics.FanOut, recursive)
+		for _, warning := range metrics.Warnings(thresholds) {
+			fmt.Fprintf(os.Stderr, "%s: warning: rule `%s`: %s\n", positional[0], rule, warning)
+		}
+	}
+	table.Flush()
+	return 0
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"gbnflsp/gbnf-engine/Matcher"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fixtureResult is the outcome of matching one fixture file.
+type fixtureResult struct {
+	path   string
+	accept bool
+	// failure is empty if the fixture passed.
+	failure string
+}
+
+func runTest(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	rule := flags.String("rule", "root", "rule the fixtures are matched against")
+	junit := flags.String("junit", "", "also write the results as JUnit XML to this file")
+	positional, err := parseArgs(flags, args)
+	if err != nil || len(positional) != 2 {
+		return usageError("test")
+	}
+
+	grammar, ok := compileGrammar(positional[0])
+	if !ok {
+		return 1
+	}
+	if !grammar.HasRule(*rule) {
+		fmt.Fprintf(os.Stderr, "%s: rule `%s` is not declared\n", positional[0], *rule)
+		return 1
+	}
+	fixtures, err := findFixtures(positional[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	if len(fixtures) == 0 {
+		fmt.Fprintf(os.Stderr, "%s: no *.accept.txt or *.reject.txt fixtures found\n", positional[1])
+		return 1
+	}
+
+	results := []*fixtureResult{}
+	failed := 0
+	for _, path := range fixtures {
+		result, err := matchFixture(grammar, *rule, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		if result.failure != "" {
+			fmt.Printf("FAIL %s\n", result.failure)
+			failed++
+		} else {
+			fmt.Printf("ok   %s\n", path)
+		}
+		results = append(results, result)
+	}
+	fmt.Printf("%d passed, %d failed\n", len(results)-failed, failed)
+
+	if *junit != "" {
+		if code := writeOutput(*junit, junitReport(positional[0], results)); code != 0 {
+			return code
+		}
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// findFixtures returns the fixture files below dir in lexical order.
+func findFixtures(dir string) ([]string, error) {
+	fixtures := []string{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && (strings.HasSuffix(path, ".accept.txt") || strings.HasSuffix(path, ".reject.txt")) {
+			fixtures = append(fixtures, path)
+		}
+		return nil
+	})
+	sort.Strings(fixtures)
+	return fixtures, err
+}
+
+// matchFixture matches the content of a fixture against rule. One trailing
+// newline, \n or \r\n, is not part of the content, as editors end files with
+// one. A failing accept fixture is reported at the first character that does
+// not match, as `path:line:column: message`.
+func matchFixture(grammar *Matcher.Grammar, rule string, path string) (*fixtureResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	text := string(data)
+	if strings.HasSuffix(text, "\n") {
+		text = strings.TrimSuffix(text[:len(text)-1], "\r")
+	}
+	prediction, err := Matcher.Predict(grammar, rule, text)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &fixtureResult{path: path, accept: strings.HasSuffix(path, ".accept.txt")}
+	switch {
+	case result.accept && !prediction.FullMatch():
+		line, column := 1, 1
+		for _, char := range []rune(text)[:prediction.Accepted] {
+			if char == '\n' {
+				line, column = line+1, 1
+			} else {
+				column++
+			}
+		}
+		result.failure = fmt.Sprintf("%s:%d:%d: %s", path, line, column, prediction.Failure(text))
+	case !result.accept && prediction.FullMatch():
+		result.failure = fmt.Sprintf("%s: expected `%s` to reject the text, but it matches", path, rule)
+	}
+	return result, nil
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitReport writes the results as a JUnit XML report with one suite for
+// the grammar.
+func junitReport(grammarPath string, results []*fixtureResult) string {
+	suite := junitSuite{Name: grammarPath, Tests: len(results)}
+	for _, result := range results {
+		testCase := junitCase{Name: result.path, ClassName: "reject"}
+		if result.accept {
+			testCase.ClassName = "accept"
+		}
+		if result.failure != "" {
+			suite.Failures++
+			testCase.Failure = &junitFailure{Message: result.failure, Text: result.failure}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	data, _ := xml.MarshalIndent(junitTestSuites{Suites: []junitSuite{suite}}, "", "  ")
+	return xml.Header + string(data) + "\n"
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/JSONSchema"
+	"os"
+)
+
+func runToJSONSchema(args []string) int {
+	flags := flag.NewFlagSet("to-json-schema", flag.ContinueOnError)
+	output := flags.String("o", "", "write the schema to this file instead of stdout")
+	positional, err := parseArgs(flags, args)
+	if err != nil || len(positional) != 1 {
+		return usageError("to-json-schema")
+	}
+
+	root, imported, ok := loadGrammar(positional[0])
+	if !ok {
+		return 1
+	}
+	flattened, errors := GBNFParser.Flatten(root, imported)
+	for _, err := range errors {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errors) > 0 {
+		return 1
+	}
+
+	schema, unmapped := JSONSchema.Infer(flattened)
+	for _, message := range unmapped {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", positional[0], message)
+	}
+	if schema == nil {
+		return 1
+	}
+	return writeOutput(*output, JSONSchema.Pretty(schema))
+}
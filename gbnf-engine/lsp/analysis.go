@@ -0,0 +1,79 @@
+package lsp
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/Analysis"
+	"gbnflsp/gbnf-engine/GBNFParser"
+)
+
+// RuleAlternativesShouldNotOverlap warns about alternatives whose branches
+// can start with the same characters, which make constrained sampling
+// unpredictable. Grammars that do not compile are left to other rules.
+func RuleAlternativesShouldNotOverlap(uri string) []*Diagnostic {
+	file := lookupFile(uri)
+	flattened, err := flattenedGrammar(uri)
+	if err != nil {
+		return nil
+	}
+	ambiguities, err := Analysis.Analyze(flattened).Ambiguities(file.AST.Children)
+	if err != nil {
+		return nil
+	}
+
+	diags := []*Diagnostic{}
+	for _, ambiguity := range ambiguities {
+		token := ambiguity.Alternative.Token
+		example := GBNFParser.QuoteLiteral(ambiguity.Example)
+		first, second := ambiguity.First+1, ambiguity.Second+1
+		var message string
+		switch ambiguity.Kind {
+		case Analysis.SameMatch:
+			message = fmt.Sprintf("Alternatives %d and %d both match %s.", first, second, example)
+		case Analysis.PrefixMatch:
+			message = fmt.Sprintf("Alternative %d matches %s, which alternative %d can continue.", first, example, second)
+		default:
+			message = fmt.Sprintf("Alternatives %d and %d both start with %s.", first, second, example)
+		}
+		diags = append(diags, &Diagnostic{
+			Range: Range{
+				Start: Position{Line: token.Line, Character: token.Column},
+				End:   Position{Line: token.Line, Character: token.Column + len(token.Value)},
+			},
+			Message:  message,
+			Severity: 2,
+			Source:   SOURCE,
+		})
+	}
+	return diags
+}
+
+// RuleDeclarationsShouldBeCheapToSample warns about declarations whose metrics
+// exceed the configured complexity thresholds.
+func RuleDeclarationsShouldBeCheapToSample(uri string) []*Diagnostic {
+	file := lookupFile(uri)
+	flattened, err := flattenedGrammar(uri)
+	if err != nil {
+		return nil
+	}
+	analysis := Analysis.Analyze(flattened)
+	thresholds := complexityThresholds()
+
+	diags := []*Diagnostic{}
+	for _, node := range file.AST.Children {
+		if node.Type != GBNFParser.NodeDeclaration {
+			continue
+		}
+		for _, warning := range analysis.Metrics(node.Token.Value).Warnings(thresholds) {
+			diags = append(diags, &Diagnostic{
+				Range: Range{
+					Start: Position{Line: node.Token.Line, Character: node.Token.Column},
+					End:   Position{Line: node.Token.Line, Character: node.Token.Column + len(node.Token.Value)},
+				},
+				Message:  fmt.Sprintf("Rule `%s` may slow down sampling: %s.", node.Token.Value, warning),
+				Severity: 2,
+				Source:   SOURCE,
+			})
+		}
+	}
+	return diags
+}
@@ -0,0 +1,228 @@
+package lsp
+
+import (
+	"encoding/json"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/Regex"
+	"gbnflsp/gbnf-engine/Transform"
+	"regexp/syntax"
+	"strings"
+)
+
+// Code action kinds offered by the server.
+const (
+	CodeActionRefactorRewrite = "refactor.rewrite"
+	CodeActionRefactorInline  = "refactor.inline"
+	CodeActionRefactorExtract = "refactor.extract"
+	CodeActionQuickFix        = "quickfix"
+)
+
+type CodeActionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Range   Range `json:"range"`
+	Context struct {
+		Diagnostics []Diagnostic `json:"diagnostics"`
+		Only        []string     `json:"only,omitempty"`
+	} `json:"context"`
+}
+
+type CodeAction struct {
+	Title string         `json:"title"`
+	Kind  string         `json:"kind,omitempty"`
+	Edit  *WorkspaceEdit `json:"edit,omitempty"`
+	// Command runs after Edit is applied.
+	Command *Command `json:"command,omitempty"`
+}
+
+// codeActionProviders compute the code actions for a range of a document.
+var codeActionProviders = []func(uri string, file *OpenFile, params CodeActionParams) []CodeAction{
+	regexCodeActions,
+	inlineCodeActions,
+	extractCodeActions,
+	alternativeCodeActions,
+	duplicateCodeActions,
+}
+
+func handleTextDocumentCodeAction(request Request) {
+	var params CodeActionParams
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		sendError(request.ID, InvalidRequest, "Failed to unpack request.")
+		return
+	}
+
+	sendResponse(request.ID, CodeActions(params))
+}
+
+// CodeActions returns the code actions for a range of an open document, of
+// the kinds the client asked for.
+func CodeActions(params CodeActionParams) []CodeAction {
+	actions := []CodeAction{}
+	file := OpenFiles[params.TextDocument.URI]
+	if file == nil {
+		return actions
+	}
+	for _, provider := range codeActionProviders {
+		for _, action := range provider(params.TextDocument.URI, file, params) {
+			if kindRequested(action.Kind, params.Context.Only) {
+				actions = append(actions, action)
+			}
+		}
+	}
+	return actions
+}
+
+// kindRequested reports whether a code action of kind passes the kinds the
+// client asked for; `refactor` includes `refactor.rewrite`.
+func kindRequested(kind string, only []string) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, requested := range only {
+		if kind == requested || strings.HasPrefix(kind, requested+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// regexCodeActions offers to replace a string literal holding a regular
+// expression by the grammar matching the same strings. Named groups of the
+// expression become rules below the current declaration.
+func regexCodeActions(uri string, file *OpenFile, params CodeActionParams) []CodeAction {
+	index := tokenIndexInRange(file.Tokens, params.Range)
+	if index == -1 || file.Tokens[index].Type != GBNFParser.TokenString {
+		return nil
+	}
+	token := file.Tokens[index]
+	pattern, err := GBNFParser.UnescapeString(token.Value)
+	if err != nil {
+		return nil
+	}
+
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil || re.Op == syntax.OpLiteral && re.Flags&syntax.FoldCase == 0 || re.Op == syntax.OpEmptyMatch {
+		// Plain text is already the grammar it would translate to.
+		return nil
+	}
+
+	declaration := enclosingDeclaration(file.Tokens, index)
+	if declaration == -1 {
+		return nil
+	}
+	rules, err := Regex.Translate(pattern, Regex.Options{
+		Name:     file.Tokens[declaration].Value,
+		Anchored: true,
+		RuleName: func(name string) string { return Transform.UniqueName(file.AST, name) },
+	})
+	if err != nil {
+		return nil
+	}
+
+	expression := rules[0].Expression
+	if !isGrouped(expression) {
+		expression = "(" + expression + ")"
+	}
+	edits := []TextEdit{{
+		Range: Range{
+			Start: Position{Line: token.Line, Character: token.Column},
+			End:   Position{Line: token.EndLine, Character: token.EndColumn},
+		},
+		NewText: expression,
+	}}
+	if len(rules) > 1 {
+		position, prefix := declarationEnd(file, declaration)
+		edits = append(edits, TextEdit{
+			Range:   Range{Start: position, End: position},
+			NewText: prefix + Regex.Format(rules[1:]),
+		})
+	}
+
+	return []CodeAction{{
+		Title: "Replace regular expression with grammar",
+		Kind:  CodeActionRefactorRewrite,
+		Edit:  newWorkspaceEdit(map[string][]TextEdit{uri: edits}),
+	}}
+}
+
+// tokenIndexInRange returns the index of the token containing the range, or
+// -1 if there is none.
+func tokenIndexInRange(tokens []GBNFParser.Token, selection Range) int {
+	for index, token := range tokens {
+		if token.Type == GBNFParser.TokenEOL {
+			continue
+		}
+		start := Position{Line: token.Line, Character: token.Column}
+		end := Position{Line: token.EndLine, Character: token.EndColumn}
+		if !positionBefore(selection.Start, start) && !positionBefore(end, selection.End) {
+			return index
+		}
+	}
+	return -1
+}
+
+func positionBefore(a Position, b Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+}
+
+// enclosingDeclaration returns the index of the name of the declaration the
+// token at index belongs to, or -1 if there is none.
+func enclosingDeclaration(tokens []GBNFParser.Token, index int) int {
+	for current := index - 1; current >= 0; current-- {
+		if isDeclarationName(tokens, current) {
+			return current
+		}
+	}
+	return -1
+}
+
+func isDeclarationName(tokens []GBNFParser.Token, index int) bool {
+	return tokens[index].Type == GBNFParser.TokenIdentifier &&
+		index+1 < len(tokens) && tokens[index+1].Type == GBNFParser.TokenAssignment
+}
+
+// declarationEnd returns where rules belonging to the declaration whose name
+// is at index can be inserted: the line after its last token. prefix is
+// the text to insert first, a newline if the document does not end with one.
+func declarationEnd(file *OpenFile, index int) (position Position, prefix string) {
+	lastLine := file.Tokens[index].Line
+	for current := index + 2; current < len(file.Tokens) && !isDeclarationName(file.Tokens, current); current++ {
+		if file.Tokens[current].Type != GBNFParser.TokenEOL {
+			lastLine = file.Tokens[current].EndLine
+		}
+	}
+
+	lines := strings.Split(file.Text, "\n")
+	if lastLine+1 < len(lines) {
+		return Position{Line: lastLine + 1}, ""
+	}
+	return Position{Line: lastLine, Character: len([]rune(lines[lastLine]))}, "\n"
+}
+
+// isGrouped reports whether an expression is a single element, so it can
+// replace another without parentheses.
+func isGrouped(expression string) bool {
+	tokens := GBNFParser.NewLexer(expression).LexAllTokens()
+	if len(tokens) == 1 {
+		return true
+	}
+	if tokens[0].Value != "(" {
+		return false
+	}
+	depth := 0
+	for index, token := range tokens {
+		if token.Type != GBNFParser.TokenSubExpression {
+			continue
+		}
+		if token.Value == "(" {
+			depth++
+		} else {
+			depth--
+		}
+		if depth == 0 {
+			return index == len(tokens)-1
+		}
+	}
+	return false
+}
@@ -0,0 +1,366 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/JSONSchema"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Completion item kinds and insert text formats of the LSP specification.
+const (
+	CompletionKindVariable = 6
+	CompletionKindSnippet  = 15
+
+	InsertTextFormatSnippet = 2
+)
+
+type CompletionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position Position `json:"position"`
+}
+
+type CompletionItem struct {
+	Label            string `json:"label"`
+	Kind             int    `json:"kind,omitempty"`
+	Detail           string `json:"detail,omitempty"`
+	InsertText       string `json:"insertText,omitempty"`
+	InsertTextFormat int    `json:"insertTextFormat,omitempty"`
+	// SortText orders the items, most relevant first.
+	SortText string `json:"sortText,omitempty"`
+	// AdditionalTextEdits are applied along with the completion, such as the
+	// declarations of a library rule.
+	AdditionalTextEdits []TextEdit `json:"additionalTextEdits,omitempty"`
+}
+
+type CompletionList struct {
+	IsIncomplete bool             `json:"isIncomplete"`
+	Items        []CompletionItem `json:"items"`
+}
+
+type completionContext int
+
+const (
+	// completeNothing is for positions where no suggestion makes sense, such
+	// as strings, comments and rule names being declared.
+	completeNothing completionContext = iota
+	// completeDeclaration is for the start of a new rule.
+	completeDeclaration
+	// completeExpression is for the body of a rule.
+	completeExpression
+)
+
+// terminalSnippets are offered in rule bodies, in this order.
+var terminalSnippets = []struct {
+	label   string
+	snippet string
+	detail  string
+}{
+	{`"..."`, `"$1"`, "String literal"},
+	{`[a-z]+`, `[${1:a-z}]+`, "Character class"},
+	{`[0-9]+`, `[${1:0-9}]+`, "Digits"},
+	{`[^"]*`, `[^${1:"}]*`, "Negated character class"},
+	{`( ... )`, `($1)`, "Group"},
+}
+
+func handleTextDocumentCompletion(request Request) {
+	var params CompletionParams
+	err := json.Unmarshal(request.Params, &params)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to unmarshal completion params: %v\n", err)
+		return
+	}
+
+	sendResponse(request.ID, CompletionList{
+		IsIncomplete: false,
+		Items:        CompletionItems(params.TextDocument.URI, params.Position),
+	})
+}
+
+// CompletionItems returns the suggestions for position in the open document
+// uri, depending on what may be written there.
+func CompletionItems(uri string, position Position) []CompletionItem {
+	file := OpenFiles[uri]
+	if file == nil {
+		return []CompletionItem{}
+	}
+
+	switch completionContextAt(file, position) {
+	case completeDeclaration:
+		return declarationCompletions(uri, file)
+	case completeExpression:
+		return expressionCompletions(uri, file)
+	default:
+		return []CompletionItem{}
+	}
+}
+
+// completionContextAt works out what may be written at position from the
+// tokens before it.
+func completionContextAt(file *OpenFile, position Position) completionContext {
+	if insideLiteral(file.Tokens, position) || insideComment(file, position) {
+		return completeNothing
+	}
+
+	// The tokens are split at position. The word being typed, if any, is
+	// replaced by the completion and belongs to neither side.
+	split := 0
+	for split < len(file.Tokens) && endsBefore(file.Tokens[split], position) {
+		split++
+	}
+	before, after := file.Tokens[:split], file.Tokens[split:]
+	if len(before) > 0 && before[len(before)-1].Type == GBNFParser.TokenIdentifier && endsAt(before[len(before)-1], position) {
+		before = before[:len(before)-1]
+	}
+
+	if len(after) > 0 && after[0].Line == position.Line && after[0].Type == GBNFParser.TokenAssignment {
+		// The name of a declaration.
+		return completeNothing
+	}
+	if inRuleBody(before) {
+		return completeExpression
+	}
+	if len(before) == 0 || before[len(before)-1].Type == GBNFParser.TokenEOL {
+		return completeDeclaration
+	}
+	return completeNothing
+}
+
+func endsBefore(token GBNFParser.Token, position Position) bool {
+	return token.EndLine < position.Line || token.EndLine == position.Line && token.EndColumn <= position.Character
+}
+
+func endsAt(token GBNFParser.Token, position Position) bool {
+	return token.EndLine == position.Line && token.EndColumn == position.Character
+}
+
+// insideLiteral tells whether position is inside a string, a character class,
+// a repetition or an import path. Unterminated ones run to the end of the
+// line.
+func insideLiteral(tokens []GBNFParser.Token, position Position) bool {
+	for _, token := range tokens {
+		switch token.Type {
+		case GBNFParser.TokenString, GBNFParser.TokenRegexp, GBNFParser.TokenRepeat, GBNFParser.TokenImport:
+		default:
+			continue
+		}
+		if token.Line != position.Line || token.Column >= position.Character {
+			continue
+		}
+		if token.Error != "" || token.EndLine != token.Line || position.Character < token.EndColumn {
+			return true
+		}
+	}
+	return false
+}
+
+// insideComment tells whether a `#` outside of literals comes before position
+// on its line. The lexer drops comments, so the text is searched instead.
+func insideComment(file *OpenFile, position Position) bool {
+	lines := strings.Split(file.Text, "\n")
+	if position.Line >= len(lines) {
+		return false
+	}
+	line := []rune(lines[position.Line])
+	for column := 0; column < position.Character && column < len(line); column++ {
+		if line[column] == '#' && !insideLiteral(file.Tokens, Position{Line: position.Line, Character: column + 1}) {
+			return true
+		}
+	}
+	return false
+}
+
+// inRuleBody tells whether the tokens end inside the body of a declaration.
+// Like in llama.cpp, a body continues on the next line after `::=`, after `|`
+// and inside parentheses.
+func inRuleBody(tokens []GBNFParser.Token) bool {
+	inBody, depth := false, 0
+	var previous GBNFParser.TokenType
+	for _, token := range tokens {
+		switch token.Type {
+		case GBNFParser.TokenAssignment:
+			inBody, depth = true, 0
+		case GBNFParser.TokenSubExpression:
+			if token.Value == "(" {
+				depth++
+			} else {
+				depth--
+			}
+		case GBNFParser.TokenEOL:
+			if depth <= 0 && previous != GBNFParser.TokenAlternative && previous != GBNFParser.TokenAssignment {
+				inBody = false
+			}
+			continue
+		}
+		previous = token.Type
+	}
+	return inBody
+}
+
+// declarationCompletions suggests declaring the rules that are used but not
+// declared, most used first, then any rule.
+func declarationCompletions(uri string, file *OpenFile) []CompletionItem {
+	declared := declaredRules(uri, file)
+	counts := referenceCounts(uri, file)
+	undeclared := []string{}
+	for name := range counts {
+		if !declared[name] {
+			undeclared = append(undeclared, name)
+		}
+	}
+	if !declared["root"] {
+		undeclared = append(undeclared, "root")
+	}
+	sortByUsage(undeclared, counts)
+
+	items := []CompletionItem{}
+	for index, name := range undeclared {
+		items = append(items, CompletionItem{
+			Label:            name + " ::= ",
+			Kind:             CompletionKindSnippet,
+			Detail:           "Declare rule",
+			InsertText:       name + " ::= $0",
+			InsertTextFormat: InsertTextFormatSnippet,
+			SortText:         fmt.Sprintf("0-%04d", index),
+		})
+	}
+	items = append(items, CompletionItem{
+		Label:            "name ::= ",
+		Kind:             CompletionKindSnippet,
+		Detail:           "Declare a new rule",
+		InsertText:       "${1:name} ::= $0",
+		InsertTextFormat: InsertTextFormatSnippet,
+		SortText:         "1",
+	})
+	return items
+}
+
+// expressionCompletions suggests the declared rules, most used first, then
+// terminals and the library rules that are not declared yet.
+func expressionCompletions(uri string, file *OpenFile) []CompletionItem {
+	declared := declaredRules(uri, file)
+	counts := referenceCounts(uri, file)
+	names := make([]string, 0, len(declared))
+	for name := range declared {
+		names = append(names, name)
+	}
+	sortByUsage(names, counts)
+
+	items := []CompletionItem{}
+	for index, name := range names {
+		items = append(items, CompletionItem{
+			Label:      name,
+			Kind:       CompletionKindVariable,
+			Detail:     "Rule",
+			InsertText: name,
+			SortText:   fmt.Sprintf("0-%04d", index),
+		})
+	}
+	for index, terminal := range terminalSnippets {
+		items = append(items, CompletionItem{
+			Label:            terminal.label,
+			Kind:             CompletionKindSnippet,
+			Detail:           terminal.detail,
+			InsertText:       terminal.snippet,
+			InsertTextFormat: InsertTextFormatSnippet,
+			SortText:         fmt.Sprintf("1-%04d", index),
+		})
+	}
+	for index, name := range JSONSchema.PrimitiveRuleNames() {
+		if declared[name] {
+			continue
+		}
+		items = append(items, CompletionItem{
+			Label:               name,
+			Kind:                CompletionKindVariable,
+			Detail:              "Library rule",
+			InsertText:          name,
+			SortText:            fmt.Sprintf("2-%04d", index),
+			AdditionalTextEdits: []TextEdit{libraryRuleEdit(file, name, declared)},
+		})
+	}
+	return items
+}
+
+// libraryRuleEdit appends the declarations of the library rule name and of
+// the library rules it needs that are not declared yet.
+func libraryRuleEdit(file *OpenFile, name string, declared map[string]bool) TextEdit {
+	added := map[string]bool{}
+	declarations := []string{}
+	var add func(name string)
+	add = func(name string) {
+		if declared[name] || added[name] {
+			return
+		}
+		added[name] = true
+		body, dependencies, _ := JSONSchema.PrimitiveRule(name)
+		declarations = append(declarations, name+" ::= "+body+"\n")
+		for _, dependency := range dependencies {
+			add(dependency)
+		}
+	}
+	add(name)
+
+	lines := strings.Split(file.Text, "\n")
+	end := Position{Line: len(lines) - 1, Character: len([]rune(lines[len(lines)-1]))}
+	text := strings.Join(declarations, "")
+	if end.Character > 0 {
+		text = "\n" + text
+	}
+	return TextEdit{Range: Range{Start: end, End: end}, NewText: text}
+}
+
+// declaredRules returns the rules declared in the document uri and in the
+// files it imports. The tokens are used rather than the AST, as a document
+// being edited often does not parse.
+func declaredRules(uri string, file *OpenFile) map[string]bool {
+	declared := map[string]bool{}
+	for _, tokens := range completionTokens(uri, file) {
+		for index, token := range tokens {
+			if isDeclarationName(tokens, index) {
+				declared[token.Value] = true
+			}
+		}
+	}
+	return declared
+}
+
+// referenceCounts counts the references to each rule in the document uri and
+// in the files it imports.
+func referenceCounts(uri string, file *OpenFile) map[string]int {
+	counts := map[string]int{}
+	for _, tokens := range completionTokens(uri, file) {
+		for index, token := range tokens {
+			if token.Type == GBNFParser.TokenIdentifier && !isDeclarationName(tokens, index) {
+				counts[token.Value]++
+			}
+		}
+	}
+	return counts
+}
+
+// completionTokens returns the tokens of the document uri and of the files it
+// imports.
+func completionTokens(uri string, file *OpenFile) [][]GBNFParser.Token {
+	tokens := [][]GBNFParser.Token{file.Tokens}
+	imported, _ := resolveImports(uri)
+	for _, importedFile := range imported {
+		tokens = append(tokens, importedFile.Tokens)
+	}
+	return tokens
+}
+
+// sortByUsage sorts names by decreasing reference count, then by name.
+func sortByUsage(names []string, counts map[string]int) {
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+}
@@ -4,23 +4,80 @@ import (
 	"encoding/json"
 	"fmt"
 	"gbnflsp/gbnf-engine/GBNFParser"
+	"hash/fnv"
 	"slices"
+	"time"
 )
 
 type Diagnostic struct {
-	Range    Range  `json:"range"`
-	Message  string `json:"message"`
-	Severity int    `json:"severity"`
-	Source   string `json:"source,omitempty"`
+	Range              Range                          `json:"range"`
+	Message            string                         `json:"message"`
+	Severity           int                            `json:"severity"`
+	Source             string                         `json:"source,omitempty"`
+	RelatedInformation []DiagnosticRelatedInformation `json:"relatedInformation,omitempty"`
+}
+
+type DiagnosticRelatedInformation struct {
+	Location Location `json:"location"`
+	Message  string   `json:"message"`
 }
 
 type PublishDiagnosticsParams struct {
 	URI         string        `json:"uri"`
+	Version     int           `json:"version"`
 	Diagnostics []*Diagnostic `json:"diagnostics"`
 }
 
 const SOURCE = "gbnf-lsp"
 
+// DiagnosticsDelay is the quiet period after the last change to a document
+// before its diagnostics are computed.
+var DiagnosticsDelay = 200 * time.Millisecond
+
+// diagnosticTimers holds the pending diagnostics of each document. It is
+// guarded by serverMutex, also in the timer functions.
+var diagnosticTimers = map[string]*time.Timer{}
+
+// scheduleDiagnostics publishes diagnostics for version of uri once no newer
+// change has arrived for DiagnosticsDelay. Must be called with serverMutex
+// held.
+func scheduleDiagnostics(uri string, version int) {
+	cancelDiagnostics(uri)
+	if clientCapabilities.TextDocument.Diagnostic != nil {
+		// The client pulls diagnostics itself; pushing them too would show
+		// every problem twice.
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(DiagnosticsDelay, func() {
+		serverMutex.Lock()
+		defer serverMutex.Unlock()
+
+		// A timer that fired while waiting for the mutex may have been
+		// cancelled or replaced in the meantime, even by one for the same
+		// version after the document was closed and reopened.
+		if diagnosticTimers[uri] != timer {
+			return
+		}
+		delete(diagnosticTimers, uri)
+		file, ok := OpenFiles[uri]
+		if !ok || file.Version != version {
+			return
+		}
+		sendDiagnostics(uri)
+	})
+	diagnosticTimers[uri] = timer
+}
+
+// cancelDiagnostics drops pending diagnostics for uri. Must be called with
+// serverMutex held.
+func cancelDiagnostics(uri string) {
+	if timer, ok := diagnosticTimers[uri]; ok {
+		timer.Stop()
+		delete(diagnosticTimers, uri)
+	}
+}
+
 func sendDiagnostics(uri string) {
 	diags := createDiagnostics(uri)
 	msg := map[string]interface{}{
@@ -28,16 +85,154 @@ func sendDiagnostics(uri string) {
 		"method":  "textDocument/publishDiagnostics",
 		"params": PublishDiagnosticsParams{
 			URI:         uri,
+			Version:     OpenFiles[uri].Version,
 			Diagnostics: diags,
 		},
 	}
 
 	data, _ := json.Marshal(msg)
-	fmt.Printf("Content-Length: %d\r\n\r\n%s", len(data), data)
+	writeMessage(data)
+}
+
+type DocumentDiagnosticParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	PreviousResultID string `json:"previousResultId"`
+}
+
+type FullDocumentDiagnosticReport struct {
+	Kind     string        `json:"kind"`
+	ResultID string        `json:"resultId"`
+	Items    []*Diagnostic `json:"items"`
+}
+
+type UnchangedDocumentDiagnosticReport struct {
+	Kind     string `json:"kind"`
+	ResultID string `json:"resultId"`
+}
+
+func handleTextDocumentDiagnostic(request Request) {
+	var params DocumentDiagnosticParams
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		sendError(request.ID, InvalidRequest, "Failed to unpack request.")
+		return
+	}
+
+	uri := params.TextDocument.URI
+	file := lookupFile(uri)
+	if file == nil {
+		loadedURI, err := loadWorkspaceFile(uriToPath(uri))
+		if err != nil {
+			sendResponse(request.ID, FullDocumentDiagnosticReport{Kind: "full", Items: []*Diagnostic{}})
+			return
+		}
+		uri = loadedURI
+		file = lookupFile(uri)
+	}
+
+	resultID := DiagnosticResultID(uri)
+	if params.PreviousResultID == resultID {
+		sendResponse(request.ID, UnchangedDocumentDiagnosticReport{Kind: "unchanged", ResultID: resultID})
+		return
+	}
+	sendResponse(request.ID, FullDocumentDiagnosticReport{
+		Kind:     "full",
+		ResultID: resultID,
+		Items:    createDiagnostics(uri),
+	})
+}
+
+type WorkspaceDiagnosticParams struct {
+	PreviousResultIDs []struct {
+		URI   string `json:"uri"`
+		Value string `json:"value"`
+	} `json:"previousResultIds"`
+}
+
+type WorkspaceFullDocumentDiagnosticReport struct {
+	FullDocumentDiagnosticReport
+	URI     string `json:"uri"`
+	Version *int   `json:"version"`
+}
+
+type WorkspaceUnchangedDocumentDiagnosticReport struct {
+	UnchangedDocumentDiagnosticReport
+	URI     string `json:"uri"`
+	Version *int   `json:"version"`
+}
+
+type WorkspaceDiagnosticReport struct {
+	Items []any `json:"items"`
+}
+
+func handleWorkspaceDiagnostic(request Request) {
+	var params WorkspaceDiagnosticParams
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		sendError(request.ID, InvalidRequest, "Failed to unpack request.")
+		return
+	}
+	previousResultIDs := map[string]string{}
+	for _, previous := range params.PreviousResultIDs {
+		previousResultIDs[previous.URI] = previous.Value
+	}
+
+	report := WorkspaceDiagnosticReport{Items: []any{}}
+	for _, indexedURI := range indexedURIs() {
+		var version *int
+		uri, isOpen := openURIForPath(uriToPath(indexedURI))
+		if isOpen {
+			version = &OpenFiles[uri].Version
+		} else {
+			uri = indexedURI
+		}
+
+		resultID := DiagnosticResultID(uri)
+		if previousResultIDs[uri] == resultID {
+			report.Items = append(report.Items, WorkspaceUnchangedDocumentDiagnosticReport{
+				UnchangedDocumentDiagnosticReport: UnchangedDocumentDiagnosticReport{Kind: "unchanged", ResultID: resultID},
+				URI:                               uri,
+				Version:                           version,
+			})
+			continue
+		}
+		report.Items = append(report.Items, WorkspaceFullDocumentDiagnosticReport{
+			FullDocumentDiagnosticReport: FullDocumentDiagnosticReport{
+				Kind:     "full",
+				ResultID: resultID,
+				Items:    createDiagnostics(uri),
+			},
+			URI:     uri,
+			Version: version,
+		})
+	}
+
+	sendResponse(request.ID, report)
+}
+
+// DiagnosticResultID identifies the diagnostics of a file. Diagnostics
+// depend on the text of the file, the files it imports, whether other files
+// import it and the settings, so the result ID hashes all of them.
+func DiagnosticResultID(uri string) string {
+	hash := fnv.New64a()
+	encodedSettings, _ := json.Marshal(settings)
+	hash.Write(encodedSettings)
+	hash.Write([]byte{0})
+	if isImported(uri) {
+		hash.Write([]byte("imported"))
+	}
+	hash.Write([]byte{0})
+	hash.Write([]byte(lookupFile(uri).Text))
+	imported, _ := resolveImports(uri)
+	for _, file := range imported {
+		hash.Write([]byte{0})
+		hash.Write([]byte(file.Text))
+	}
+	return fmt.Sprintf("%x", hash.Sum64())
 }
 
 func createDiagnostics(uri string) []*Diagnostic {
-	file := OpenFiles[uri]
+	file := lookupFile(uri)
 	errors := file.ParserErrors
 	diags := []*Diagnostic{}
 	for _, err := range errors {
@@ -58,9 +253,15 @@ func createDiagnostics(uri string) []*Diagnostic {
 		})
 	}
 
+	diags = appendIfNotNil(diags, RuleImportsMustResolve(uri)...)
 	diags = appendIfNotNil(diags, RuleMustIncludeRoot(uri))
 	diags = appendIfNotNil(diags, RuleMustDefineAllVariables(uri)...)
 	diags = appendIfNotNil(diags, RuleMustUseAllVariables(uri)...)
+	diags = appendIfNotNil(diags, RuleMustDeclareVariablesOnce(uri)...)
+	diags = appendIfNotNil(diags, RuleTestsMustPass(uri)...)
+	diags = appendIfNotNil(diags, RuleAlternativesShouldNotOverlap(uri)...)
+	diags = appendIfNotNil(diags, RuleDeclarationsShouldBeCheapToSample(uri)...)
+	diags = appendIfNotNil(diags, RuleRepeatsShouldHaveSensibleBounds(uri)...)
 	debugLogger.Printf("Found error: %v", diags)
 
 	return diags
@@ -74,8 +275,14 @@ func appendIfNotNil[T any](slice []*T, values ...*T) []*T {
 	}
 	return slice
 }
+
+// RuleMustIncludeRoot reports a grammar without a `root` rule, unless other
+// grammars import it.
 func RuleMustIncludeRoot(uri string) *Diagnostic {
-	file := OpenFiles[uri]
+	if isImported(uri) {
+		return nil
+	}
+	file := lookupFile(uri)
 	for _, node := range file.AST.Children {
 		if node.Type == GBNFParser.NodeDeclaration && node.Token.Value == "root" {
 			return nil
@@ -95,13 +302,8 @@ func RuleMustIncludeRoot(uri string) *Diagnostic {
 }
 
 func RuleMustDefineAllVariables(uri string) []*Diagnostic {
-	file := OpenFiles[uri]
-	nodeNames := []string{}
-	for _, node := range file.AST.Children {
-		if node.Type == GBNFParser.NodeDeclaration {
-			nodeNames = append(nodeNames, node.Token.Value)
-		}
-	}
+	file := lookupFile(uri)
+	nodeNames := append(declaredRuleNames(file.AST), importedRuleNames(uri)...)
 	undefinedNodes := []*Diagnostic{}
 	for _, node := range file.AST.Children {
 		undefinedNodes = append(undefinedNodes, recursiveUndefinedNodeSearch(node, nodeNames)...)
@@ -136,8 +338,13 @@ func recursiveUndefinedNodeSearch(node *GBNFParser.Node, targetNames []string) [
 
 }
 
+// RuleMustUseAllVariables warns about rules no other rule uses, unless other
+// grammars import them.
 func RuleMustUseAllVariables(uri string) []*Diagnostic {
-	file := OpenFiles[uri]
+	if isImported(uri) {
+		return nil
+	}
+	file := lookupFile(uri)
 	declared := map[string]*GBNFParser.Node{}
 	used := map[string]bool{}
 
@@ -184,3 +391,58 @@ func markUsedIdentifiers(node *GBNFParser.Node, used map[string]bool) {
 		markUsedIdentifiers(child, used)
 	}
 }
+
+// RuleMustDeclareVariablesOnce warns about every declaration of a rule that
+// is declared more than once, pointing to the other declarations. llama.cpp
+// only uses the effective declaration, which is rarely what was meant.
+func RuleMustDeclareVariablesOnce(uri string) []*Diagnostic {
+	file := lookupFile(uri)
+	declared := map[string][]*GBNFParser.Token{}
+	for _, node := range file.AST.Children {
+		if node.Type == GBNFParser.NodeDeclaration {
+			declared[node.Token.Value] = append(declared[node.Token.Value], node.Token)
+		}
+	}
+	effective := map[string]*GBNFParser.Token{}
+	for _, node := range GBNFParser.EffectiveDeclarations(file.AST) {
+		effective[node.Token.Value] = node.Token
+	}
+
+	diags := []*Diagnostic{}
+	for _, node := range file.AST.Children {
+		if node.Type != GBNFParser.NodeDeclaration || len(declared[node.Token.Value]) < 2 {
+			continue
+		}
+		name, tokens := node.Token.Value, declared[node.Token.Value]
+		used := effective[name]
+		message := fmt.Sprintf("Rule `%s` is declared %d times; llama.cpp only uses the declaration on line %d.", name, len(tokens), used.Line+1)
+		if node.Token == used {
+			message = fmt.Sprintf("Rule `%s` is declared %d times; llama.cpp only uses this declaration.", name, len(tokens))
+		}
+
+		related := []DiagnosticRelatedInformation{}
+		for _, token := range tokens {
+			if token != node.Token {
+				related = append(related, DiagnosticRelatedInformation{
+					Location: Location{URI: uri, Range: tokenRange(token)},
+					Message:  fmt.Sprintf("Other declaration of `%s`", name),
+				})
+			}
+		}
+		diags = append(diags, &Diagnostic{
+			Range:              tokenRange(node.Token),
+			Message:            message,
+			Severity:           2,
+			Source:             SOURCE,
+			RelatedInformation: related,
+		})
+	}
+	return diags
+}
+
+func tokenRange(token *GBNFParser.Token) Range {
+	return Range{
+		Start: Position{Line: token.Line, Character: token.Column},
+		End:   Position{Line: token.Line, Character: token.Column + len(token.Value)},
+	}
+}
@@ -0,0 +1,208 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/Matcher"
+)
+
+// Commands the server executes for the client.
+const (
+	CommandRunTest  = "gbnf.runTest"
+	CommandRunTests = "gbnf.runTests"
+)
+
+// testResult is the outcome of a test pragma.
+type testResult struct {
+	test    *GBNFParser.GrammarTest
+	passed  bool
+	message string
+}
+
+// runGrammarTests runs the test pragmas of uri. Nothing is run if the
+// grammar has syntax errors, as those are reported already.
+func runGrammarTests(uri string) ([]*testResult, []*GBNFParser.ParseError) {
+	file := lookupFile(uri)
+	if file == nil {
+		return nil, nil
+	}
+	tests, errors := GBNFParser.ParseTests(file.Text)
+	if len(tests) == 0 || len(file.ParserErrors) > 0 {
+		return nil, errors
+	}
+
+	grammar, err := compiledGrammar(uri)
+	results := []*testResult{}
+	for _, test := range tests {
+		results = append(results, runGrammarTest(grammar, err, test))
+	}
+	return results, errors
+}
+
+func runGrammarTest(grammar *Matcher.Grammar, compileErr error, test *GBNFParser.GrammarTest) *testResult {
+	if compileErr != nil {
+		return &testResult{test: test, message: "cannot run test: " + compileErr.Error()}
+	}
+	prediction, err := Matcher.Predict(grammar, test.Rule, test.Text)
+	if err != nil {
+		return &testResult{test: test, message: "cannot run test: " + err.Error()}
+	}
+
+	switch {
+	case test.Accept && !prediction.FullMatch():
+		return &testResult{test: test, message: fmt.Sprintf("expected `%s` to accept the text, but %s", test.Rule, prediction.Failure(test.Text))}
+	case !test.Accept && prediction.FullMatch():
+		return &testResult{test: test, message: fmt.Sprintf("expected `%s` to reject the text, but it matches", test.Rule)}
+	}
+	return &testResult{test: test, passed: true}
+}
+
+func testRange(test *GBNFParser.GrammarTest) Range {
+	return Range{
+		Start: Position{Line: test.Line, Character: test.Column},
+		End:   Position{Line: test.Line, Character: test.EndColumn},
+	}
+}
+
+// RuleTestsMustPass reports malformed and failing test pragmas.
+func RuleTestsMustPass(uri string) []*Diagnostic {
+	results, errors := runGrammarTests(uri)
+	diags := []*Diagnostic{}
+	for _, err := range errors {
+		diags = append(diags, &Diagnostic{
+			Range: Range{
+				Start: Position{Line: err.Line, Character: err.Column},
+				End:   Position{Line: err.Line, Character: err.Column + err.Length},
+			},
+			Message:  err.Message,
+			Severity: 1,
+			Source:   SOURCE,
+		})
+	}
+	for _, result := range results {
+		if !result.passed {
+			diags = append(diags, &Diagnostic{
+				Range:    testRange(result.test),
+				Message:  result.message,
+				Severity: 1,
+				Source:   SOURCE,
+			})
+		}
+	}
+	return diags
+}
+
+type CodeLensParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+}
+
+type Command struct {
+	Title     string `json:"title"`
+	Command   string `json:"command"`
+	Arguments []any  `json:"arguments,omitempty"`
+}
+
+type CodeLens struct {
+	Range   Range    `json:"range"`
+	Command *Command `json:"command,omitempty"`
+}
+
+// handleTextDocumentCodeLens shows a summary above the first test pragma and
+// a runner above each of them.
+func handleTextDocumentCodeLens(request Request) {
+	var params CodeLensParams
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		sendError(request.ID, InvalidRequest, "Failed to unpack request.")
+		return
+	}
+
+	uri := params.TextDocument.URI
+	results, _ := runGrammarTests(uri)
+	lenses := []CodeLens{}
+	if len(results) > 0 {
+		lenses = append(lenses, CodeLens{
+			Range:   testRange(results[0].test),
+			Command: &Command{Title: testSummary(results), Command: CommandRunTests, Arguments: []any{uri}},
+		})
+	}
+	for _, result := range results {
+		lenses = append(lenses, CodeLens{
+			Range:   testRange(result.test),
+			Command: &Command{Title: "Run test", Command: CommandRunTest, Arguments: []any{uri, result.test.Line}},
+		})
+	}
+	sendResponse(request.ID, lenses)
+}
+
+// testSummary counts passed and failed tests, such as "✓ 3 passed".
+func testSummary(results []*testResult) string {
+	failed := 0
+	for _, result := range results {
+		if !result.passed {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return fmt.Sprintf("✓ %d passed", len(results))
+	}
+	return fmt.Sprintf("✗ %d failed, %d passed", failed, len(results)-failed)
+}
+
+type ExecuteCommandParams struct {
+	Command   string            `json:"command"`
+	Arguments []json.RawMessage `json:"arguments"`
+}
+
+// handleWorkspaceExecuteCommand runs tests for the CodeLenses and shows the
+// outcome as a message.
+func handleWorkspaceExecuteCommand(request Request) {
+	var params ExecuteCommandParams
+	var uri string
+	if err := json.Unmarshal(request.Params, &params); err != nil || len(params.Arguments) == 0 ||
+		json.Unmarshal(params.Arguments[0], &uri) != nil {
+		sendError(request.ID, InvalidRequest, "Failed to unpack request.")
+		return
+	}
+
+	results, _ := runGrammarTests(uri)
+	switch params.Command {
+	case CommandRunTests:
+		if len(results) == 0 {
+			showMessage(MessageTypeInfo, "No tests to run.")
+		} else {
+			showMessage(testMessageType(results), testSummary(results))
+		}
+	case CommandRunTest:
+		var line int
+		if len(params.Arguments) < 2 || json.Unmarshal(params.Arguments[1], &line) != nil {
+			sendError(request.ID, InvalidRequest, "Failed to unpack request.")
+			return
+		}
+		for _, result := range results {
+			if result.test.Line != line {
+				continue
+			}
+			message := fmt.Sprintf("✓ Test on line %d passed.", line+1)
+			if !result.passed {
+				message = fmt.Sprintf("✗ Test on line %d failed: %s.", line+1, result.message)
+			}
+			showMessage(testMessageType([]*testResult{result}), message)
+		}
+	default:
+		sendError(request.ID, InvalidRequest, fmt.Sprintf("Unknown command %s.", params.Command))
+		return
+	}
+	sendResponse(request.ID, nil)
+}
+
+func testMessageType(results []*testResult) int {
+	for _, result := range results {
+		if !result.passed {
+			return MessageTypeError
+		}
+	}
+	return MessageTypeInfo
+}
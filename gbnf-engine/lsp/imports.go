@@ -0,0 +1,109 @@
+package lsp
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"path/filepath"
+)
+
+// resolveImports returns the grammars imported by uri, directly or
+// transitively. Open and indexed files are used before reading from disk.
+func resolveImports(uri string) ([]*GBNFParser.GrammarFile, []*GBNFParser.ImportError) {
+	file := lookupFile(uri)
+	if file == nil || len(GBNFParser.GetImports(file.AST)) == 0 {
+		return nil, nil
+	}
+
+	resolver := GBNFParser.ImportResolver{Load: loadGrammarFile}
+	return resolver.Resolve(asGrammarFile(uri, file))
+}
+
+func loadGrammarFile(path string) (*GBNFParser.GrammarFile, error) {
+	if file := lookupFile(grammarFileURI(path)); file != nil {
+		return asGrammarFile(grammarFileURI(path), file), nil
+	}
+	return GBNFParser.ReadGrammarFile(path)
+}
+
+// grammarFileURI returns the URI of the grammar at path, preferring the URI
+// under which the client opened it.
+func grammarFileURI(path string) string {
+	if uri, ok := openURIForPath(path); ok {
+		return uri
+	}
+	return pathToURI(path)
+}
+
+func asGrammarFile(uri string, file *OpenFile) *GBNFParser.GrammarFile {
+	return &GBNFParser.GrammarFile{
+		Path:   uriToPath(uri),
+		Text:   file.Text,
+		Tokens: file.Tokens,
+		AST:    file.AST,
+		Errors: file.ParserErrors,
+	}
+}
+
+// isImported reports whether another known grammar imports uri, directly or
+// transitively. Such a grammar is a library: it needs no `root` and its rules
+// are used by the grammars importing it.
+func isImported(uri string) bool {
+	path := filepath.Clean(uriToPath(uri))
+	for _, candidate := range workspaceGrammarURIs() {
+		if filepath.Clean(uriToPath(candidate)) == path {
+			continue
+		}
+		if imported, _ := resolveImports(candidate); containsPath(imported, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// importedRuleNames returns the names of the rules declared in the grammars
+// imported by uri.
+func importedRuleNames(uri string) []string {
+	imported, _ := resolveImports(uri)
+	names := []string{}
+	for _, file := range imported {
+		names = append(names, declaredRuleNames(file.AST)...)
+	}
+	return names
+}
+
+// declaredRuleNames returns the names of the rules declared in ast.
+func declaredRuleNames(ast *GBNFParser.Node) []string {
+	names := []string{}
+	if ast == nil {
+		return names
+	}
+	for _, node := range ast.Children {
+		if node.Type == GBNFParser.NodeDeclaration {
+			names = append(names, node.Token.Value)
+		}
+	}
+	return names
+}
+
+func RuleImportsMustResolve(uri string) []*Diagnostic {
+	_, errors := resolveImports(uri)
+	path := uriToPath(uri)
+	diags := []*Diagnostic{}
+	for _, err := range errors {
+		message := err.Message
+		if err.Path != path {
+			message = fmt.Sprintf("In imported file %s: %s", displayPath(pathToURI(err.Path)), err.Message)
+		}
+		diags = append(diags, &Diagnostic{
+			Range: Range{
+				Start: Position{Line: err.Via.Line, Character: err.Via.Column},
+				// The path is quoted.
+				End: Position{Line: err.Via.Line, Character: err.Via.Column + len(err.Via.Value) + 2},
+			},
+			Message:  message,
+			Severity: 1,
+			Source:   SOURCE,
+		})
+	}
+	return diags
+}
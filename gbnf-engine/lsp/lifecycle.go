@@ -1,8 +1,116 @@
 package lsp
 
-import "os"
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type serverState int
+
+const (
+	// stateUninitialized is the state before the initialize request. Only
+	// initialize and exit are accepted.
+	stateUninitialized serverState = iota
+	// stateRunning is the state after a successful initialize request.
+	stateRunning
+	// stateShutdown is the state after a shutdown request. Only exit is
+	// accepted.
+	stateShutdown
+)
+
+var state = stateUninitialized
+
+// resetSession forgets the state of a previous session, so a new one starts
+// uninitialized without documents. Must be called with serverMutex held.
+func resetSession() {
+	state = stateUninitialized
+	clientCapabilities = ClientCapabilities{}
+	settings = defaultSettings()
+	for uri := range diagnosticTimers {
+		cancelDiagnostics(uri)
+	}
+	OpenFiles = map[string]*OpenFile{}
+	WorkspaceFiles = map[string]*OpenFile{}
+	workspaceVersions = map[string]int{}
+	WorkspaceFolders = []WorkspaceFolder{}
+}
+
+// checkLifecycle reports whether a message may be handled in the current
+// server state. Requests that may not be handled receive the error the
+// specification prescribes; notifications are dropped silently.
+func checkLifecycle(request Request) bool {
+	if request.Method == "exit" {
+		return true
+	}
+
+	switch state {
+	case stateUninitialized:
+		if request.Method == "initialize" {
+			return true
+		}
+		if !isNotification(request) {
+			sendError(request.ID, ServerNotInitialized, "Server not initialized.")
+		}
+		return false
+	case stateShutdown:
+		if !isNotification(request) {
+			sendError(request.ID, InvalidRequest, "Server is shutting down.")
+		}
+		return false
+	}
+
+	if request.Method == "initialize" {
+		if !isNotification(request) {
+			sendError(request.ID, InvalidRequest, "Server is already initialized.")
+		}
+		return false
+	}
+	return true
+}
+
+type ClientCapabilities struct {
+	TextDocument struct {
+		// Diagnostic is set when the client supports pull diagnostics.
+		Diagnostic *struct{} `json:"diagnostic"`
+	} `json:"textDocument"`
+	Workspace struct {
+		DidChangeWatchedFiles struct {
+			DynamicRegistration bool `json:"dynamicRegistration"`
+		} `json:"didChangeWatchedFiles"`
+		Diagnostics struct {
+			RefreshSupport bool `json:"refreshSupport"`
+		} `json:"diagnostics"`
+		WorkspaceEdit struct {
+			DocumentChanges bool `json:"documentChanges"`
+		} `json:"workspaceEdit"`
+	} `json:"workspace"`
+}
+
+type InitializeParams struct {
+	RootURI               string             `json:"rootUri"`
+	WorkspaceFolders      []WorkspaceFolder  `json:"workspaceFolders"`
+	Capabilities          ClientCapabilities `json:"capabilities"`
+	InitializationOptions json.RawMessage    `json:"initializationOptions"`
+}
+
+var clientCapabilities ClientCapabilities
 
 func handleInitialize(request Request) {
+	var params InitializeParams
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to unmarshal initialize: %v\nRaw: %s\n", err, request.Params)
+	}
+	clientCapabilities = params.Capabilities
+	if err := ApplySettings(params.InitializationOptions); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to apply settings: %v\nRaw: %s\n", err, params.InitializationOptions)
+	}
+	WorkspaceFolders = params.WorkspaceFolders
+	if len(WorkspaceFolders) == 0 && params.RootURI != "" {
+		WorkspaceFolders = []WorkspaceFolder{{URI: params.RootURI}}
+	}
+
+	state = stateRunning
 	result := map[string]interface{}{
 		"capabilities": map[string]interface{}{
 			"textDocumentSync": 1,
@@ -10,24 +118,43 @@ func handleInitialize(request Request) {
 				"resolveProvider":   false,
 				"triggerCharacters": []string{"|", "=", " "},
 			},
-			"renameProvider":     true,
-			"definitionProvider": true,
+			"renameProvider": map[string]interface{}{
+				"prepareProvider": true,
+			},
+			"definitionProvider":      true,
+			"referencesProvider":      true,
+			"hoverProvider":           true,
+			"workspaceSymbolProvider": true,
+			"codeActionProvider": map[string]interface{}{
+				"codeActionKinds": []string{CodeActionRefactorRewrite, CodeActionRefactorInline, CodeActionRefactorExtract, CodeActionQuickFix},
+			},
+			"codeLensProvider": map[string]interface{}{
+				"resolveProvider": false,
+			},
+			"executeCommandProvider": map[string]interface{}{
+				"commands": []string{CommandRunTest, CommandRunTests},
+			},
+			"diagnosticProvider": map[string]interface{}{
+				"interFileDependencies": true,
+				"workspaceDiagnostics":  true,
+			},
 		},
 	}
 	sendResponse(request.ID, result)
 }
 
 func handleInitialized(request Request) {
-	// No response required, no actions taken currently.
+	registerFileWatchers()
+	go indexWorkspace()
 }
 
 func handleShutdown(request Request) {
-	shutdownRequested = true
+	state = stateShutdown
 	sendResponse(request.ID, nil)
 }
 
 func handleExit() {
-	if shutdownRequested {
+	if state == stateShutdown {
 		os.Exit(0)
 	}
 	os.Exit(1)
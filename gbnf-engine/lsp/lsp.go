@@ -11,11 +11,32 @@ import (
 	"strings"
 )
 
-var debugLogger *log.Logger
+// debugLogger discards its output unless the server is started by Run.
+var debugLogger = log.New(io.Discard, "", 0)
 
+// Run serves the language server protocol on stdin and stdout.
 func Run() {
-	reader := bufio.NewReader(os.Stdin)
 	debugLogger = log.New(os.Stderr, "LSP: ", log.Ltime|log.Lshortfile)
+	Serve(os.Stdin, os.Stdout)
+}
+
+// Serve starts a new session, reading messages from input and writing
+// responses and notifications to output until input ends. The session leaves
+// no documents or settings behind.
+func Serve(input io.Reader, output io.Writer) {
+	outputMutex.Lock()
+	messageOutput = output
+	outputMutex.Unlock()
+	serverMutex.Lock()
+	resetSession()
+	serverMutex.Unlock()
+	defer func() {
+		serverMutex.Lock()
+		resetSession()
+		serverMutex.Unlock()
+	}()
+
+	reader := bufio.NewReader(input)
 	for {
 		debugLogger.Printf("Number of open files: %v", len(OpenFiles))
 		var contentLength int
@@ -68,12 +89,23 @@ func Run() {
 			continue
 		}
 
+		serverMutex.Lock()
 		handleRequest(request)
+		serverMutex.Unlock()
 	}
 }
 
 func handleRequest(request Request) {
+	if request.Method == "" {
+		// Responses to server-initiated requests carry no method.
+		return
+	}
+
 	debugLogger.Printf("Started request %v with method %v", request.ID, request.Method)
+	if !checkLifecycle(request) {
+		return
+	}
+
 	switch request.Method {
 	case "initialize":
 		handleInitialize(request)
@@ -93,13 +125,40 @@ func handleRequest(request Request) {
 		handleTextDocumentDidClose(request)
 	case "textDocument/completion":
 		handleTextDocumentCompletion(request)
+	case "textDocument/prepareRename":
+		handleTextDocumentPrepareRename(request)
 	case "textDocument/rename":
 		handleTextDocumentRename(request)
+	case "textDocument/references":
+		handleTextDocumentReferences(request)
 	case "textDocument/definition":
 		handleTextDocumentDefinition(request)
+	case "textDocument/hover":
+		handleTextDocumentHover(request)
+	case "textDocument/codeAction":
+		handleTextDocumentCodeAction(request)
+	case "textDocument/codeLens":
+		handleTextDocumentCodeLens(request)
+	case "textDocument/diagnostic":
+		handleTextDocumentDiagnostic(request)
+	case "workspace/diagnostic":
+		handleWorkspaceDiagnostic(request)
+	case "workspace/didChangeWatchedFiles":
+		handleWorkspaceDidChangeWatchedFiles(request)
+	case "workspace/didChangeConfiguration":
+		handleWorkspaceDidChangeConfiguration(request)
+	case "workspace/symbol":
+		handleWorkspaceSymbol(request)
+	case "workspace/executeCommand":
+		handleWorkspaceExecuteCommand(request)
+	case "gbnf/nextCharacters":
+		handleNextCharacters(request)
 
 	default:
-		sendError(request.ID, -32601, "Method not found.")
+		// Unknown notifications, including $/ notifications, are ignored.
+		if !isNotification(request) {
+			sendError(request.ID, MethodNotFound, "Method not found.")
+		}
 	}
 	debugLogger.Printf("Finished request %v", request.ID)
 }
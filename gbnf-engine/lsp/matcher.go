@@ -0,0 +1,96 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/Matcher"
+)
+
+type NextCharactersParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	// Prefix is the text generated so far.
+	Prefix string `json:"prefix"`
+	// Rule is the rule the text should match, root if empty.
+	Rule string `json:"rule,omitempty"`
+}
+
+type NextCharactersResult struct {
+	// Accepted counts the characters (code points) of the prefix the grammar
+	// accepts; if Rejected the rest of the result describes the text before
+	// the rejected character.
+	Accepted int  `json:"accepted"`
+	Rejected bool `json:"rejected"`
+	Complete bool `json:"complete"`
+	// Next is a character class of the characters allowed next, or "" if
+	// none are.
+	Next   string `json:"next"`
+	Forced string `json:"forced"`
+}
+
+// handleNextCharacters answers the custom gbnf/nextCharacters request,
+// replaying a prefix against a grammar as llama.cpp does during sampling.
+func handleNextCharacters(request Request) {
+	var params NextCharactersParams
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		sendError(request.ID, InvalidRequest, "Failed to unpack request.")
+		return
+	}
+	if params.Rule == "" {
+		params.Rule = "root"
+	}
+
+	grammar, err := compiledGrammar(params.TextDocument.URI)
+	if err != nil {
+		sendError(request.ID, RequestFailed, err.Error())
+		return
+	}
+	prediction, err := Matcher.Predict(grammar, params.Rule, params.Prefix)
+	if err != nil {
+		sendError(request.ID, RequestFailed, err.Error())
+		return
+	}
+
+	result := NextCharactersResult{
+		Accepted: prediction.Accepted,
+		Rejected: prediction.Rejected,
+		Complete: prediction.Complete,
+		Forced:   prediction.Forced,
+	}
+	if len(prediction.Next) > 0 {
+		result.Next = GBNFParser.FormatCharClass(prediction.Next, false)
+	}
+	sendResponse(request.ID, result)
+}
+
+// compiledGrammar compiles the grammar of uri together with its imports.
+func compiledGrammar(uri string) (*Matcher.Grammar, error) {
+	flattened, err := flattenedGrammar(uri)
+	if err != nil {
+		return nil, err
+	}
+	return Matcher.Compile(flattened)
+}
+
+// flattenedGrammar combines the grammar of uri with its imports, failing if
+// any of them has errors.
+func flattenedGrammar(uri string) (*GBNFParser.Node, error) {
+	file := lookupFile(uri)
+	if file == nil {
+		return nil, fmt.Errorf("unknown document %s", uri)
+	}
+	if len(file.ParserErrors) > 0 {
+		return nil, fmt.Errorf("the grammar has syntax errors")
+	}
+	imported, importErrors := resolveImports(uri)
+	if len(importErrors) > 0 {
+		return nil, fmt.Errorf("%s", importErrors[0].Message)
+	}
+	flattened, errors := GBNFParser.Flatten(asGrammarFile(uri, file), imported)
+	if len(errors) > 0 {
+		return nil, fmt.Errorf("%s", errors[0])
+	}
+	return flattened, nil
+}
@@ -0,0 +1,266 @@
+package lsp
+
+import (
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/Transform"
+	"slices"
+	"strings"
+)
+
+// NewRuleName is the name extracted rules get, numbered if it is taken.
+const NewRuleName = "new-rule"
+
+// CommandStartRename starts renaming the symbol at a position. It is
+// implemented by the editor extension, not the server, taking a URI and a
+// position as arguments.
+const CommandStartRename = "gbnf.startRename"
+
+// inlineCodeActions offers to inline the rule under the cursor if it is used
+// once.
+func inlineCodeActions(uri string, file *OpenFile, params CodeActionParams) []CodeAction {
+	if len(file.ParserErrors) > 0 {
+		// Rewriting a partially parsed grammar would drop what failed to
+		// parse.
+		return nil
+	}
+	index := tokenIndexInRange(file.Tokens, params.Range)
+	if index == -1 || file.Tokens[index].Type != GBNFParser.TokenIdentifier {
+		return nil
+	}
+	name := file.Tokens[index].Value
+	changes, err := Transform.InlineRule(file.AST, name)
+	if err != nil {
+		return nil
+	}
+	return []CodeAction{{
+		Title: fmt.Sprintf("Inline rule `%s`", name),
+		Kind:  CodeActionRefactorInline,
+		Edit:  newWorkspaceEdit(map[string][]TextEdit{uri: changeEdits(file, changes)}),
+	}}
+}
+
+// extractCodeActions offers to move the selected part of a rule body into a
+// rule of its own.
+func extractCodeActions(uri string, file *OpenFile, params CodeActionParams) []CodeAction {
+	if params.Range.Start == params.Range.End || len(file.ParserErrors) > 0 {
+		return nil
+	}
+	declaration := declarationAt(file, params.Range.Start)
+	if declaration == nil {
+		return nil
+	}
+	parent, start, end, ok := selectedNodes(declaration, params.Range)
+	if !ok {
+		return nil
+	}
+	changes, _, err := Transform.ExtractRule(file.AST, declaration, parent, start, end, NewRuleName)
+	if err != nil {
+		return nil
+	}
+	// The new rule is inserted last, so it ends where the declaration ended,
+	// moved by the lines the edits add or remove. The rename starts at its
+	// name so the placeholder can be replaced.
+	edits := changeEdits(file, changes)
+	_, declarationEnd := declarationSpan(declaration)
+	line := declarationEnd.Line - strings.Count(GBNFParser.FormatRule(changes[0].Replacement[1]), "\n")
+	for _, edit := range edits {
+		line += strings.Count(edit.NewText, "\n") - (edit.Range.End.Line - edit.Range.Start.Line)
+	}
+	newRule := Position{Line: line}
+	return []CodeAction{{
+		Title:   "Extract to new rule",
+		Kind:    CodeActionRefactorExtract,
+		Edit:    newWorkspaceEdit(map[string][]TextEdit{uri: edits}),
+		Command: &Command{Title: "Rename new rule", Command: CommandStartRename, Arguments: []any{uri, newRule}},
+	}}
+}
+
+// alternativeCodeActions offers to simplify the alternatives of the rule
+// under the cursor, and to merge it with rules that have the same body.
+func alternativeCodeActions(uri string, file *OpenFile, params CodeActionParams) []CodeAction {
+	declaration := declarationAt(file, params.Range.Start)
+	if declaration == nil || len(file.ParserErrors) > 0 {
+		return nil
+	}
+	actions := []CodeAction{}
+	if change, ok := Transform.FlattenAlternatives(declaration); ok {
+		actions = append(actions, CodeAction{
+			Title: "Flatten nested alternatives",
+			Kind:  CodeActionRefactorRewrite,
+			Edit:  newWorkspaceEdit(map[string][]TextEdit{uri: changeEdits(file, []Transform.Change{change})}),
+		})
+	}
+	if change, ok := Transform.FactorPrefixes(declaration); ok {
+		actions = append(actions, CodeAction{
+			Title: "Factor out common prefixes of alternatives",
+			Kind:  CodeActionRefactorRewrite,
+			Edit:  newWorkspaceEdit(map[string][]TextEdit{uri: changeEdits(file, []Transform.Change{change})}),
+		})
+	}
+	for _, group := range Transform.IdenticalRules(file.AST) {
+		if slices.Contains(group, declaration) {
+			actions = append(actions, CodeAction{
+				Title: "Merge rules with identical bodies",
+				Kind:  CodeActionRefactorRewrite,
+				Edit:  newWorkspaceEdit(map[string][]TextEdit{uri: changeEdits(file, Transform.MergeIdenticalRules(file.AST))}),
+			})
+			break
+		}
+	}
+	return actions
+}
+
+// duplicateCodeActions offers to keep only the last declaration of a rule
+// declared more than once, as llama.cpp does, or to combine them, with the
+// cursor on one of them.
+func duplicateCodeActions(uri string, file *OpenFile, params CodeActionParams) []CodeAction {
+	declaration := declarationAt(file, params.Range.Start)
+	if declaration == nil || len(file.ParserErrors) > 0 {
+		return nil
+	}
+	name := declaration.Token.Value
+	kept, err := Transform.KeepLastDeclaration(file.AST, name)
+	if err != nil {
+		return nil
+	}
+	merged, err := Transform.MergeDeclarations(file.AST, name)
+	if err != nil {
+		return nil
+	}
+	return []CodeAction{
+		{
+			Title: fmt.Sprintf("Keep last declaration of `%s`", name),
+			Kind:  CodeActionQuickFix,
+			Edit:  newWorkspaceEdit(map[string][]TextEdit{uri: changeEdits(file, kept)}),
+		},
+		{
+			Title: fmt.Sprintf("Combine declarations of `%s` (changes meaning)", name),
+			Kind:  CodeActionQuickFix,
+			Edit:  newWorkspaceEdit(map[string][]TextEdit{uri: changeEdits(file, merged)}),
+		},
+	}
+}
+
+// declarationAt returns the declaration of file that position falls in.
+func declarationAt(file *OpenFile, position Position) *GBNFParser.Node {
+	var found *GBNFParser.Node
+	for _, node := range file.AST.Children {
+		if node.Type != GBNFParser.NodeDeclaration {
+			continue
+		}
+		start := Position{Line: node.Token.Line, Character: node.Token.Column}
+		if positionBefore(position, start) {
+			break
+		}
+		found = node
+	}
+	if found == nil {
+		return nil
+	}
+	if _, end := declarationSpan(found); positionBefore(end, position) {
+		return nil
+	}
+	return found
+}
+
+// selectedNodes finds the consecutive children of a node in declaration that
+// the selection covers, descending into the node the selection falls in.
+func selectedNodes(parent *GBNFParser.Node, selection Range) (*GBNFParser.Node, int, int, bool) {
+	contained := []int{}
+	partial := []int{}
+	for index, child := range parent.Children {
+		start, end, ok := nodeSpan(child)
+		switch {
+		case !ok:
+		case !positionBefore(start, selection.Start) && !positionBefore(selection.End, end):
+			contained = append(contained, index)
+		case positionBefore(start, selection.End) && positionBefore(selection.Start, end):
+			partial = append(partial, index)
+		}
+	}
+	switch {
+	case len(contained) > 0 && len(partial) == 0 && contained[len(contained)-1]-contained[0] == len(contained)-1:
+		return parent, contained[0], contained[len(contained)-1] + 1, true
+	case len(contained) == 0 && len(partial) == 1:
+		return selectedNodes(parent.Children[partial[0]], selection)
+	}
+	return nil, 0, 0, false
+}
+
+// nodeSpan returns the source range of node. ok is false for nodes without
+// one, such as empty branches.
+func nodeSpan(node *GBNFParser.Node) (start Position, end Position, ok bool) {
+	if node.Span == (GBNFParser.Span{}) {
+		return Position{}, Position{}, false
+	}
+	return spanRange(node.Span).Start, spanRange(node.Span).End, true
+}
+
+func spanRange(span GBNFParser.Span) Range {
+	return Range{
+		Start: Position{Line: span.Line, Character: span.Column},
+		End:   Position{Line: span.EndLine, Character: span.EndColumn},
+	}
+}
+
+// declarationSpan returns where the declaration starts and where its last
+// token ends.
+func declarationSpan(declaration *GBNFParser.Node) (Position, Position) {
+	start, end, _ := nodeSpan(declaration)
+	return start, end
+}
+
+// changeEdits turns changes into edits that rewrite only the nodes that
+// change, printed by the formatter, so comments and formatting elsewhere are
+// kept. Removed declarations take their lines with them, and added rules go
+// after the declaration they come with.
+func changeEdits(file *OpenFile, changes []Transform.Change) []TextEdit {
+	lines := strings.Split(file.Text, "\n")
+	edits := []TextEdit{}
+	for _, change := range changes {
+		start, end := declarationSpan(change.Declaration)
+		if len(change.Replacement) == 0 {
+			start.Character = 0
+			if end.Line+1 < len(lines) {
+				end = Position{Line: end.Line + 1}
+			} else {
+				end.Character = len([]rune(lines[end.Line]))
+			}
+			edits = append(edits, TextEdit{Range: Range{Start: start, End: end}, NewText: ""})
+			continue
+		}
+
+		declarationEdits := []TextEdit{}
+		if nodeEdits, ok := Transform.DeclarationEdits(change.Declaration, change.Replacement[0]); ok {
+			for _, edit := range nodeEdits {
+				declarationEdits = append(declarationEdits, TextEdit{Range: spanRange(edit.Span), NewText: edit.Text})
+			}
+		} else {
+			declarationEdits = []TextEdit{{Range: Range{Start: start, End: end}, NewText: GBNFParser.FormatRule(change.Replacement[0])}}
+		}
+
+		if len(change.Replacement) > 1 {
+			rules := []string{}
+			for _, rule := range change.Replacement[1:] {
+				rules = append(rules, "\n"+GBNFParser.FormatRule(rule))
+			}
+			added := strings.Join(rules, "")
+			if last := len(declarationEdits) - 1; last >= 0 && declarationEdits[last].Range.End == end {
+				// Edits must not overlap, so the rules join an edit ending
+				// where they are inserted.
+				declarationEdits[last].NewText += added
+			} else {
+				declarationEdits = append(declarationEdits, TextEdit{Range: Range{Start: end, End: end}, NewText: added})
+			}
+		}
+		edits = append(edits, declarationEdits...)
+	}
+	slices.SortFunc(edits, func(a TextEdit, b TextEdit) int {
+		if a.Range.Start.Line != b.Range.Start.Line {
+			return a.Range.Start.Line - b.Range.Start.Line
+		}
+		return a.Range.Start.Character - b.Range.Start.Character
+	})
+	return edits
+}
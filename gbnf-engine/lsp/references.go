@@ -0,0 +1,125 @@
+package lsp
+
+import (
+	"encoding/json"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"path/filepath"
+	"sort"
+)
+
+// scopedFile is a grammar in which a rule name refers to the same rule.
+type scopedFile struct {
+	URI  string
+	File *GBNFParser.GrammarFile
+}
+
+// ruleScope returns the grammars sharing the rule name as seen from the
+// document uri, in a stable order. These are the known grammars and the files
+// they import in which name resolves to the same declaration, nearest first
+// as in bundles. A file declaring its own rule with that name, or importing
+// one nearer, is left out. A rule that is not declared anywhere is scoped to
+// uri and its imports.
+func ruleScope(uri string, name string) []scopedFile {
+	file := lookupFile(uri)
+	if file == nil {
+		return nil
+	}
+	current := asGrammarFile(uri, file)
+	imported, _ := resolveImports(uri)
+
+	scope := map[string]scopedFile{}
+	add := func(uri string, file *GBNFParser.GrammarFile) {
+		path := filepath.Clean(file.Path)
+		if _, ok := scope[path]; !ok {
+			scope[path] = scopedFile{URI: uri, File: file}
+		}
+	}
+
+	declaring, declared := GBNFParser.ResolveRule(current, imported, current.Path, name)
+	if !declared {
+		add(uri, current)
+		for _, file := range imported {
+			add(grammarFileURI(file.Path), file)
+		}
+	} else {
+		for _, candidateURI := range append([]string{uri}, workspaceGrammarURIs()...) {
+			candidate := asGrammarFile(candidateURI, lookupFile(candidateURI))
+			candidateImports, _ := resolveImports(candidateURI)
+			if !containsPath(append([]*GBNFParser.GrammarFile{candidate}, candidateImports...), declaring) {
+				continue
+			}
+			for _, file := range append([]*GBNFParser.GrammarFile{candidate}, candidateImports...) {
+				if resolved, ok := GBNFParser.ResolveRule(candidate, candidateImports, file.Path, name); !ok || resolved != declaring {
+					continue
+				}
+				if file == candidate {
+					add(candidateURI, file)
+				} else {
+					add(grammarFileURI(file.Path), file)
+				}
+			}
+		}
+	}
+
+	files := make([]scopedFile, 0, len(scope))
+	for _, file := range scope {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].URI < files[j].URI })
+	return files
+}
+
+func containsPath(files []*GBNFParser.GrammarFile, path string) bool {
+	for _, file := range files {
+		if filepath.Clean(file.Path) == path {
+			return true
+		}
+	}
+	return false
+}
+
+type ReferenceParams struct {
+	TextDocumentPositionParams
+	Context struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+// handleTextDocumentReferences lists the uses of the rule under the cursor
+// in every grammar sharing it.
+func handleTextDocumentReferences(request Request) {
+	var params ReferenceParams
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		sendError(request.ID, InvalidRequest, "Failed to unpack request.")
+		return
+	}
+
+	file := lookupFile(params.TextDocument.URI)
+	if file == nil {
+		sendResponse(request.ID, nil)
+		return
+	}
+	token := getTokenAtPosition(file.Tokens, params.Position)
+	if token == nil || token.Type != GBNFParser.TokenIdentifier {
+		sendResponse(request.ID, nil)
+		return
+	}
+
+	locations := []Location{}
+	for _, scoped := range ruleScope(params.TextDocument.URI, token.Value) {
+		declarations := map[[2]int]bool{}
+		for _, declaration := range findDefinitions(scoped.File.AST, token.Value) {
+			declarations[[2]int{declaration.Line, declaration.Column}] = true
+		}
+		for _, candidate := range scoped.File.Tokens {
+			if candidate.Type != GBNFParser.TokenIdentifier || candidate.Value != token.Value {
+				continue
+			}
+			if !params.Context.IncludeDeclaration && declarations[[2]int{candidate.Line, candidate.Column}] {
+				continue
+			}
+			locations = append(locations, Location{URI: scoped.URI, Range: tokenRange(&candidate)})
+		}
+	}
+	sendResponse(request.ID, locations)
+}
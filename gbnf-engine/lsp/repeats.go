@@ -0,0 +1,134 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/Matcher"
+	"strings"
+)
+
+// maxHoverRules bounds the helper rules listed when hovering a repeat.
+const maxHoverRules = 20
+
+// RuleRepeatsShouldHaveSensibleBounds warns about `{m,n}` repeats that match
+// only the empty string and about repeats llama.cpp expands into more
+// copies and helper rules than the configured limit.
+func RuleRepeatsShouldHaveSensibleBounds(uri string) []*Diagnostic {
+	file := lookupFile(uri)
+	diags := []*Diagnostic{}
+	for _, declaration := range file.AST.Children {
+		if declaration.Type != GBNFParser.NodeDeclaration {
+			continue
+		}
+		for _, repeat := range collectRepeats(declaration.Children) {
+			token := repeat.Token
+			var message string
+			expansion := Matcher.ExpandRepeat(declaration.Token.Value, repeat, 0)
+			size := repeat.Min + expansion.RuleCount
+			switch {
+			case repeat.Max == 0:
+				message = fmt.Sprintf("Repeat `%s` matches only the empty string.", token.Value)
+			case settings.Complexity.MaxRepeatBound > 0 && size > settings.Complexity.MaxRepeatBound:
+				message = fmt.Sprintf("llama.cpp expands `%s` into %d copies and helper rules, more than the limit of %d.",
+					token.Value, size, settings.Complexity.MaxRepeatBound)
+			default:
+				continue
+			}
+			diags = append(diags, &Diagnostic{
+				Range: Range{
+					Start: Position{Line: token.Line, Character: token.Column},
+					End:   Position{Line: token.Line, Character: token.Column + len(token.Value)},
+				},
+				Message:  message,
+				Severity: 2,
+				Source:   SOURCE,
+			})
+		}
+	}
+	return diags
+}
+
+// collectRepeats returns the repeat nodes in nodes, outermost first.
+func collectRepeats(nodes []*GBNFParser.Node) []*GBNFParser.Node {
+	repeats := []*GBNFParser.Node{}
+	for _, node := range nodes {
+		if node.Type == GBNFParser.NodeRepeat {
+			repeats = append(repeats, node)
+		}
+		repeats = append(repeats, collectRepeats(node.Children)...)
+	}
+	return repeats
+}
+
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    Range         `json:"range"`
+}
+
+// handleTextDocumentHover shows the rules llama.cpp generates for the repeat
+// under the cursor.
+func handleTextDocumentHover(request Request) {
+	var params TextDocumentPositionParams
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		sendError(request.ID, InvalidRequest, "Failed to unpack request.")
+		return
+	}
+
+	file := lookupFile(params.TextDocument.URI)
+	if file == nil {
+		sendResponse(request.ID, nil)
+		return
+	}
+	token := getTokenAtPosition(file.Tokens, params.Position)
+	if token == nil || token.Type != GBNFParser.TokenOperator && token.Type != GBNFParser.TokenRepeat {
+		sendResponse(request.ID, nil)
+		return
+	}
+	for _, declaration := range file.AST.Children {
+		if declaration.Type != GBNFParser.NodeDeclaration {
+			continue
+		}
+		for _, repeat := range collectRepeats(declaration.Children) {
+			if repeat.Token.Line == token.Line && repeat.Token.Column == token.Column {
+				sendResponse(request.ID, Hover{
+					Contents: MarkupContent{Kind: "markdown", Value: expansionMarkdown(declaration.Token.Value, repeat)},
+					Range: Range{
+						Start: Position{Line: token.Line, Character: token.Column},
+						End:   Position{Line: token.Line, Character: token.Column + len(token.Value)},
+					},
+				})
+				return
+			}
+		}
+	}
+	sendResponse(request.ID, nil)
+}
+
+// expansionMarkdown describes the expansion of a repeat, such as
+// "llama.cpp expands `[a-z]{2,3}` into `[a-z] [a-z] key_1`" followed by the
+// helper rules.
+func expansionMarkdown(rule string, repeat *GBNFParser.Node) string {
+	expansion := Matcher.ExpandRepeat(rule, repeat, maxHoverRules)
+	var builder strings.Builder
+	original := GBNFParser.FormatExpression([]*GBNFParser.Node{repeat})
+	if expansion.Expression == "" {
+		fmt.Fprintf(&builder, "llama.cpp drops `%s`, which matches only the empty string.", original)
+	} else {
+		fmt.Fprintf(&builder, "llama.cpp expands `%s` into `%s`", original, expansion.Expression)
+	}
+	if expansion.RuleCount == 0 {
+		return builder.String()
+	}
+
+	fmt.Fprintf(&builder, " with %d helper rules:\n\n```gbnf\n%s\n```", expansion.RuleCount, strings.Join(expansion.Rules, "\n"))
+	if hidden := expansion.RuleCount - len(expansion.Rules); hidden > 0 {
+		fmt.Fprintf(&builder, "\n\nand %d more.", hidden)
+	}
+	return builder.String()
+}
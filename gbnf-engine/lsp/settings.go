@@ -0,0 +1,83 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"gbnflsp/gbnf-engine/Analysis"
+	"os"
+)
+
+// Settings are the `gbnf` settings of the client. They arrive as the
+// initialization options and through workspace/didChangeConfiguration.
+type Settings struct {
+	Complexity struct {
+		MaxDepth        int `json:"maxDepth"`
+		MaxExpandedSize int `json:"maxExpandedSize"`
+		MaxFanOut       int `json:"maxFanOut"`
+		// MaxRepeatBound bounds the copies and helper rules of a single
+		// repeat.
+		MaxRepeatBound int `json:"maxRepeatBound"`
+	} `json:"complexity"`
+}
+
+var settings = defaultSettings()
+
+func defaultSettings() Settings {
+	var defaults Settings
+	defaults.Complexity.MaxDepth = Analysis.DefaultThresholds.MaxDepth
+	defaults.Complexity.MaxExpandedSize = Analysis.DefaultThresholds.MaxExpandedSize
+	defaults.Complexity.MaxFanOut = Analysis.DefaultThresholds.MaxFanOut
+	defaults.Complexity.MaxRepeatBound = 100
+	return defaults
+}
+
+// ApplySettings replaces the settings with raw. Settings missing from raw
+// keep their defaults.
+func ApplySettings(raw json.RawMessage) error {
+	updated := defaultSettings()
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &updated); err != nil {
+			return err
+		}
+	}
+	settings = updated
+	return nil
+}
+
+func complexityThresholds() Analysis.Thresholds {
+	return Analysis.Thresholds{
+		MaxDepth:        settings.Complexity.MaxDepth,
+		MaxExpandedSize: settings.Complexity.MaxExpandedSize,
+		MaxFanOut:       settings.Complexity.MaxFanOut,
+	}
+}
+
+type DidChangeConfigurationParams struct {
+	Settings struct {
+		GBNF json.RawMessage `json:"gbnf"`
+	} `json:"settings"`
+}
+
+// handleWorkspaceDidChangeConfiguration applies new settings and updates the
+// diagnostics that depend on them.
+func handleWorkspaceDidChangeConfiguration(request Request) {
+	var params DidChangeConfigurationParams
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to unmarshal didChangeConfiguration: %v\nRaw: %s\n", err, request.Params)
+		return
+	}
+	if err := ApplySettings(params.Settings.GBNF); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to apply settings: %v\nRaw: %s\n", err, params.Settings.GBNF)
+		return
+	}
+
+	if clientCapabilities.TextDocument.Diagnostic != nil {
+		if clientCapabilities.Workspace.Diagnostics.RefreshSupport {
+			sendRequest("workspace/diagnostic/refresh", nil)
+		}
+		return
+	}
+	for uri, file := range OpenFiles {
+		scheduleDiagnostics(uri, file.Version)
+	}
+}
@@ -0,0 +1,184 @@
+package lsp
+
+import (
+	"encoding/json"
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SymbolKindFunction is the LSP symbol kind used for rules.
+const SymbolKindFunction = 12
+
+type WorkspaceSymbolParams struct {
+	Query string `json:"query"`
+}
+
+type SymbolInformation struct {
+	Name          string   `json:"name"`
+	Kind          int      `json:"kind"`
+	Location      Location `json:"location"`
+	ContainerName string   `json:"containerName,omitempty"`
+}
+
+func handleWorkspaceSymbol(request Request) {
+	var params WorkspaceSymbolParams
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		sendError(request.ID, InvalidRequest, "Failed to unpack request.")
+		return
+	}
+
+	type match struct {
+		symbol SymbolInformation
+		score  int
+	}
+	matches := []match{}
+	for _, uri := range workspaceGrammarURIs() {
+		file := lookupFile(uri)
+		if file == nil || file.AST == nil {
+			continue
+		}
+		lines := strings.Split(file.Text, "\n")
+		for _, node := range file.AST.Children {
+			if node.Type != GBNFParser.NodeDeclaration {
+				continue
+			}
+			score, ok := FuzzyMatch(params.Query, node.Token.Value)
+			if !ok {
+				continue
+			}
+
+			container := displayPath(uri)
+			if body := ruleBodyFirstLine(lines, node.Token); body != "" {
+				container += " — " + body
+			}
+			matches = append(matches, match{
+				score: score,
+				symbol: SymbolInformation{
+					Name: node.Token.Value,
+					Kind: SymbolKindFunction,
+					Location: Location{
+						URI: uri,
+						Range: Range{
+							Start: Position{Line: node.Token.Line, Character: node.Token.Column},
+							End:   Position{Line: node.Token.Line, Character: node.Token.Column + len(node.Token.Value)},
+						},
+					},
+					ContainerName: container,
+				},
+			})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].symbol.Name < matches[j].symbol.Name
+	})
+	symbols := make([]SymbolInformation, len(matches))
+	for index, match := range matches {
+		symbols[index] = match.symbol
+	}
+	sendResponse(request.ID, symbols)
+}
+
+// workspaceGrammarURIs returns the URIs of all known grammars: indexed files
+// and files open in the editor. A file that is both indexed and open is
+// returned once, under its open URI.
+func workspaceGrammarURIs() []string {
+	uris := []string{}
+	openPaths := map[string]bool{}
+	for uri := range OpenFiles {
+		uris = append(uris, uri)
+		openPaths[filepath.Clean(uriToPath(uri))] = true
+	}
+	sort.Strings(uris)
+	for _, uri := range indexedURIs() {
+		if !openPaths[filepath.Clean(uriToPath(uri))] {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+// displayPath returns the path of uri relative to the workspace folder that
+// contains it, or the file name if it is outside the workspace.
+func displayPath(uri string) string {
+	path := uriToPath(uri)
+	for _, folder := range WorkspaceFolders {
+		relative, err := filepath.Rel(uriToPath(folder.URI), path)
+		if err == nil && !strings.HasPrefix(relative, "..") {
+			return filepath.ToSlash(relative)
+		}
+	}
+	return filepath.Base(path)
+}
+
+// ruleBodyFirstLine returns the first non-empty line of the body of the rule
+// declared by name.
+func ruleBodyFirstLine(lines []string, name *GBNFParser.Token) string {
+	if name.Line >= len(lines) {
+		return ""
+	}
+	line := []rune(lines[name.Line])
+	rest := ""
+	if name.Column <= len(line) {
+		rest = string(line[name.Column:])
+	}
+	if index := strings.Index(rest, "::="); index >= 0 {
+		if body := strings.TrimSpace(rest[index+len("::="):]); body != "" {
+			return body
+		}
+	}
+	for _, next := range lines[name.Line+1:] {
+		if body := strings.TrimSpace(next); body != "" {
+			return body
+		}
+	}
+	return ""
+}
+
+// FuzzyMatch reports whether all characters of query appear in candidate in
+// order, ignoring case. Higher scores indicate better matches: consecutive
+// characters, matches at the start of a word and shorter candidates all rank
+// higher. An empty query matches everything.
+func FuzzyMatch(query string, candidate string) (int, bool) {
+	queryRunes := []rune(strings.ToLower(query))
+	candidateRunes := []rune(strings.ToLower(candidate))
+	if len(queryRunes) == 0 {
+		return 0, true
+	}
+
+	score := 0
+	queryIndex := 0
+	previousMatch := -2
+	for index, char := range candidateRunes {
+		if queryIndex == len(queryRunes) {
+			break
+		}
+		if char != queryRunes[queryIndex] {
+			continue
+		}
+
+		score++
+		if index == previousMatch+1 {
+			score += 5
+		}
+		if index == 0 || !unicode.IsLetter(candidateRunes[index-1]) && !unicode.IsDigit(candidateRunes[index-1]) {
+			score += 3
+		}
+		previousMatch = index
+		queryIndex++
+	}
+
+	if queryIndex < len(queryRunes) {
+		return 0, false
+	}
+	if len(queryRunes) == len(candidateRunes) {
+		score += 10
+	}
+	return score*100 - len(candidateRunes), true
+}
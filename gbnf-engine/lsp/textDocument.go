@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"gbnflsp/gbnf-engine/GBNFParser"
 	"os"
+	"sort"
 )
 
 type DidOpenTextDocumentParams struct {
@@ -26,8 +27,9 @@ func handleTextDocumentDidOpen(request Request) {
 	}
 
 	newFile := TextToOpenFile(data.TextDocument.Text)
+	newFile.Version = data.TextDocument.Version
 	OpenFiles[data.TextDocument.URI] = &newFile
-	sendDiagnostics(data.TextDocument.URI)
+	scheduleDiagnostics(data.TextDocument.URI, newFile.Version)
 }
 
 type DidChangeTextDocumentParams struct {
@@ -52,8 +54,9 @@ func handleTextDocumentDidChange(request Request) {
 	}
 
 	newFile := TextToOpenFile(data.ContentChanges[0].Text)
+	newFile.Version = data.TextDocument.Version
 	OpenFiles[data.TextDocument.URI] = &newFile
-	sendDiagnostics(data.TextDocument.URI)
+	scheduleDiagnostics(data.TextDocument.URI, newFile.Version)
 }
 
 func handleTextDocumentDidSave(request Request) {
@@ -74,7 +77,16 @@ func handleTextDocumentDidClose(request Request) {
 		fmt.Fprintf(os.Stderr, "Failed to unmarshal didClose: %v\nRaw: %s\n", err, params)
 		return
 	}
+	cancelDiagnostics(data.TextDocument.URI)
 	delete(OpenFiles, data.TextDocument.URI)
+
+	// The index may hold an outdated copy; unsaved changes were discarded.
+	path := uriToPath(data.TextDocument.URI)
+	if _, ok := WorkspaceFiles[pathToURI(path)]; ok {
+		if _, err := loadWorkspaceFile(path); err != nil {
+			removeWorkspaceFile(pathToURI(path))
+		}
+	}
 }
 
 type Position struct {
@@ -87,113 +99,150 @@ type Range struct {
 	End   Position `json:"end"`
 }
 
-type CompletionParams struct {
+type RenameParams struct {
 	TextDocument struct {
 		URI string `json:"uri"`
 	} `json:"textDocument"`
-	Position struct {
-		Line      int `json:"line"`
-		Character int `json:"character"`
-	} `json:"position"`
+	Position Position `json:"position"`
+	NewName  string   `json:"newName"`
 }
 
-type CompletionItem struct {
-	Label      string `json:"label"`
-	Kind       int    `json:"kind,omitempty"` // 6 = Variable
-	Detail     string `json:"detail,omitempty"`
-	InsertText string `json:"insertText,omitempty"`
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
 }
 
-type CompletionList struct {
-	IsIncomplete bool             `json:"isIncomplete"`
-	Items        []CompletionItem `json:"items"`
+type WorkspaceEdit struct {
+	Changes         map[string][]TextEdit `json:"changes,omitempty"`
+	DocumentChanges []TextDocumentEdit    `json:"documentChanges,omitempty"`
 }
 
-func handleTextDocumentCompletion(request Request) {
-	var params CompletionParams
-	err := json.Unmarshal(request.Params, &params)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to unmarshal completion params: %v\n", err)
-		return
-	}
+type OptionalVersionedTextDocumentIdentifier struct {
+	URI string `json:"uri"`
+	// Version is nil for files that are not open, whose content is on disk.
+	Version *int `json:"version"`
+}
 
-	file := OpenFiles[params.TextDocument.URI]
-	var items []CompletionItem
-
-	for _, name := range file.GetRuleNames() {
-		items = append(items, CompletionItem{
-			Label:      name,
-			Kind:       6,
-			Detail:     "Rule",
-			InsertText: name,
-		})
-	}
+type TextDocumentEdit struct {
+	TextDocument OptionalVersionedTextDocumentIdentifier `json:"textDocument"`
+	Edits        []TextEdit                              `json:"edits"`
+}
 
-	result := CompletionList{
-		IsIncomplete: false,
-		Items:        items,
+// newWorkspaceEdit returns an edit applying the given edits per URI. Clients
+// supporting documentChanges get versioned edits, so they refuse to apply
+// them to documents changed in the meantime.
+func newWorkspaceEdit(changes map[string][]TextEdit) *WorkspaceEdit {
+	if !clientCapabilities.Workspace.WorkspaceEdit.DocumentChanges {
+		return &WorkspaceEdit{Changes: changes}
 	}
-
-	response := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"id":      request.ID,
-		"result":  result,
+	uris := make([]string, 0, len(changes))
+	for uri := range changes {
+		uris = append(uris, uri)
 	}
-
-	data, _ := json.Marshal(response)
-	fmt.Printf("Content-Length: %d\r\n\r\n%s", len(data), data)
+	sort.Strings(uris)
+
+	edit := &WorkspaceEdit{DocumentChanges: []TextDocumentEdit{}}
+	for _, uri := range uris {
+		document := OptionalVersionedTextDocumentIdentifier{URI: uri}
+		if file, ok := OpenFiles[uri]; ok {
+			version := file.Version
+			document.Version = &version
+		}
+		edit.DocumentChanges = append(edit.DocumentChanges, TextDocumentEdit{TextDocument: document, Edits: changes[uri]})
+	}
+	return edit
 }
 
-type RenameParams struct {
-	TextDocument struct {
-		URI string `json:"uri"`
-	} `json:"textDocument"`
-	Position Position `json:"position"`
-	NewName  string   `json:"newName"`
+// renamableToken returns the rule name at position in the document uri, or
+// an error saying why there is nothing to rename there.
+func renamableToken(uri string, position Position) (*GBNFParser.Token, error) {
+	file := lookupFile(uri)
+	if file == nil {
+		return nil, fmt.Errorf("The document is not open.")
+	}
+	token := getTokenAtPosition(file.Tokens, position)
+	if token == nil || token.Type != GBNFParser.TokenIdentifier || token.Error != "" {
+		return nil, fmt.Errorf("Only rule names can be renamed.")
+	}
+	return token, nil
 }
 
-type TextEdit struct {
-	Range   Range  `json:"range"`
-	NewText string `json:"newText"`
+type PrepareRenameResult struct {
+	Range       Range  `json:"range"`
+	Placeholder string `json:"placeholder"`
 }
 
-type WorkspaceEdit struct {
-	Changes map[string][]TextEdit `json:"changes"`
+// handleTextDocumentPrepareRename tells the client the exact range of the
+// rule name to rename, or why the position cannot be renamed.
+func handleTextDocumentPrepareRename(request Request) {
+	var params TextDocumentPositionParams
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		sendError(request.ID, InvalidRequest, "Failed to unpack request.")
+		return
+	}
+
+	token, err := renamableToken(params.TextDocument.URI, params.Position)
+	if err != nil {
+		sendError(request.ID, RequestFailed, err.Error())
+		return
+	}
+	sendResponse(request.ID, PrepareRenameResult{Range: tokenRange(token), Placeholder: token.Value})
 }
 
 func handleTextDocumentRename(request Request) {
 	var params RenameParams
 	if err := json.Unmarshal(request.Params, &params); err != nil {
-		sendError(request.ID, -32600, "Could not unpack request")
+		sendError(request.ID, InvalidRequest, "Could not unpack request")
 		return
 	}
 
-	file := OpenFiles[params.TextDocument.URI]
-	token := getTokenAtPosition(file.Tokens, params.Position)
-
-	if token.Type != GBNFParser.TokenIdentifier {
-		sendError(request.ID, -32600, "Can only rename rule identifiers")
+	token, err := renamableToken(params.TextDocument.URI, params.Position)
+	if err != nil {
+		sendError(request.ID, RequestFailed, err.Error())
 		return
 	}
+	if !GBNFParser.IsValidIdentifier(params.NewName) {
+		sendError(request.ID, RequestFailed, fmt.Sprintf("`%s` is not a valid rule name: it must start with a letter and contain only letters, digits and dashes.", params.NewName))
+		return
+	}
+
+	// The rule is renamed in every grammar declaring or using it, including
+	// grammars of the workspace importing it.
+	scope := ruleScope(params.TextDocument.URI, token.Value)
+	if params.NewName != token.Value {
+		for _, scoped := range scope {
+			if len(findDefinitions(scoped.File.AST, params.NewName)) > 0 {
+				sendError(request.ID, RequestFailed, fmt.Sprintf("A rule named `%s` already exists in %s.", params.NewName, displayPath(scoped.URI)))
+				return
+			}
+		}
+	}
+
+	changes := map[string][]TextEdit{}
+	for _, scoped := range scope {
+		if edits := renameEdits(scoped.File.Tokens, token.Value, params.NewName); len(edits) > 0 {
+			changes[scoped.URI] = edits
+		}
+	}
+	sendResponse(request.ID, newWorkspaceEdit(changes))
+}
 
+// renameEdits returns the edits renaming every occurrence of the identifier
+// name in tokens.
+func renameEdits(tokens []GBNFParser.Token, name string, newName string) []TextEdit {
 	var edits []TextEdit
-	for _, t := range file.Tokens {
-		if t.Type == GBNFParser.TokenIdentifier && t.Value == token.Value {
+	for _, t := range tokens {
+		if t.Type == GBNFParser.TokenIdentifier && t.Value == name {
 			edits = append(edits, TextEdit{
 				Range: Range{
 					Start: Position{Line: t.Line, Character: t.Column},
 					End:   Position{Line: t.Line, Character: t.Column + len(t.Value)},
 				},
-				NewText: params.NewName,
+				NewText: newName,
 			})
 		}
 	}
-
-	resp := WorkspaceEdit{Changes: map[string][]TextEdit{
-		params.TextDocument.URI: edits,
-	}}
-
-	sendResponse(request.ID, resp)
+	return edits
 }
 
 func getTokenAtPosition(tokens []GBNFParser.Token, pos Position) *GBNFParser.Token {
@@ -225,7 +274,7 @@ func handleTextDocumentDefinition(request Request) {
 	var params TextDocumentPositionParams
 	err := json.Unmarshal(request.Params, &params)
 	if err != nil {
-		sendError(request.ID, -32600, "Failed to unpack request.")
+		sendError(request.ID, InvalidRequest, "Failed to unpack request.")
 		return
 	}
 
@@ -236,33 +285,39 @@ func handleTextDocumentDefinition(request Request) {
 		return
 	}
 
-	def := findDefinition(file.AST, token.Value)
-	if def == nil {
+	// A rule declared more than once has all its declarations listed.
+	uri := params.TextDocument.URI
+	defs := findDefinitions(file.AST, token.Value)
+	if len(defs) == 0 {
+		imported, _ := resolveImports(uri)
+		for _, importedFile := range imported {
+			if defs = findDefinitions(importedFile.AST, token.Value); len(defs) > 0 {
+				uri = grammarFileURI(importedFile.Path)
+				break
+			}
+		}
+	}
+	if len(defs) == 0 {
 		sendResponse(request.ID, nil)
 		return
 	}
 
-	loc := Location{
-		URI: params.TextDocument.URI,
-		Range: Range{
-			Start: Position{Line: def.Line, Character: def.Column},
-			End:   Position{Line: def.Line, Character: def.Column + len(def.Value)},
-		},
+	locs := []Location{}
+	for _, def := range defs {
+		locs = append(locs, Location{URI: uri, Range: tokenRange(def)})
 	}
-
-	sendResponse(request.ID, loc)
+	sendResponse(request.ID, locs)
 }
 
-func findDefinition(node *GBNFParser.Node, name string) *GBNFParser.Token {
+func findDefinitions(node *GBNFParser.Node, name string) []*GBNFParser.Token {
 	if node.Type == GBNFParser.NodeDeclaration &&
 		node.Token.Type == GBNFParser.TokenIdentifier &&
 		node.Token.Value == name {
-		return node.Token
+		return []*GBNFParser.Token{node.Token}
 	}
+	defs := []*GBNFParser.Token{}
 	for _, child := range node.Children {
-		if result := findDefinition(child, name); result != nil {
-			return result
-		}
+		defs = append(defs, findDefinitions(child, name)...)
 	}
-	return nil
+	return defs
 }
@@ -4,12 +4,33 @@ import (
 	"encoding/json"
 	"fmt"
 	"gbnflsp/gbnf-engine/GBNFParser"
+	"io"
 	"os"
+	"sync"
+)
+
+// Error codes defined by JSON-RPC and the LSP specification.
+const (
+	InvalidRequest       = -32600
+	MethodNotFound       = -32601
+	ServerNotInitialized = -32002
+	RequestFailed        = -32803
 )
 
-var shutdownRequested = false
 var OpenFiles = map[string]*OpenFile{}
 
+// serverMutex guards the server state shared between the request loop and
+// background work such as debounced diagnostics.
+var serverMutex sync.Mutex
+
+// outputMutex ensures messages written to messageOutput are never
+// interleaved.
+var outputMutex sync.Mutex
+
+// messageOutput receives the messages to the client, stdout unless set by
+// Serve.
+var messageOutput io.Writer = os.Stdout
+
 type Request struct {
 	Jsonrpc string
 	ID      interface{}
@@ -17,6 +38,12 @@ type Request struct {
 	Params  json.RawMessage
 }
 
+// isNotification reports whether the message expects no response. Requests
+// always carry an ID, notifications never do.
+func isNotification(request Request) bool {
+	return request.ID == nil
+}
+
 type Response struct {
 	Jsonrpc string
 	ID      interface{}
@@ -25,6 +52,7 @@ type Response struct {
 }
 
 type OpenFile struct {
+	Version      int
 	Text         string
 	Tokens       []GBNFParser.Token
 	AST          *GBNFParser.Node
@@ -84,7 +112,7 @@ func sendResponse(id interface{}, result interface{}) {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create response with %v and %v.", id, result)
 	}
-	fmt.Printf("Content-Length: %d\r\n\r\n%s", len(data), data)
+	writeMessage(data)
 }
 
 func sendError(id interface{}, code int, message string) {
@@ -98,5 +126,51 @@ func sendError(id interface{}, code int, message string) {
 	}
 
 	data, _ := json.Marshal(response)
-	fmt.Printf("Content-Length: %d\r\n\r\n%s", len(data), data)
+	writeMessage(data)
+}
+
+// nextRequestID numbers requests sent from the server to the client.
+var nextRequestID = 0
+
+// sendRequest sends a request to the client. Responses are not used.
+func sendRequest(method string, params interface{}) {
+	nextRequestID++
+	request := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      fmt.Sprintf("gbnf-%d", nextRequestID),
+		"method":  method,
+	}
+	if params != nil {
+		request["params"] = params
+	}
+
+	data, _ := json.Marshal(request)
+	writeMessage(data)
+}
+
+// Message types of window/showMessage.
+const (
+	MessageTypeError = 1
+	MessageTypeInfo  = 3
+)
+
+// showMessage asks the client to show a message to the user.
+func showMessage(messageType int, message string) {
+	notification := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "window/showMessage",
+		"params": map[string]interface{}{
+			"type":    messageType,
+			"message": message,
+		},
+	}
+
+	data, _ := json.Marshal(notification)
+	writeMessage(data)
+}
+
+func writeMessage(data []byte) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	fmt.Fprintf(messageOutput, "Content-Length: %d\r\n\r\n%s", len(data), data)
 }
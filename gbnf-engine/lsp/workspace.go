@@ -0,0 +1,242 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+)
+
+type WorkspaceFolder struct {
+	URI  string `json:"uri"`
+	Name string `json:"name"`
+}
+
+var WorkspaceFolders = []WorkspaceFolder{}
+
+// WorkspaceFiles is the index of grammars in the workspace folders. It is
+// filled in the background after initialization and kept up to date through
+// workspace/didChangeWatchedFiles. Files that are open in the editor are
+// tracked in OpenFiles instead, which takes precedence.
+var WorkspaceFiles = map[string]*OpenFile{}
+
+// workspaceVersions counts the updates of each entry of WorkspaceFiles,
+// removals included, so the indexer can tell whether an entry changed while
+// it was reading the file.
+var workspaceVersions = map[string]int{}
+
+// GrammarExtension is the file extension of grammar files.
+const GrammarExtension = ".gbnf"
+
+// skippedDirectories are never searched for grammar files.
+var skippedDirectories = []string{".git", "node_modules"}
+
+// lookupFile returns the parsed grammar for uri, preferring the version open
+// in the editor over the one on disk. Returns nil if the file is unknown.
+func lookupFile(uri string) *OpenFile {
+	if file, ok := OpenFiles[uri]; ok {
+		return file
+	}
+	if file, ok := WorkspaceFiles[uri]; ok {
+		return file
+	}
+	return nil
+}
+
+// setWorkspaceFile stores the index entry of uri. Must be called with
+// serverMutex held.
+func setWorkspaceFile(uri string, file *OpenFile) {
+	workspaceVersions[uri]++
+	WorkspaceFiles[uri] = file
+}
+
+// removeWorkspaceFile drops the index entry of uri. Must be called with
+// serverMutex held.
+func removeWorkspaceFile(uri string) {
+	workspaceVersions[uri]++
+	delete(WorkspaceFiles, uri)
+}
+
+// findWorkspaceGrammars returns the paths of all grammar files in folders.
+func findWorkspaceGrammars(folders []WorkspaceFolder) []string {
+	paths := []string{}
+	for _, folder := range folders {
+		root := uriToPath(folder.URI)
+		filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				debugLogger.Printf("Failed to walk %s: %v", path, err)
+				return nil
+			}
+			if entry.IsDir() {
+				for _, skipped := range skippedDirectories {
+					if entry.Name() == skipped {
+						return filepath.SkipDir
+					}
+				}
+				return nil
+			}
+			if filepath.Ext(path) == GrammarExtension {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+	}
+	return paths
+}
+
+// indexWorkspace reads every grammar in the workspace folders into
+// WorkspaceFiles. The folders are searched and files are read and parsed
+// without holding serverMutex so requests are served while indexing.
+func indexWorkspace() {
+	serverMutex.Lock()
+	folders := slices.Clone(WorkspaceFolders)
+	serverMutex.Unlock()
+
+	paths := findWorkspaceGrammars(folders)
+	for _, path := range paths {
+		uri := pathToURI(path)
+		serverMutex.Lock()
+		version := workspaceVersions[uri]
+		serverMutex.Unlock()
+
+		text, err := os.ReadFile(path)
+		if err != nil {
+			debugLogger.Printf("Failed to index %s: %v", path, err)
+			continue
+		}
+		file := TextToOpenFile(string(text))
+
+		serverMutex.Lock()
+		// A watched file event or a closed document may have updated the
+		// entry since the file was read, with newer content.
+		if workspaceVersions[uri] == version {
+			setWorkspaceFile(uri, &file)
+		}
+		serverMutex.Unlock()
+	}
+
+	serverMutex.Lock()
+	defer serverMutex.Unlock()
+	debugLogger.Printf("Indexed %d grammars", len(paths))
+	if clientCapabilities.Workspace.Diagnostics.RefreshSupport {
+		sendRequest("workspace/diagnostic/refresh", nil)
+	}
+}
+
+// indexedURIs returns the URIs of all indexed grammars in a stable order.
+func indexedURIs() []string {
+	uris := make([]string, 0, len(WorkspaceFiles))
+	for uri := range WorkspaceFiles {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	return uris
+}
+
+// registerFileWatchers asks the client to notify the server of changes to
+// grammar files, including files that are not open.
+func registerFileWatchers() {
+	if !clientCapabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration {
+		return
+	}
+	sendRequest("client/registerCapability", map[string]interface{}{
+		"registrations": []map[string]interface{}{
+			{
+				"id":     "gbnf-watched-files",
+				"method": "workspace/didChangeWatchedFiles",
+				"registerOptions": map[string]interface{}{
+					"watchers": []map[string]interface{}{
+						{"globPattern": "**/*" + GrammarExtension},
+					},
+				},
+			},
+		},
+	})
+}
+
+const (
+	FileCreated = 1
+	FileChanged = 2
+	FileDeleted = 3
+)
+
+type DidChangeWatchedFilesParams struct {
+	Changes []struct {
+		URI  string `json:"uri"`
+		Type int    `json:"type"`
+	} `json:"changes"`
+}
+
+func handleWorkspaceDidChangeWatchedFiles(request Request) {
+	var params DidChangeWatchedFilesParams
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to unmarshal didChangeWatchedFiles: %v\nRaw: %s\n", err, request.Params)
+		return
+	}
+
+	for _, change := range params.Changes {
+		path := uriToPath(change.URI)
+		if filepath.Ext(path) != GrammarExtension {
+			continue
+		}
+		switch change.Type {
+		case FileCreated, FileChanged:
+			if _, err := loadWorkspaceFile(path); err != nil {
+				debugLogger.Printf("Failed to index %s: %v", path, err)
+			}
+		case FileDeleted:
+			removeWorkspaceFile(pathToURI(path))
+		}
+	}
+}
+
+// loadWorkspaceFile reads and parses the grammar at path into WorkspaceFiles.
+func loadWorkspaceFile(path string) (string, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	uri := pathToURI(path)
+	file := TextToOpenFile(string(text))
+	setWorkspaceFile(uri, &file)
+	return uri, nil
+}
+
+// openURIForPath returns the URI under which the file at path is open in the
+// editor, if any. Clients may encode URIs differently from pathToURI, so the
+// comparison is done on paths.
+func openURIForPath(path string) (string, bool) {
+	for uri := range OpenFiles {
+		if filepath.Clean(uriToPath(uri)) == filepath.Clean(path) {
+			return uri, true
+		}
+	}
+	return "", false
+}
+
+func uriToPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+	path := parsed.Path
+	if runtime.GOOS == "windows" {
+		// file:///C:/dir becomes /C:/dir.
+		path = strings.TrimPrefix(path, "/")
+	}
+	return filepath.FromSlash(path)
+}
+
+func pathToURI(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"gbnflsp/gbnf-engine/cli"
 	"gbnflsp/gbnf-engine/lsp"
+	"os"
+	"strings"
 )
 
 func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
 	lsp.Run()
 }
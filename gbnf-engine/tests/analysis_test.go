@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"slices"
+	"testing"
+
+	"gbnflsp/gbnf-engine/Analysis"
+	"gbnflsp/gbnf-engine/GBNFParser"
+)
+
+func analyze(t *testing.T, grammar string) (*Analysis.Analysis, *GBNFParser.Node) {
+	t.Helper()
+	file := GBNFParser.ParseGrammarFile("", grammar)
+	if len(file.Errors) > 0 {
+		t.Fatalf("Unexpected parse error %s", file.Errors[0].Message)
+	}
+	return Analysis.Analyze(file.AST), file.AST
+}
+
+func TestFirstAndNullable(t *testing.T) {
+	analysis, _ := analyze(t, `root ::= ws item ("," ws item)*
+item ::= [a-c] | "x" | list
+list ::= "[" root? "]"
+ws ::= [ \t]*
+`)
+	cases := []struct {
+		rule     string
+		first    string
+		nullable bool
+	}{
+		{"root", `[\t \[a-cx]`, false},
+		{"item", `[\[a-cx]`, false},
+		{"ws", `[\t ]`, true},
+	}
+	for _, c := range cases {
+		if first := GBNFParser.FormatCharClass(analysis.First(c.rule), false); first != c.first {
+			t.Errorf("Expected FIRST(%s) = %s, got %s", c.rule, c.first, first)
+		}
+		if analysis.Nullable(c.rule) != c.nullable {
+			t.Errorf("Expected %s nullable to be %t", c.rule, c.nullable)
+		}
+	}
+}
+
+func TestAmbiguities(t *testing.T) {
+	analysis, ast := analyze(t, `root ::= [a-z]+ | "null" | "nu" "x" | "0"
+other ::= "a" | "ab" | "b"
+ws ::= | " " ws
+`)
+	ambiguities, err := analysis.Ambiguities(ast.Children)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Analysis.Ambiguity{
+		{First: 0, Second: 1, Kind: Analysis.SameMatch, Example: "null"},
+		{First: 0, Second: 2, Kind: Analysis.SameMatch, Example: "nux"},
+		{First: 1, Second: 2, Kind: Analysis.SharedStart, Example: "nu"},
+		{First: 0, Second: 1, Kind: Analysis.PrefixMatch, Example: "a"},
+	}
+	if len(ambiguities) != len(expected) {
+		t.Fatalf("Expected %d ambiguities, got %+v", len(expected), ambiguities)
+	}
+	for index, ambiguity := range ambiguities {
+		ambiguity.Alternative = nil
+		if ambiguity != expected[index] {
+			t.Errorf("Expected %+v, got %+v", expected[index], ambiguity)
+		}
+	}
+}
+
+func TestFollow(t *testing.T) {
+	analysis, _ := analyze(t, `root ::= "[" ws (item ("," ws item)*)? "]" | item
+item ::= [0-9]+ ws
+ws ::= [ ]*
+`)
+	cases := []struct {
+		rule     string
+		follow   string
+		literals []string
+		end      bool
+	}{
+		{"root", `[]`, nil, true},
+		{"item", `[,\]]`, []string{",", "]"}, true},
+		{"ws", `[,0-9\]]`, []string{",", "]"}, true},
+	}
+	for _, c := range cases {
+		if follow := GBNFParser.FormatCharClass(analysis.Follow(c.rule), false); follow != c.follow {
+			t.Errorf("Expected FOLLOW(%s) = %s, got %s", c.rule, c.follow, follow)
+		}
+		if literals := analysis.FollowLiterals(c.rule); !slices.Equal(literals, c.literals) {
+			t.Errorf("Expected the literals following %s to be %q, got %q", c.rule, c.literals, literals)
+		}
+		if analysis.FollowedByEnd(c.rule) != c.end {
+			t.Errorf("Expected %s followed by end to be %t", c.rule, c.end)
+		}
+	}
+}
+
+func TestFirstLiterals(t *testing.T) {
+	analysis, _ := analyze(t, `root ::= value
+value ::= "tr" "ue" | "false" | "null" ws | number | "{" ws "}" | value ","
+number ::= "-"? [0-9]+
+ws ::= " "*
+`)
+	expected := []string{"-", "false", "null", "true", "{"}
+	if literals := analysis.FirstLiterals("root"); !slices.Equal(literals, expected) {
+		t.Errorf("Expected %v, got %v", expected, literals)
+	}
+
+	analysis, _ = analyze(t, `root ::= sign? ws "true"
+sign ::= "-" | "+"
+ws ::= " "*
+`)
+	expected = []string{" ", "+", "-", "true"}
+	if literals := analysis.FirstLiterals("root"); !slices.Equal(literals, expected) {
+		t.Errorf("Expected the literals after optional nodes too, got %v", literals)
+	}
+}
+
+func TestFollowLiterals(t *testing.T) {
+	analysis, _ := analyze(t, `root ::= "{" pair ("," ws pair)* "}"
+pair ::= key ":" ws value
+key ::= "\"" [a-z]+ "\""
+value ::= "true" | "null"
+ws ::= " "?
+`)
+	cases := []struct {
+		rule     string
+		literals []string
+	}{
+		{"key", []string{":"}},
+		{"ws", []string{"\"", "null", "true"}},
+		{"value", []string{",", "}"}},
+		{"pair", []string{",", "}"}},
+	}
+	for _, c := range cases {
+		if literals := analysis.FollowLiterals(c.rule); !slices.Equal(literals, c.literals) {
+			t.Errorf("Expected the literals following %s to be %q, got %q", c.rule, c.literals, literals)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	analysis, _ := analyze(t, `root ::= "{" (pair ("," pair)*)? "}"
+pair ::= key ":" value
+key ::= [a-z]{2,50} | "id"
+value ::= "true" | "false" | "null" | [0-9]+ | root
+`)
+	cases := []struct {
+		rule     string
+		expected Analysis.Metrics
+	}{
+		{"root", Analysis.Metrics{Depth: 4, ExpandedSize: 5, FanOut: 1, Recursive: true}},
+		{"pair", Analysis.Metrics{Depth: 0, ExpandedSize: 3, FanOut: 1, Recursive: true}},
+		{"key", Analysis.Metrics{Depth: 2, ExpandedSize: 52, FanOut: 2, Recursive: false}},
+		{"value", Analysis.Metrics{Depth: 2, ExpandedSize: 16, FanOut: 5, Recursive: true}},
+	}
+	for _, c := range cases {
+		if metrics := analysis.Metrics(c.rule); metrics != c.expected {
+			t.Errorf("Expected metrics of %s to be %+v, got %+v", c.rule, c.expected, metrics)
+		}
+	}
+
+	warnings := analysis.Metrics("key").Warnings(Analysis.Thresholds{MaxDepth: 1, MaxExpandedSize: 50})
+	expected := []string{"nesting depth 2 exceeds 1", "expands to about 52 elements, more than 50"}
+	if !slices.Equal(warnings, expected) {
+		t.Errorf("Expected warnings %v, got %v", expected, warnings)
+	}
+	if warnings := analysis.Metrics("key").Warnings(Analysis.DefaultThresholds); len(warnings) > 0 {
+		t.Errorf("Expected no warnings with the default thresholds, got %v", warnings)
+	}
+}
+
+func TestAnalysisDecodesLiteralsOnce(t *testing.T) {
+	analysis, _ := analyze(t, `root ::= "\\n" | quote
+quote ::= "\"\\\\"
+`)
+	if first := GBNFParser.FormatCharClass(analysis.First("root"), false); first != `["\\]` {
+		t.Errorf(`Expected FIRST(root) = ["\\], got %s`, first)
+	}
+	if literals := analysis.FirstLiterals("root"); !slices.Equal(literals, []string{`"\\`, `\n`}) {
+		t.Errorf("Expected the literals of root to be decoded once, got %q", literals)
+	}
+	if size := analysis.Metrics("quote").ExpandedSize; size != 3 {
+		t.Errorf("Expected quote to expand to 3 elements, got %d", size)
+	}
+}
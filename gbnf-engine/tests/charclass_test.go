@@ -0,0 +1,23 @@
+package tests
+
+import (
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"testing"
+)
+
+func TestParseCharClass(t *testing.T) {
+	ranges, negated, err := GBNFParser.ParseCharClass(`[^a-c\x41\]]`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []GBNFParser.CharRange{{Low: 'a', High: 'c'}, {Low: 'A', High: 'A'}, {Low: ']', High: ']'}}
+	if !negated || len(ranges) != len(expected) {
+		t.Fatalf("Expected negated %v, got %v %v", expected, negated, ranges)
+	}
+	for index := range expected {
+		if ranges[index] != expected[index] {
+			t.Errorf("Expected %v, got %v", expected[index], ranges[index])
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gbnflsp/gbnf-engine/cli"
+)
+
+type junitReport struct {
+	Suites []struct {
+		Name     string `xml:"name,attr"`
+		Tests    int    `xml:"tests,attr"`
+		Failures int    `xml:"failures,attr"`
+		Cases    []struct {
+			Name      string `xml:"name,attr"`
+			ClassName string `xml:"classname,attr"`
+			Failure   *struct {
+				Message string `xml:"message,attr"`
+			} `xml:"failure"`
+		} `xml:"testcase"`
+	} `xml:"testsuite"`
+}
+
+// writeFiles creates files below dir, mapping relative paths to contents.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// runFixtureTest runs the test command on fixtures and returns its exit code
+// and JUnit report.
+func runFixtureTest(t *testing.T, fixtures map[string]string) (int, junitReport) {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"grammar.gbnf": "root ::= \"ab\" | \"a\\nb\"\n"})
+	writeFiles(t, filepath.Join(dir, "fixtures"), fixtures)
+	reportPath := filepath.Join(dir, "report.xml")
+
+	code := cli.Run([]string{"test", filepath.Join(dir, "grammar.gbnf"), filepath.Join(dir, "fixtures"), "-junit", reportPath})
+	var report junitReport
+	if data, err := os.ReadFile(reportPath); err == nil {
+		if err := xml.Unmarshal(data, &report); err != nil {
+			t.Fatalf("Invalid JUnit report: %v\n%s", err, data)
+		}
+	}
+	return code, report
+}
+
+func TestFixtureMatching(t *testing.T) {
+	cases := []struct {
+		name    string
+		content string
+		failure string
+	}{
+		{"ok.accept.txt", "ab", ""},
+		{"newline.accept.txt", "ab\n", ""},
+		{"crlf.accept.txt", "ab\r\n", ""},
+		{"inner-newline.accept.txt", "a\nb\n", ""},
+		{"two-newlines.accept.txt", "ab\n\n", ":1:3: "},
+		{"mismatch.accept.txt", "ac", ":1:2: "},
+		{"ok.reject.txt", "abc", ""},
+		{"matches.reject.txt", "ab\n", "expected `root` to reject the text, but it matches"},
+	}
+	for _, c := range cases {
+		code, report := runFixtureTest(t, map[string]string{c.name: c.content})
+		if len(report.Suites) != 1 || len(report.Suites[0].Cases) != 1 {
+			t.Errorf("%s: expected one test case, got %+v", c.name, report)
+			continue
+		}
+		testCase := report.Suites[0].Cases[0]
+		if c.failure == "" {
+			if code != 0 || testCase.Failure != nil {
+				t.Errorf("%s: expected a pass, got exit code %d and %+v", c.name, code, testCase.Failure)
+			}
+			continue
+		}
+		if code != 1 || testCase.Failure == nil || !strings.Contains(testCase.Failure.Message, c.failure) {
+			t.Errorf("%s: expected a failure containing %q, got exit code %d and %+v", c.name, c.failure, code, testCase.Failure)
+		}
+	}
+}
+
+func TestFixtureDiscovery(t *testing.T) {
+	code, report := runFixtureTest(t, map[string]string{
+		"b.accept.txt":        "ab",
+		"a.reject.txt":        "b",
+		"nested/c.accept.txt": "a\nb",
+		"notes.txt":           "not a fixture",
+		"d.accept.md":         "not a fixture",
+	})
+	if code != 0 || len(report.Suites) != 1 {
+		t.Fatalf("Expected all fixtures to pass, got exit code %d and %+v", code, report)
+	}
+	suite := report.Suites[0]
+	if !strings.HasSuffix(suite.Name, "grammar.gbnf") || suite.Tests != 3 || suite.Failures != 0 {
+		t.Errorf("Unexpected suite %s with %d tests and %d failures", suite.Name, suite.Tests, suite.Failures)
+	}
+	expected := []struct{ name, className string }{
+		{"a.reject.txt", "reject"},
+		{"b.accept.txt", "accept"},
+		{filepath.Join("nested", "c.accept.txt"), "accept"},
+	}
+	for index, testCase := range suite.Cases {
+		if index >= len(expected) || !strings.HasSuffix(testCase.Name, expected[index].name) || testCase.ClassName != expected[index].className {
+			t.Errorf("Unexpected test case %d: %s (%s)", index, testCase.Name, testCase.ClassName)
+		}
+	}
+
+	if code, _ := runFixtureTest(t, map[string]string{"notes.txt": "not a fixture"}); code != 1 {
+		t.Errorf("Expected exit code 1 without fixtures, got %d", code)
+	}
+}
+
+func TestFixtureJUnitReportCountsFailures(t *testing.T) {
+	_, report := runFixtureTest(t, map[string]string{
+		"ok.accept.txt":   "ab",
+		"bad.accept.txt":  "b",
+		"bad.reject.txt":  "ab",
+		"good.reject.txt": "",
+	})
+	if len(report.Suites) != 1 || report.Suites[0].Tests != 4 || report.Suites[0].Failures != 2 {
+		t.Fatalf("Expected 4 tests and 2 failures, got %+v", report)
+	}
+	for _, testCase := range report.Suites[0].Cases {
+		failed := strings.HasPrefix(filepath.Base(testCase.Name), "bad.")
+		if failed != (testCase.Failure != nil) {
+			t.Errorf("%s: unexpected failure %+v", testCase.Name, testCase.Failure)
+		}
+	}
+}
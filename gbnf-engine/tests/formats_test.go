@@ -0,0 +1,212 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"gbnflsp/gbnf-engine/Formats"
+	"gbnflsp/gbnf-engine/GBNFParser"
+)
+
+func exportGrammar(t *testing.T, grammar string, format string) (string, []string) {
+	t.Helper()
+	ast := GBNFParser.ParseGrammarFile("", grammar).AST
+	text, issues, err := Formats.Export(ast, format, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return text, issues
+}
+
+func TestExportRules(t *testing.T) {
+	grammar := `root ::= "{" item{2,4} ( | "a\"b") [^"\n]* [0-9]{3,} x-y
+item ::= [a-z]
+x-y ::= "x"
+`
+	cases := []struct {
+		format   string
+		expected []string
+	}{
+		{Formats.Lark, []string{
+			"start: root",
+			`root: "{" item ~ 2..4 "a\"b"? /[^"\n]/* /[0-9]/ ~ 3 /[0-9]/* x_y`,
+			"x_y: \"x\"",
+		}},
+		{Formats.ANTLR4, []string{
+			"grammar test;",
+			"root : ROOT EOF ;",
+			`ROOT : '{' ITEM ITEM (ITEM ITEM?)? 'a"b'? ~["\n]* [0-9] [0-9] [0-9]+ X_Y ;`,
+			"fragment ITEM : [a-z] ;",
+		}},
+		{Formats.EBNF, []string{
+			`root ::= "{" item item (item item?)? ("a" '"' "b")? [^#x22#xA]* [0-9] [0-9] [0-9]+ x-y`,
+			"item ::= [a-z]",
+		}},
+	}
+	for _, c := range cases {
+		text, issues := exportGrammar(t, grammar, c.format)
+		if len(issues) != 0 {
+			t.Errorf("%s: unexpected issues %v", c.format, issues)
+		}
+		lines := strings.Split(text, "\n")
+		for _, expected := range c.expected {
+			found := false
+			for _, line := range lines {
+				found = found || line == expected
+			}
+			if !found {
+				t.Errorf("%s: expected line %q in\n%s", c.format, expected, text)
+			}
+		}
+	}
+}
+
+func TestExportReportsIssues(t *testing.T) {
+	grammar := `root ::= item? missing
+item ::= "a"
+item ::= "b"
+`
+	_, issues := exportGrammar(t, grammar, Formats.ANTLR4)
+	expected := []string{
+		"rule `item`: declared more than once; only the last declaration is exported",
+		"rule `root`: rule `missing` is not declared",
+	}
+	for _, issue := range expected {
+		found := false
+		for _, reported := range issues {
+			found = found || reported == issue
+		}
+		if !found {
+			t.Errorf("Expected issue %q, got %v", issue, issues)
+		}
+	}
+
+	_, issues = exportGrammar(t, `root ::= "a"?`+"\n", Formats.ANTLR4)
+	if len(issues) != 1 || !strings.Contains(issues[0], "ANTLR lexer rules") {
+		t.Errorf("Expected a nullable root issue, got %v", issues)
+	}
+}
+
+func TestExportUsesLastDeclaration(t *testing.T) {
+	text, _ := exportGrammar(t, "root ::= item\nitem ::= \"a\"\nitem ::= \"b\"\n", Formats.EBNF)
+	if !strings.Contains(text, `item ::= "b"`) || strings.Contains(text, `item ::= "a"`) {
+		t.Errorf("Expected only the last declaration of item, got\n%s", text)
+	}
+}
+
+func TestExportNamesANTLRGrammarAfterFile(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected string
+		issue    bool
+	}{
+		{"json_value", "json_value", false},
+		{"Json2", "Json2", false},
+		{"json-value", "JsonValue", true},
+		{"grammar", "Grammar", true},
+		{"2json", "Json", true},
+	}
+	ast := GBNFParser.ParseGrammarFile("", `root ::= "a"`+"\n").AST
+	for _, c := range cases {
+		text, issues, err := Formats.Export(ast, Formats.ANTLR4, c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(text, "grammar "+c.expected+";\n") {
+			t.Errorf("%s: expected grammar %s, got\n%s", c.name, c.expected, text)
+		}
+		if reported := len(issues) == 1 && strings.Contains(issues[0], c.expected+".g4"); reported != c.issue {
+			t.Errorf("%s: unexpected issues %v", c.name, issues)
+		}
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	ast := GBNFParser.ParseGrammarFile("", `root ::= "a"`+"\n").AST
+	if _, _, err := Formats.Export(ast, "yacc", "test"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestImportLark(t *testing.T) {
+	grammar := `?start: pair ("," pair)*
+pair: KEY ":" [VALUE]
+    | "null"i -> empty
+KEY: "a".."z" ~ 1..3
+VALUE: "\"" "x"+ "\""
+`
+	ast, errors, err := Formats.Import(grammar, Formats.Lark, "")
+	if err != nil || len(errors) != 0 {
+		t.Fatalf("Unexpected errors %v %v", err, errors)
+	}
+	expected := `root ::= pair ("," pair)*
+pair ::= KEY ":" VALUE? | [Nn] [Uu] [Ll] [Ll]
+KEY ::= [a-z]{1,3}
+VALUE ::= "\"" "x"+ "\""
+`
+	if formatted := GBNFParser.Format(ast); formatted != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, formatted)
+	}
+}
+
+func TestImportEBNF(t *testing.T) {
+	cases := []struct {
+		grammar  string
+		expected string
+	}{
+		{`/* W3C */
+list ::= item (',' item)* #x0A?
+item ::= [^#x22g-z]+ | "it's"
+`, `root ::= item ("," item)* "\n"?
+item ::= [^"g-z]+ | "it's"
+`},
+		{`(* ISO *)
+digits = { "0" | "1" }, [ "." ], 2 * "9" ;
+`, `root ::= ("0" | "1")* "."? "9"{2}
+`},
+	}
+	for _, c := range cases {
+		ast, errors, err := Formats.Import(c.grammar, Formats.EBNF, "")
+		if err != nil || len(errors) != 0 {
+			t.Fatalf("Unexpected errors %v %v", err, errors)
+		}
+		if formatted := GBNFParser.Format(ast); formatted != c.expected {
+			t.Errorf("Expected\n%s\ngot\n%s", c.expected, formatted)
+		}
+	}
+}
+
+func TestImportReportsUnsupportedConstructs(t *testing.T) {
+	cases := []struct {
+		format  string
+		grammar string
+		line    int
+		column  int
+		message string
+	}{
+		{Formats.Lark, "start: WORD\nWORD: /[a-z]+/\n", 1, 6, "regular expression terminals are not supported"},
+		{Formats.Lark, "start: /a(?!b)/\n", 0, 9, "negative lookahead `(?!b)` is not supported"},
+		{Formats.Lark, "start: /(?<=(a|b))c/\n", 0, 8, "lookbehind `(?<=(a|b))` is not supported"},
+		{Formats.Lark, "start: /\\\\(?=x)/\n", 0, 10, "lookahead `(?=x)` is not supported"},
+		{Formats.Lark, "start: /\\(?=x)/\n", 0, 7, "regular expression terminals are not supported"},
+		{Formats.Lark, "start: /[(?=]x/\n", 0, 7, "regular expression terminals are not supported"},
+		{Formats.Lark, "%ignore \" \"\nstart: \"a\"\n", 0, 0, "%ignore is not supported"},
+		{Formats.Lark, "start: missing\n", 0, 7, "rule `missing` is not declared"},
+		{Formats.EBNF, "a ::= b - 'c'\nb ::= 'c'\n", 0, 8, "exceptions (`A - B`) are not supported"},
+		{Formats.EBNF, "a = ? letters ? ;\n", 0, 4, "special sequences are not supported"},
+		{Formats.EBNF, "a ::= b (?= \"x\")?\nb ::= \"c\"\n", 0, 9, "expected an expression, found `?`"},
+	}
+	for _, c := range cases {
+		_, errors, err := Formats.Import(c.grammar, c.format, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(errors) != 1 {
+			t.Errorf("Expected one error for %q, got %v", c.grammar, errors)
+			continue
+		}
+		if errors[0].Line != c.line || errors[0].Column != c.column || !strings.HasPrefix(errors[0].Message, c.message) {
+			t.Errorf("Expected %q at %d:%d for %q, got %q at %d:%d", c.message, c.line, c.column, c.grammar, errors[0].Message, errors[0].Line, errors[0].Column)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gbnflsp/gbnf-engine/GBNFParser"
+)
+
+func writeGrammars(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestResolveImportsTransitively(t *testing.T) {
+	dir := writeGrammars(t, map[string]string{
+		"root.gbnf":        "# @import \"lib/json.gbnf\"\nroot ::= value",
+		"lib/json.gbnf":    "# @import \"ws.gbnf\"\n# @import \"another.gbnf\"\nvalue ::= ws \"1\"",
+		"lib/ws.gbnf":      "# @import \"another.gbnf\"\nws ::= \" \"*",
+		"lib/unused.gbnf":  "unused ::= \"x\"",
+		"lib/another.gbnf": "another ::= \"x\"",
+	})
+	root, err := GBNFParser.ReadGrammarFile(filepath.Join(dir, "root.gbnf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, errs := GBNFParser.NewImportResolver().Resolve(root)
+
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs[0].Message)
+	}
+	names := []string{}
+	for _, file := range imported {
+		names = append(names, filepath.Base(file.Path))
+	}
+	if strings.Join(names, ",") != "json.gbnf,ws.gbnf,another.gbnf" {
+		t.Errorf("Expected json.gbnf, ws.gbnf and another.gbnf once each, got %v", names)
+	}
+}
+
+func TestResolveImportsReportsCycles(t *testing.T) {
+	dir := writeGrammars(t, map[string]string{
+		"a.gbnf": "# @import \"b.gbnf\"\nroot ::= b",
+		"b.gbnf": "# @import \"a.gbnf\"\nb ::= \"b\"",
+	})
+	root, _ := GBNFParser.ReadGrammarFile(filepath.Join(dir, "a.gbnf"))
+
+	_, errs := GBNFParser.NewImportResolver().Resolve(root)
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Message, "cycle") {
+		t.Fatalf("Expected an import cycle error, got %v", errs)
+	}
+	if errs[0].Via.Value != "b.gbnf" {
+		t.Errorf("Expected the error to be reported via the import of b.gbnf, got %v", errs[0].Via.Value)
+	}
+}
+
+func TestResolveImportsReportsMissingFiles(t *testing.T) {
+	dir := writeGrammars(t, map[string]string{
+		"a.gbnf": "# @import \"missing.gbnf\"\nroot ::= \"a\"",
+	})
+	root, _ := GBNFParser.ReadGrammarFile(filepath.Join(dir, "a.gbnf"))
+
+	_, errs := GBNFParser.NewImportResolver().Resolve(root)
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Message, "cannot read") {
+		t.Errorf("Expected a missing file error, got %v", errs)
+	}
+}
+
+func TestFlattenCombinesRules(t *testing.T) {
+	dir := writeGrammars(t, map[string]string{
+		"root.gbnf": "# @import \"ws.gbnf\"\nroot ::= ws \"a\"",
+		"ws.gbnf":   "ws ::= \" \"*",
+	})
+	root, _ := GBNFParser.ReadGrammarFile(filepath.Join(dir, "root.gbnf"))
+	imported, _ := GBNFParser.NewImportResolver().Resolve(root)
+
+	flattened, errs := GBNFParser.Flatten(root, imported)
+
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	expected := "root ::= ws \"a\"\nws ::= \" \"*\n"
+	if GBNFParser.Format(flattened) != expected {
+		t.Errorf("Expected %q, got %q", expected, GBNFParser.Format(flattened))
+	}
+}
+
+func TestBundleRenamesClashingRulesAndDropsUnreachable(t *testing.T) {
+	dir := writeGrammars(t, map[string]string{
+		"root.gbnf":     "# @import \"lib/json.gbnf\"\nroot ::= value ws\nws ::= \" \"?",
+		"lib/json.gbnf": "value ::= \"1\" ws\nws ::= [ \\t]*\nunused ::= \"u\"",
+	})
+	root, _ := GBNFParser.ReadGrammarFile(filepath.Join(dir, "root.gbnf"))
+	imported, _ := GBNFParser.NewImportResolver().Resolve(root)
+
+	bundle, errs := GBNFParser.BundleGrammar(root, imported)
+
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	expected := "root ::= value ws\nvalue ::= \"1\" json-ws\njson-ws ::= [ \\t]*\nws ::= \" \"?\n"
+	if GBNFParser.Format(bundle.AST) != expected {
+		t.Errorf("Expected %q, got %q", expected, GBNFParser.Format(bundle.AST))
+	}
+	if !strings.Contains(bundle.Format(dir), "#   json-ws <- lib/json.gbnf:2 (ws)") {
+		t.Errorf("Expected a source map entry for json-ws, got %q", bundle.Format(dir))
+	}
+}
+
+func TestBundleRequiresRoot(t *testing.T) {
+	dir := writeGrammars(t, map[string]string{"lib.gbnf": "ws ::= \" \""})
+	root, _ := GBNFParser.ReadGrammarFile(filepath.Join(dir, "lib.gbnf"))
+
+	_, errs := GBNFParser.BundleGrammar(root, nil)
+
+	if len(errs) != 1 {
+		t.Errorf("Expected a missing root error, got %v", errs)
+	}
+}
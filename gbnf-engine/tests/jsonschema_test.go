@@ -0,0 +1,219 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/JSONSchema"
+)
+
+func ruleBody(grammar string, name string) string {
+	for _, line := range strings.Split(grammar, "\n") {
+		if strings.HasPrefix(line, name+" ::= ") {
+			return strings.TrimPrefix(line, name+" ::= ")
+		}
+	}
+	return ""
+}
+
+func TestConvertObjectKeepsPropertyOrder(t *testing.T) {
+	schema := `{"type": "object", "properties": {"b": {"type": "integer"}, "a": {"type": "string"}}, "required": ["b", "a"], "additionalProperties": false}`
+
+	grammar, warnings, err := JSONSchema.Convert([]byte(schema))
+
+	if err != nil || len(warnings) != 0 {
+		t.Fatalf("Unexpected error %v or warnings %v", err, warnings)
+	}
+	if body := ruleBody(grammar, "root"); body != `"{" space root-b-kv "," space root-a-kv "}" space` {
+		t.Errorf("Unexpected root rule: %s", body)
+	}
+	if body := ruleBody(grammar, "root-b-kv"); body != `"\"b\"" space ":" space integer` {
+		t.Errorf("Unexpected property rule: %s", body)
+	}
+}
+
+func TestConvertArrayBounds(t *testing.T) {
+	schema := `{"type": "array", "items": {"type": "boolean"}, "minItems": 1, "maxItems": 3}`
+
+	grammar, _, err := JSONSchema.Convert([]byte(schema))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := ruleBody(grammar, "root"); body != `"[" space boolean ("," space boolean){0,2} "]" space` {
+		t.Errorf("Unexpected root rule: %s", body)
+	}
+}
+
+func TestConvertConst(t *testing.T) {
+	grammar, _, err := JSONSchema.Convert([]byte(`{"const": "x"}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := ruleBody(grammar, "root"); body != `"\"x\"" space` {
+		t.Errorf("Unexpected root rule: %s", body)
+	}
+	if body := ruleBody(grammar, "space"); body == "" {
+		t.Errorf("Expected the space rule to be declared, got:\n%s", grammar)
+	}
+}
+
+func TestConvertRecursiveReference(t *testing.T) {
+	schema := `{"$ref": "#/$defs/tree", "$defs": {"tree": {"type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#/$defs/tree"}}}}}}`
+
+	grammar, _, err := JSONSchema.Convert([]byte(schema))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := ruleBody(grammar, "root"); body != "tree" {
+		t.Errorf("Expected root to refer to tree, got %s", body)
+	}
+	if body := ruleBody(grammar, "tree-children"); body != `"[" space (tree ("," space tree)*)? "]" space` {
+		t.Errorf("Expected items to refer to tree, got %s", body)
+	}
+}
+
+func TestConvertPattern(t *testing.T) {
+	schema := `{"type": "string", "pattern": "^[a-z]+-\\d{2}$"}`
+
+	grammar, _, err := JSONSchema.Convert([]byte(schema))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := ruleBody(grammar, "root"); body != `"\"" [a-z]+ "-" [0-9]{2} "\"" space` {
+		t.Errorf("Unexpected root rule: %s", body)
+	}
+}
+
+func TestConvertPatternGroupWithClashingName(t *testing.T) {
+	schema := `{
+		"type": "object",
+		"properties": {
+			"code-digit": {"type": "string", "maxLength": 2},
+			"code": {"type": "string", "pattern": "^(?P<digit>[0-9])$"}
+		}
+	}`
+
+	grammar, _, err := JSONSchema.Convert([]byte(schema))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := ruleBody(grammar, "root-code-digit"); body != `"\"" char{0,2} "\"" space` {
+		t.Errorf("Expected the property rule to be kept, got %s", body)
+	}
+	if body := ruleBody(grammar, "root-code"); body != `"\"" root-code-digit0 "\"" space` {
+		t.Errorf("Expected the pattern to refer to the renamed group rule, got %s", body)
+	}
+	if body := ruleBody(grammar, "root-code-digit0"); body != "[0-9]" {
+		t.Errorf("Expected the group rule under its new name, got %s", body)
+	}
+}
+
+func TestConvertReportsUnsupportedKeywords(t *testing.T) {
+	schema := `{"type": "integer", "minimum": 3}`
+
+	_, warnings, err := JSONSchema.Convert([]byte(schema))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "minimum") {
+		t.Errorf("Expected a warning about minimum, got %v", warnings)
+	}
+}
+
+func TestConvertRejectsUnresolvableReference(t *testing.T) {
+	_, _, err := JSONSchema.Convert([]byte(`{"$ref": "#/$defs/missing"}`))
+
+	if err == nil {
+		t.Error("Expected an error for a missing reference")
+	}
+}
+
+func inferSchema(t *testing.T, grammar string) (string, []string) {
+	file := GBNFParser.ParseGrammarFile("", grammar)
+	if len(file.Errors) > 0 {
+		t.Fatalf("Unexpected parse error: %s", file.Errors[0].Message)
+	}
+	schema, unmapped := JSONSchema.Infer(file.AST)
+	if schema == nil {
+		t.Fatalf("Expected a schema, got %v", unmapped)
+	}
+	delete(schema.Values, "$schema")
+	schema.Keys = schema.Keys[1:]
+	return JSONSchema.Encode(schema), unmapped
+}
+
+func TestInferRoundTripsConvertedSchema(t *testing.T) {
+	schema := `{"type":"object","properties":{"name":{"type":"string"},"tags":{"type":"array","items":{"enum":["a","b"]},"maxItems":3},"age":{"type":"integer"}},"required":["name"],"additionalProperties":false}`
+	grammar, _, err := JSONSchema.Convert([]byte(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inferred, unmapped := inferSchema(t, grammar)
+
+	if len(unmapped) != 0 {
+		t.Errorf("Unexpected unmapped rules: %v", unmapped)
+	}
+	if inferred != schema {
+		t.Errorf("Expected %s, got %s", schema, inferred)
+	}
+}
+
+func TestInferHandWrittenObject(t *testing.T) {
+	grammar := "root ::= \"{\" ws \"\\\"kind\\\":\" ws \"\\\"user\\\"\" ws \",\" ws \"\\\"ids\\\":\" ws \"[\" ws (id (ws \",\" ws id)*)? ws \"]\" ws \"}\"\n" +
+		"id ::= \"-\"? [0-9]+\n" +
+		"ws ::= [ \\t\\n]*\n"
+
+	inferred, unmapped := inferSchema(t, grammar)
+
+	if len(unmapped) != 0 {
+		t.Errorf("Unexpected unmapped rules: %v", unmapped)
+	}
+	expected := `{"type":"object","properties":{"kind":{"const":"user"},"ids":{"type":"array","items":{"type":"integer"}}},"required":["kind","ids"],"additionalProperties":false}`
+	if inferred != expected {
+		t.Errorf("Expected %s, got %s", expected, inferred)
+	}
+}
+
+func TestInferReportsUnmappedRules(t *testing.T) {
+	grammar := "root ::= \"{\" \"\\\"a\\\":\" word \"}\"\nword ::= [a-z]+\n"
+
+	inferred, unmapped := inferSchema(t, grammar)
+
+	if len(unmapped) != 1 || !strings.Contains(unmapped[0], "`word`") {
+		t.Errorf("Expected word to be reported, got %v", unmapped)
+	}
+	if inferred != `{"type":"object","properties":{"a":{}},"required":["a"],"additionalProperties":false}` {
+		t.Errorf("Unexpected schema %s", inferred)
+	}
+}
+
+func TestInferStringCharacters(t *testing.T) {
+	cases := []struct {
+		grammar  string
+		expected string
+		reported bool
+	}{
+		{"root ::= \"\\\"\" char{1,3} \"\\\"\"\nchar ::= [^\"\\\\\\x7F\\x00-\\x1F] | [\\\\] ([\"\\\\bfnrt] | \"u\" [0-9a-fA-F]{4})\n", `{"type":"string","minLength":1,"maxLength":3}`, false},
+		{"root ::= \"\\\"\" ([^\"\\\\] | \"\\\\\" [\"\\\\nt])* \"\\\"\"\n", `{"type":"string"}`, false},
+		{"root ::= \"\\\"\" [0-9]{5} \"\\\"\"\n", `{"type":"string","minLength":5,"maxLength":5}`, true},
+		{"root ::= \"\\\"\" \"ab\"{2} \"\\\"\"\n", `{"type":"string"}`, true},
+		{"root ::= \"\\\"\" [a-z]+ \"-\" [0-9]+ \"\\\"\"\n", `{"type":"string"}`, true},
+	}
+	for _, c := range cases {
+		inferred, unmapped := inferSchema(t, c.grammar)
+		if inferred != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.grammar, c.expected, inferred)
+		}
+		if reported := len(unmapped) == 1 && strings.Contains(unmapped[0], "string of any characters"); reported != c.reported || len(unmapped) > 1 {
+			t.Errorf("%s: expected the approximation to be reported: %v, got %v", c.grammar, c.reported, unmapped)
+		}
+	}
+}
@@ -224,3 +224,87 @@ func TestUnterminatedStringMultiline(t *testing.T) {
 		}
 	}
 }
+
+func TestImportPragma(t *testing.T) {
+	tokens := CollectTokens("# @import \"common/json.gbnf\"\nroot ::= ws")
+
+	if tokens[0].Type != GBNFParser.TokenImport || tokens[0].Value != "common/json.gbnf" {
+		t.Fatalf("Expected TokenImport 'common/json.gbnf', got %+v", tokens[0])
+	}
+	if tokens[1].Type != GBNFParser.TokenEOL || tokens[2].Type != GBNFParser.TokenIdentifier {
+		t.Errorf("Expected TokenEOL and TokenIdentifier after import, got %+v", tokens[1:])
+	}
+}
+
+func TestImportPragmaWithoutPath(t *testing.T) {
+	tokens := CollectTokens("# @import common.gbnf")
+
+	if tokens[0].Type != GBNFParser.TokenImport || !strings.Contains(tokens[0].Error, "quoted path") {
+		t.Errorf("Expected missing path error, got %+v", tokens[0])
+	}
+}
+
+func TestImportLookalikeIsComment(t *testing.T) {
+	tokens := CollectTokens("# @imports \"a.gbnf\"")
+
+	if len(tokens) != 1 || tokens[0].Type != GBNFParser.TokenEOL {
+		t.Errorf("Expected a plain comment, got %+v", tokens)
+	}
+}
+
+func TestRegexTokenEscapedBracket(t *testing.T) {
+	tokens := CollectTokens(`[\]\\] "a"`)
+
+	if tokens[0].Type != GBNFParser.TokenRegexp || tokens[0].Value != `[\]\\]` {
+		t.Errorf("Expected TokenRegexp with value '[\\]\\\\]', got %+v", tokens[0])
+	}
+	if tokens[1].Type != GBNFParser.TokenString {
+		t.Errorf("Expected TokenString after the class, got %+v", tokens[1])
+	}
+}
+
+func TestTokenEndPositionCoversEscapes(t *testing.T) {
+	tokens := CollectTokens(`a ::= "\"\\"`)
+
+	if tokens[2].Value != `\"\\` || tokens[2].EndLine != 0 || tokens[2].EndColumn != 12 {
+		t.Errorf("Expected the string to end at column 12, got %+v", tokens[2])
+	}
+}
+
+func TestIsValidIdentifier(t *testing.T) {
+	for _, name := range []string{"root", "ws", "key-2", "é"} {
+		if !GBNFParser.IsValidIdentifier(name) {
+			t.Errorf("Expected `%s` to be a valid identifier", name)
+		}
+	}
+	for _, name := range []string{"", "2key", "-key", "my rule", "a_b", `"a"`} {
+		if GBNFParser.IsValidIdentifier(name) {
+			t.Errorf("Expected `%s` not to be a valid identifier", name)
+		}
+	}
+}
+
+func TestStringTokenKeepsEscapes(t *testing.T) {
+	cases := []struct {
+		source  string
+		value   string
+		decoded string
+	}{
+		{`"\\\\"`, `\\\\`, `\\`},
+		{`"\\n"`, `\\n`, `\n`},
+		{`"\n"`, `\n`, "\n"},
+		{`"\""`, `\"`, `"`},
+		{`"a\\\"b"`, `a\\\"b`, `a\"b`},
+	}
+	for _, c := range cases {
+		tokens := CollectTokens(c.source)
+		if tokens[0].Type != GBNFParser.TokenString || tokens[0].Value != c.value {
+			t.Errorf("%s: expected the value %q, got %+v", c.source, c.value, tokens[0])
+			continue
+		}
+		decoded, err := GBNFParser.UnescapeString(tokens[0].Value)
+		if err != nil || decoded != c.decoded {
+			t.Errorf("%s: expected to decode to %q, got %q (%v)", c.source, c.decoded, decoded, err)
+		}
+	}
+}
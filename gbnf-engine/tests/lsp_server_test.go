@@ -0,0 +1,598 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gbnflsp/gbnf-engine/lsp"
+)
+
+// lspMessage is a message from the server: a response, a notification or a
+// request to the client.
+type lspMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// lspSession talks to a server started with lsp.Serve.
+type lspSession struct {
+	t        *testing.T
+	input    *io.PipeWriter
+	messages chan lspMessage
+	// pending holds the messages read while waiting for another one.
+	pending []lspMessage
+	nextID  int
+}
+
+func startSession(t *testing.T) *lspSession {
+	t.Helper()
+	inputReader, inputWriter := io.Pipe()
+	outputReader, outputWriter := io.Pipe()
+	session := &lspSession{t: t, input: inputWriter, messages: make(chan lspMessage, 256)}
+
+	done := make(chan struct{})
+	go func() {
+		lsp.Serve(inputReader, outputWriter)
+		outputWriter.Close()
+		close(done)
+	}()
+	go func() {
+		defer close(session.messages)
+		reader := bufio.NewReader(outputReader)
+		for {
+			length := 0
+			for {
+				header, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				header = strings.TrimSpace(header)
+				if header == "" {
+					break
+				}
+				if value, ok := strings.CutPrefix(header, "Content-Length:"); ok {
+					length, _ = strconv.Atoi(strings.TrimSpace(value))
+				}
+			}
+			body := make([]byte, length)
+			if _, err := io.ReadFull(reader, body); err != nil {
+				return
+			}
+			var message lspMessage
+			if err := json.Unmarshal(body, &message); err == nil {
+				session.messages <- message
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		inputWriter.Close()
+		<-done
+	})
+	return session
+}
+
+func (session *lspSession) send(message map[string]any) {
+	session.t.Helper()
+	message["jsonrpc"] = "2.0"
+	data, err := json.Marshal(message)
+	if err != nil {
+		session.t.Fatal(err)
+	}
+	if _, err := fmt.Fprintf(session.input, "Content-Length: %d\r\n\r\n%s", len(data), data); err != nil {
+		session.t.Fatal(err)
+	}
+}
+
+// notify sends a notification.
+func (session *lspSession) notify(method string, params any) {
+	session.t.Helper()
+	session.send(map[string]any{"method": method, "params": params})
+}
+
+// request sends a request and returns its response.
+func (session *lspSession) request(method string, params any) lspMessage {
+	session.t.Helper()
+	session.nextID++
+	id := strconv.Itoa(session.nextID)
+	session.send(map[string]any{"id": session.nextID, "method": method, "params": params})
+	return session.waitFor(func(message lspMessage) bool {
+		return message.Method == "" && string(message.ID) == id
+	})
+}
+
+// waitFor returns the first message matching, skipping the others, which
+// remain available to later calls.
+func (session *lspSession) waitFor(matches func(message lspMessage) bool) lspMessage {
+	session.t.Helper()
+	for index, message := range session.pending {
+		if matches(message) {
+			session.pending = append(session.pending[:index], session.pending[index+1:]...)
+			return message
+		}
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case message, ok := <-session.messages:
+			if !ok {
+				session.t.Fatal("The server stopped before the expected message")
+			}
+			if matches(message) {
+				return message
+			}
+			session.pending = append(session.pending, message)
+		case <-timeout:
+			session.t.Fatal("Timed out waiting for a message from the server")
+		}
+	}
+}
+
+// waitForMethod returns the first notification or request of method.
+func (session *lspSession) waitForMethod(method string) lspMessage {
+	session.t.Helper()
+	return session.waitFor(func(message lspMessage) bool { return message.Method == method })
+}
+
+// initialize runs the initialize handshake with capabilities and any other
+// initialize parameters.
+func (session *lspSession) initialize(capabilities any, params map[string]any) {
+	session.t.Helper()
+	if params == nil {
+		params = map[string]any{}
+	}
+	params["capabilities"] = capabilities
+	if response := session.request("initialize", params); response.Error != nil {
+		session.t.Fatalf("initialize failed: %+v", response.Error)
+	}
+	session.notify("initialized", map[string]any{})
+}
+
+func (session *lspSession) open(uri string, version int, text string) {
+	session.t.Helper()
+	session.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "gbnf", "version": version, "text": text},
+	})
+}
+
+func (session *lspSession) change(uri string, version int, text string) {
+	session.t.Helper()
+	session.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": version},
+		"contentChanges": []map[string]any{{"text": text}},
+	})
+}
+
+func expectError(t *testing.T, name string, response lspMessage, code int) {
+	t.Helper()
+	if response.Error == nil || response.Error.Code != code {
+		t.Errorf("%s: expected error %d, got %s %+v", name, code, response.Result, response.Error)
+	}
+}
+
+func TestLifecycleErrors(t *testing.T) {
+	session := startSession(t)
+	hover := map[string]any{
+		"textDocument": map[string]any{"uri": "file:///lifecycle.gbnf"},
+		"position":     map[string]any{"line": 0, "character": 0},
+	}
+
+	// Notifications before initialize are dropped without a response.
+	session.notify("initialized", map[string]any{})
+	expectError(t, "before initialize", session.request("textDocument/hover", hover), lsp.ServerNotInitialized)
+
+	session.initialize(map[string]any{}, nil)
+	expectError(t, "second initialize", session.request("initialize", map[string]any{"capabilities": map[string]any{}}), lsp.InvalidRequest)
+	expectError(t, "unknown method", session.request("gbnf/unknown", nil), lsp.MethodNotFound)
+	session.notify("$/cancelRequest", map[string]any{"id": 1})
+
+	if response := session.request("shutdown", nil); response.Error != nil || string(response.Result) != "null" {
+		t.Errorf("shutdown: expected a null result, got %s %+v", response.Result, response.Error)
+	}
+	expectError(t, "after shutdown", session.request("textDocument/hover", hover), lsp.InvalidRequest)
+	expectError(t, "shutdown twice", session.request("shutdown", nil), lsp.InvalidRequest)
+
+	for _, message := range session.pending {
+		t.Errorf("Unexpected message %s %s", message.Method, message.ID)
+	}
+}
+
+func TestDiagnosticsAreDebounced(t *testing.T) {
+	delay := lsp.DiagnosticsDelay
+	lsp.DiagnosticsDelay = 50 * time.Millisecond
+	defer func() { lsp.DiagnosticsDelay = delay }()
+
+	session := startSession(t)
+	session.initialize(map[string]any{}, nil)
+	uri := "file:///debounce.gbnf"
+	session.open(uri, 1, "root ::= a\n")
+	session.change(uri, 2, "root ::= b\n")
+	session.change(uri, 3, "root ::= \"c\"\n")
+	// Closing and reopening at the same version starts over.
+	session.notify("textDocument/didClose", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	session.open(uri, 3, "root ::= c\n")
+
+	message := session.waitForMethod("textDocument/publishDiagnostics")
+	var params lsp.PublishDiagnosticsParams
+	if err := json.Unmarshal(message.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.Version != 3 || len(params.Diagnostics) != 1 || !strings.Contains(params.Diagnostics[0].Message, "`c`") {
+		t.Errorf("Expected the diagnostics of the reopened document, got %+v", params)
+	}
+
+	// Waiting longer than the delay shows that no other diagnostics follow.
+	time.Sleep(4 * lsp.DiagnosticsDelay)
+	session.request("shutdown", nil)
+	for _, message := range session.pending {
+		if message.Method == "textDocument/publishDiagnostics" {
+			t.Errorf("Expected diagnostics to be published once, also got %s", message.Params)
+		}
+	}
+}
+
+type diagnosticReport struct {
+	Kind     string            `json:"kind"`
+	ResultID string            `json:"resultId"`
+	Items    []*lsp.Diagnostic `json:"items"`
+	URI      string            `json:"uri"`
+}
+
+func TestPullDiagnosticsUnchanged(t *testing.T) {
+	session := startSession(t)
+	session.initialize(map[string]any{"textDocument": map[string]any{"diagnostic": map[string]any{}}}, nil)
+	uri := "file:///pull.gbnf"
+	session.open(uri, 1, "root ::= item\n")
+
+	pull := func(previousResultID string) diagnosticReport {
+		t.Helper()
+		response := session.request("textDocument/diagnostic", map[string]any{
+			"textDocument":     map[string]any{"uri": uri},
+			"previousResultId": previousResultID,
+		})
+		var report diagnosticReport
+		if err := json.Unmarshal(response.Result, &report); err != nil {
+			t.Fatalf("Invalid report %s: %v", response.Result, err)
+		}
+		return report
+	}
+
+	first := pull("")
+	if first.Kind != "full" || first.ResultID == "" || len(first.Items) != 1 {
+		t.Fatalf("Expected a full report with one diagnostic, got %+v", first)
+	}
+	if unchanged := pull(first.ResultID); unchanged.Kind != "unchanged" || unchanged.ResultID != first.ResultID || unchanged.Items != nil {
+		t.Errorf("Expected an unchanged report, got %+v", unchanged)
+	}
+
+	session.change(uri, 2, "root ::= \"item\"\n")
+	changed := pull(first.ResultID)
+	if changed.Kind != "full" || changed.ResultID == first.ResultID || len(changed.Items) != 0 {
+		t.Errorf("Expected a new full report without diagnostics, got %+v", changed)
+	}
+
+	for _, message := range session.pending {
+		if message.Method == "textDocument/publishDiagnostics" {
+			t.Errorf("Expected no pushed diagnostics for a client pulling them, got %s", message.Params)
+		}
+	}
+}
+
+func TestWorkspaceIndexing(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.gbnf":                "root ::= b\n",
+		"sub/b.gbnf":            "root ::= \"b\"\n",
+		"node_modules/c.gbnf":   "root ::= c\n",
+		".git/d.gbnf":           "root ::= d\n",
+		"sub/notes.txt":         "not a grammar",
+		"sub/deeper/e.gbnf.txt": "not a grammar",
+	})
+	uri := func(name string) string { return "file://" + filepath.ToSlash(filepath.Join(dir, name)) }
+
+	session := startSession(t)
+	session.initialize(map[string]any{
+		"textDocument": map[string]any{"diagnostic": map[string]any{}},
+		"workspace":    map[string]any{"diagnostics": map[string]any{"refreshSupport": true}},
+	}, map[string]any{"rootUri": "file://" + filepath.ToSlash(dir)})
+	session.waitForMethod("workspace/diagnostic/refresh")
+
+	workspace := func(previous map[string]string) map[string]diagnosticReport {
+		t.Helper()
+		previousResultIDs := []map[string]any{}
+		for uri, value := range previous {
+			previousResultIDs = append(previousResultIDs, map[string]any{"uri": uri, "value": value})
+		}
+		response := session.request("workspace/diagnostic", map[string]any{"previousResultIds": previousResultIDs})
+		var report struct {
+			Items []diagnosticReport `json:"items"`
+		}
+		if err := json.Unmarshal(response.Result, &report); err != nil {
+			t.Fatalf("Invalid report %s: %v", response.Result, err)
+		}
+		items := map[string]diagnosticReport{}
+		for _, item := range report.Items {
+			items[item.URI] = item
+		}
+		return items
+	}
+	expectURIs := func(items map[string]diagnosticReport, expected ...string) {
+		t.Helper()
+		uris := []string{}
+		for uri := range items {
+			uris = append(uris, uri)
+		}
+		sort.Strings(uris)
+		sort.Strings(expected)
+		if strings.Join(uris, " ") != strings.Join(expected, " ") {
+			t.Errorf("Expected reports for %v, got %v", expected, uris)
+		}
+	}
+
+	items := workspace(nil)
+	expectURIs(items, uri("a.gbnf"), uri("sub/b.gbnf"))
+	if report := items[uri("a.gbnf")]; report.Kind != "full" || len(report.Items) != 1 {
+		t.Errorf("Expected the undefined rule in a.gbnf, got %+v", report)
+	}
+
+	unchanged := workspace(map[string]string{uri("a.gbnf"): items[uri("a.gbnf")].ResultID})
+	if report := unchanged[uri("a.gbnf")]; report.Kind != "unchanged" {
+		t.Errorf("Expected a.gbnf to be unchanged, got %+v", report)
+	}
+	if report := unchanged[uri("sub/b.gbnf")]; report.Kind != "full" {
+		t.Errorf("Expected a full report for sub/b.gbnf, got %+v", report)
+	}
+
+	writeFiles(t, dir, map[string]string{"e.gbnf": "root ::= \"e\"\n"})
+	if err := os.Remove(filepath.Join(dir, "sub", "b.gbnf")); err != nil {
+		t.Fatal(err)
+	}
+	session.notify("workspace/didChangeWatchedFiles", map[string]any{"changes": []map[string]any{
+		{"uri": uri("e.gbnf"), "type": lsp.FileCreated},
+		{"uri": uri("sub/b.gbnf"), "type": lsp.FileDeleted},
+	}})
+	expectURIs(workspace(nil), uri("a.gbnf"), uri("e.gbnf"))
+}
+
+type workspaceEdit struct {
+	Changes         map[string][]lsp.TextEdit `json:"changes"`
+	DocumentChanges []struct {
+		TextDocument struct {
+			URI     string `json:"uri"`
+			Version *int   `json:"version"`
+		} `json:"textDocument"`
+		Edits []lsp.TextEdit `json:"edits"`
+	} `json:"documentChanges"`
+}
+
+// renameWorkspace is a workspace in which `item` of lib.gbnf is used by
+// main.gbnf, while own.gbnf declares its own `item` and near.gbnf resolves
+// `item` to the one of own.gbnf, which it imports.
+func renameWorkspace(t *testing.T) (string, func(name string) string) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"lib.gbnf":  "item ::= \"x\"\n",
+		"main.gbnf": "# @import \"lib.gbnf\"\nroot ::= item item\n",
+		"own.gbnf":  "# @import \"lib.gbnf\"\nroot ::= item\nitem ::= \"own\"\n",
+		"near.gbnf": "# @import \"own.gbnf\"\nroot ::= item\n",
+	})
+	return dir, func(name string) string { return "file://" + filepath.ToSlash(filepath.Join(dir, name)) }
+}
+
+func renameItem(t *testing.T, documentChanges bool) (workspaceEdit, func(name string) string) {
+	t.Helper()
+	dir, uri := renameWorkspace(t)
+	session := startSession(t)
+	session.initialize(map[string]any{
+		"workspace": map[string]any{
+			"diagnostics":   map[string]any{"refreshSupport": true},
+			"workspaceEdit": map[string]any{"documentChanges": documentChanges},
+		},
+		"textDocument": map[string]any{"diagnostic": map[string]any{}},
+	}, map[string]any{"rootUri": "file://" + filepath.ToSlash(dir)})
+	session.waitForMethod("workspace/diagnostic/refresh")
+	text, _ := os.ReadFile(filepath.Join(dir, "main.gbnf"))
+	session.open(uri("main.gbnf"), 4, string(text))
+
+	response := session.request("textDocument/rename", map[string]any{
+		"textDocument": map[string]any{"uri": uri("main.gbnf")},
+		"position":     map[string]any{"line": 1, "character": 10},
+		"newName":      "entry",
+	})
+	if response.Error != nil {
+		t.Fatalf("rename failed: %+v", response.Error)
+	}
+	var edit workspaceEdit
+	if err := json.Unmarshal(response.Result, &edit); err != nil {
+		t.Fatalf("Invalid workspace edit %s: %v", response.Result, err)
+	}
+	return edit, uri
+}
+
+func TestRenameAcrossFiles(t *testing.T) {
+	edit, uri := renameItem(t, false)
+	if edit.DocumentChanges != nil {
+		t.Errorf("Expected no documentChanges for a client without support, got %+v", edit.DocumentChanges)
+	}
+	if len(edit.Changes) != 2 || len(edit.Changes[uri("main.gbnf")]) != 2 || len(edit.Changes[uri("lib.gbnf")]) != 1 {
+		t.Fatalf("Expected edits to main.gbnf and lib.gbnf only, got %+v", edit.Changes)
+	}
+	declaration := edit.Changes[uri("lib.gbnf")][0]
+	if declaration.NewText != "entry" || declaration.Range.Start != (lsp.Position{Line: 0, Character: 0}) {
+		t.Errorf("Expected the declaration in lib.gbnf to be renamed, got %+v", declaration)
+	}
+}
+
+func TestRenameUsesDocumentChanges(t *testing.T) {
+	edit, uri := renameItem(t, true)
+	if edit.Changes != nil {
+		t.Errorf("Expected no changes map with documentChanges, got %+v", edit.Changes)
+	}
+	if len(edit.DocumentChanges) != 2 {
+		t.Fatalf("Expected edits to two documents, got %+v", edit.DocumentChanges)
+	}
+	lib, main := edit.DocumentChanges[0], edit.DocumentChanges[1]
+	if lib.TextDocument.URI != uri("lib.gbnf") || lib.TextDocument.Version != nil || len(lib.Edits) != 1 {
+		t.Errorf("Expected an unversioned edit of lib.gbnf, got %+v", lib)
+	}
+	if main.TextDocument.URI != uri("main.gbnf") || main.TextDocument.Version == nil || *main.TextDocument.Version != 4 || len(main.Edits) != 2 {
+		t.Errorf("Expected an edit of version 4 of main.gbnf, got %+v", main)
+	}
+}
+
+// applyTextEdits applies non-overlapping edits to text.
+func applyTextEdits(text string, edits []lsp.TextEdit) string {
+	lines := strings.SplitAfter(text, "\n")
+	offset := func(position lsp.Position) int {
+		total := 0
+		for _, line := range lines[:position.Line] {
+			total += len(line)
+		}
+		return total + position.Character
+	}
+	sorted := append([]lsp.TextEdit{}, edits...)
+	sort.Slice(sorted, func(i int, j int) bool { return offset(sorted[i].Range.Start) > offset(sorted[j].Range.Start) })
+	for _, edit := range sorted {
+		text = text[:offset(edit.Range.Start)] + edit.NewText + text[offset(edit.Range.End):]
+	}
+	return text
+}
+
+func TestExtractRuleStartsRenameAtNewRule(t *testing.T) {
+	cases := []struct {
+		text      string
+		selection lsp.Range
+		expected  string
+		newRule   lsp.Position
+	}{
+		{
+			"root ::= \"a\" |\n  \"b\" \"c\"\n",
+			lsp.Range{Start: lsp.Position{Line: 1, Character: 2}, End: lsp.Position{Line: 1, Character: 9}},
+			"root ::= \"a\" |\n  new-rule\nnew-rule ::= \"b\" \"c\"\n",
+			lsp.Position{Line: 2},
+		},
+		{
+			"root ::= \"a\" (\"b\"\n  \"c\") \"d\"\nrest ::= root\n",
+			lsp.Range{Start: lsp.Position{Line: 0, Character: 13}, End: lsp.Position{Line: 1, Character: 6}},
+			"root ::= \"a\" new-rule \"d\"\nnew-rule ::= \"b\" \"c\"\nrest ::= root\n",
+			lsp.Position{Line: 1},
+		},
+	}
+	for _, c := range cases {
+		session := startSession(t)
+		session.initialize(map[string]any{}, nil)
+		uri := "file:///extract.gbnf"
+		session.open(uri, 1, c.text)
+
+		response := session.request("textDocument/codeAction", map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"range":        c.selection,
+			"context":      map[string]any{"diagnostics": []any{}, "only": []string{lsp.CodeActionRefactorExtract}},
+		})
+		var actions []struct {
+			Title string `json:"title"`
+			Edit  struct {
+				Changes map[string][]lsp.TextEdit `json:"changes"`
+			} `json:"edit"`
+			Command struct {
+				Command   string            `json:"command"`
+				Arguments []json.RawMessage `json:"arguments"`
+			} `json:"command"`
+		}
+		if err := json.Unmarshal(response.Result, &actions); err != nil || len(actions) != 1 {
+			t.Fatalf("Expected one extract action, got %s (%v)", response.Result, err)
+		}
+		action := actions[0]
+		text := applyTextEdits(c.text, action.Edit.Changes[uri])
+		if text != c.expected {
+			t.Errorf("Expected the extracted grammar\n%s\ngot\n%s", c.expected, text)
+		}
+
+		var position lsp.Position
+		if action.Command.Command != lsp.CommandStartRename || len(action.Command.Arguments) != 2 || json.Unmarshal(action.Command.Arguments[1], &position) != nil {
+			t.Fatalf("Expected a command starting a rename, got %+v", action.Command)
+		}
+		if position != c.newRule {
+			t.Errorf("Expected the rename to start at %+v, got %+v", c.newRule, position)
+		}
+
+		// The rename the command starts must find the new rule there.
+		session.change(uri, 2, text)
+		rename := session.request("textDocument/rename", map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     position,
+			"newName":      "pair",
+		})
+		var edit workspaceEdit
+		if rename.Error != nil || json.Unmarshal(rename.Result, &edit) != nil || len(edit.Changes[uri]) != 2 {
+			t.Errorf("Expected the rename to edit both uses of the new rule, got %s %+v", rename.Result, rename.Error)
+		}
+	}
+}
+
+func TestImportedGrammarsNeedNoRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"common/json.gbnf": "ws ::= [ \\t]*\nstring ::= \"\\\"\" [a-z]* \"\\\"\" ws\n",
+		"main.gbnf":        "# @import \"common/json.gbnf\"\nroot ::= string\n",
+		"orphan.gbnf":      "item ::= \"x\"\n",
+	})
+	uri := func(name string) string { return "file://" + filepath.ToSlash(filepath.Join(dir, name)) }
+
+	session := startSession(t)
+	session.initialize(map[string]any{
+		"textDocument": map[string]any{"diagnostic": map[string]any{}},
+		"workspace":    map[string]any{"diagnostics": map[string]any{"refreshSupport": true}},
+	}, map[string]any{"rootUri": "file://" + filepath.ToSlash(dir)})
+	session.waitForMethod("workspace/diagnostic/refresh")
+
+	workspace := func(previous map[string]string) map[string]diagnosticReport {
+		t.Helper()
+		previousResultIDs := []map[string]any{}
+		for uri, value := range previous {
+			previousResultIDs = append(previousResultIDs, map[string]any{"uri": uri, "value": value})
+		}
+		response := session.request("workspace/diagnostic", map[string]any{"previousResultIds": previousResultIDs})
+		var report struct {
+			Items []diagnosticReport `json:"items"`
+		}
+		if err := json.Unmarshal(response.Result, &report); err != nil {
+			t.Fatalf("Invalid report %s: %v", response.Result, err)
+		}
+		items := map[string]diagnosticReport{}
+		for _, item := range report.Items {
+			items[item.URI] = item
+		}
+		return items
+	}
+
+	items := workspace(nil)
+	library := items[uri("common/json.gbnf")]
+	if library.Kind != "full" || len(library.Items) != 0 {
+		t.Errorf("Expected no diagnostics for the imported grammar, got %+v", library)
+	}
+	if report := items[uri("orphan.gbnf")]; len(report.Items) != 2 {
+		t.Errorf("Expected a missing root and an unused rule in orphan.gbnf, got %+v", report)
+	}
+
+	// Once nothing imports it, the grammar needs a root and uses of its rules.
+	session.open(uri("main.gbnf"), 1, "root ::= \"a\"\n")
+	report := workspace(map[string]string{uri("common/json.gbnf"): library.ResultID})[uri("common/json.gbnf")]
+	if report.Kind != "full" || len(report.Items) != 2 {
+		t.Errorf("Expected a missing root and an unused rule in common/json.gbnf, got %+v", report)
+	}
+}
@@ -0,0 +1,32 @@
+package tests
+
+import (
+	"testing"
+
+	"gbnflsp/gbnf-engine/lsp"
+)
+
+func TestFuzzyMatchSubsequence(t *testing.T) {
+	if _, ok := lsp.FuzzyMatch("jstr", "json-string"); !ok {
+		t.Errorf("Expected `jstr` to match `json-string`")
+	}
+	if _, ok := lsp.FuzzyMatch("strj", "json-string"); ok {
+		t.Errorf("Expected `strj` not to match `json-string`")
+	}
+}
+
+func TestFuzzyMatchEmptyQuery(t *testing.T) {
+	if _, ok := lsp.FuzzyMatch("", "anything"); !ok {
+		t.Errorf("Expected an empty query to match")
+	}
+}
+
+func TestFuzzyMatchRanksExactAndPrefixHigher(t *testing.T) {
+	exact, _ := lsp.FuzzyMatch("ws", "ws")
+	prefix, _ := lsp.FuzzyMatch("ws", "ws-newline")
+	scattered, _ := lsp.FuzzyMatch("ws", "whitespace")
+
+	if !(exact > prefix && prefix > scattered) {
+		t.Errorf("Expected exact > prefix > scattered, got %d, %d, %d", exact, prefix, scattered)
+	}
+}
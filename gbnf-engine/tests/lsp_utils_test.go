@@ -102,3 +102,214 @@ func TestRuleMustDefineAllVariablesUndefinedReference(t *testing.T) {
 		t.Errorf("Unexpected diagnostic position: %+v", diag.Range.Start)
 	}
 }
+
+func TestRuleRepeatsShouldHaveSensibleBounds(t *testing.T) {
+	text := "root ::= \"a\"{0} [a-z]{2,5} [0-9]{0,500} \"x\"{200,}\n"
+
+	openFile := lsp.TextToOpenFile(text)
+	uri := "fake"
+	lsp.OpenFiles[uri] = &openFile
+
+	diagnostics := lsp.RuleRepeatsShouldHaveSensibleBounds(uri)
+
+	expected := []string{
+		"Repeat `{0}` matches only the empty string.",
+		"llama.cpp expands `{0,500}` into 500 copies and helper rules, more than the limit of 100.",
+		"llama.cpp expands `{200,}` into 201 copies and helper rules, more than the limit of 100.",
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d", len(expected), len(diagnostics))
+	}
+	for index, diag := range diagnostics {
+		if diag.Message != expected[index] {
+			t.Errorf("Unexpected diagnostic message: %s", diag.Message)
+		}
+	}
+	if diagnostics[1].Range.Start.Character != 32 {
+		t.Errorf("Unexpected diagnostic position: %+v", diagnostics[1].Range.Start)
+	}
+}
+
+func TestRuleMustDeclareVariablesOnce(t *testing.T) {
+	text := "root ::= item\nitem ::= \"a\"\nitem ::= \"b\"\n"
+
+	openFile := lsp.TextToOpenFile(text)
+	uri := "fake"
+	lsp.OpenFiles[uri] = &openFile
+
+	diagnostics := lsp.RuleMustDeclareVariablesOnce(uri)
+
+	expected := []string{
+		"Rule `item` is declared 2 times; llama.cpp only uses the declaration on line 3.",
+		"Rule `item` is declared 2 times; llama.cpp only uses this declaration.",
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d", len(expected), len(diagnostics))
+	}
+	for index, diag := range diagnostics {
+		if diag.Message != expected[index] {
+			t.Errorf("Unexpected diagnostic message: %s", diag.Message)
+		}
+		if len(diag.RelatedInformation) != 1 || diag.RelatedInformation[0].Location.Range.Start.Line != 2-index {
+			t.Errorf("Expected the other declaration as related information, got %+v", diag.RelatedInformation)
+		}
+	}
+}
+
+func TestCompletionItems(t *testing.T) {
+	text := "root ::= item (\n  item | \"a#\" ws ) # item\nitem ::= [a-z] \"x\"\n\nws ::= \n"
+
+	openFile := lsp.TextToOpenFile(text)
+	uri := "fake"
+	lsp.OpenFiles[uri] = &openFile
+
+	labels := func(position lsp.Position) []string {
+		labels := []string{}
+		for _, item := range lsp.CompletionItems(uri, position) {
+			labels = append(labels, item.Label)
+		}
+		return labels
+	}
+	cases := []struct {
+		name     string
+		position lsp.Position
+		expected []string
+	}{
+		{"after assignment", lsp.Position{Line: 0, Character: 9}, []string{"item", "ws", "root"}},
+		{"inside group on the next line", lsp.Position{Line: 1, Character: 2}, []string{"item", "ws", "root"}},
+		{"after alternative", lsp.Position{Line: 1, Character: 9}, []string{"item", "ws", "root"}},
+		{"inside string", lsp.Position{Line: 1, Character: 11}, []string{}},
+		{"inside character class", lsp.Position{Line: 2, Character: 11}, []string{}},
+		{"inside comment", lsp.Position{Line: 1, Character: 23}, []string{}},
+		{"rule name", lsp.Position{Line: 2, Character: 4}, []string{}},
+		{"start of line", lsp.Position{Line: 3, Character: 0}, []string{"name ::= "}},
+		{"empty body", lsp.Position{Line: 4, Character: 7}, []string{"item", "ws", "root"}},
+	}
+	for _, c := range cases {
+		got := labels(c.position)
+		if len(got) < len(c.expected) {
+			t.Errorf("%s: expected %v first, got %v", c.name, c.expected, got)
+			continue
+		}
+		for index, label := range c.expected {
+			if got[index] != label {
+				t.Errorf("%s: expected %v first, got %v", c.name, c.expected, got)
+				break
+			}
+		}
+		if len(c.expected) == 0 && len(got) != 0 {
+			t.Errorf("%s: expected no suggestions, got %v", c.name, got)
+		}
+	}
+}
+
+func TestCompletionItemsDeclaresUndefinedRules(t *testing.T) {
+	text := "root ::= value value number\n"
+
+	openFile := lsp.TextToOpenFile(text)
+	uri := "fake"
+	lsp.OpenFiles[uri] = &openFile
+
+	items := lsp.CompletionItems(uri, lsp.Position{Line: 1, Character: 0})
+	expected := []string{"value ::= ", "number ::= ", "name ::= "}
+	if len(items) != len(expected) {
+		t.Fatalf("Expected %d suggestions, got %+v", len(expected), items)
+	}
+	for index, item := range items {
+		if item.Label != expected[index] {
+			t.Errorf("Expected suggestion %q, got %q", expected[index], item.Label)
+		}
+	}
+
+	items = lsp.CompletionItems(uri, lsp.Position{Line: 0, Character: 9})
+	for _, item := range items {
+		if item.Label == "string" {
+			if len(item.AdditionalTextEdits) != 1 || item.AdditionalTextEdits[0].NewText != "string ::= \"\\\"\" char* \"\\\"\" space\nchar ::= [^\"\\\\\\x7F\\x00-\\x1F] | [\\\\] ([\"\\\\bfnrt] | \"u\" [0-9a-fA-F]{4})\nspace ::= | \" \" | \"\\n\"{1,2} [ \\t]{0,20}\n" {
+				t.Errorf("Expected the declarations of `string` and its dependencies, got %+v", item.AdditionalTextEdits)
+			}
+			return
+		}
+	}
+	t.Errorf("Expected the library rule `string` to be suggested")
+}
+
+// codeActionParams asks for the code actions at position in the document uri.
+func codeActionParams(uri string, position lsp.Position) lsp.CodeActionParams {
+	var params lsp.CodeActionParams
+	params.TextDocument.URI = uri
+	params.Range = lsp.Range{Start: position, End: position}
+	return params
+}
+
+func TestRegexCodeActionDecodesTheLiteral(t *testing.T) {
+	openFile := lsp.TextToOpenFile("root ::= \"[a-z]+@example\\\\.com\"\n")
+	uri := "fake"
+	lsp.OpenFiles[uri] = &openFile
+
+	actions := lsp.CodeActions(codeActionParams(uri, lsp.Position{Line: 0, Character: 12}))
+	if len(actions) != 1 {
+		t.Fatalf("Expected one code action, got %+v", actions)
+	}
+	edits := actions[0].Edit.Changes[uri]
+	if len(edits) != 1 || edits[0].NewText != `([a-z]+ "@example.com")` {
+		t.Errorf("Expected the escaped dot to match a dot, got %+v", edits)
+	}
+}
+
+func TestRegexCodeActionNamesRulesUniquely(t *testing.T) {
+	openFile := lsp.TextToOpenFile("root ::= \"(?P<user>[a-z]+)@example\\\\.com\"\nroot-user ::= \"x\"\n")
+	uri := "fake"
+	lsp.OpenFiles[uri] = &openFile
+
+	actions := lsp.CodeActions(codeActionParams(uri, lsp.Position{Line: 0, Character: 12}))
+	if len(actions) != 1 {
+		t.Fatalf("Expected one code action, got %+v", actions)
+	}
+	edits := actions[0].Edit.Changes[uri]
+	if len(edits) != 2 || edits[0].NewText != `(root-user-2 "@example.com")` || edits[1].NewText != "root-user-2 ::= [a-z]+\n" {
+		t.Errorf("Expected the group rule to be named root-user-2, got %+v", edits)
+	}
+}
+
+func TestDuplicateDeclarationCodeActions(t *testing.T) {
+	openFile := lsp.TextToOpenFile("root ::= item\nitem ::= \"a\"\nitem ::= \"b\"\n")
+	uri := "fake"
+	lsp.OpenFiles[uri] = &openFile
+
+	params := codeActionParams(uri, lsp.Position{Line: 1, Character: 0})
+	params.Context.Only = []string{lsp.CodeActionQuickFix}
+	actions := lsp.CodeActions(params)
+	if len(actions) != 2 {
+		t.Fatalf("Expected two quick fixes, got %+v", actions)
+	}
+	if actions[0].Title != "Keep last declaration of `item`" || actions[1].Title != "Combine declarations of `item` (changes meaning)" {
+		t.Errorf("Unexpected titles %q and %q", actions[0].Title, actions[1].Title)
+	}
+	edits := actions[0].Edit.Changes[uri]
+	if len(edits) != 1 || edits[0].Range.Start.Line != 1 || edits[0].NewText != "" {
+		t.Errorf("Expected the first declaration to be removed, got %+v", edits)
+	}
+}
+
+func TestDiagnosticResultIDDependsOnSettings(t *testing.T) {
+	openFile := lsp.TextToOpenFile("root ::= \"a\"{0,500}\n")
+	uri := "file:///settings.gbnf"
+	lsp.OpenFiles[uri] = &openFile
+	defer delete(lsp.OpenFiles, uri)
+	defer lsp.ApplySettings(nil)
+
+	if err := lsp.ApplySettings(nil); err != nil {
+		t.Fatalf("ApplySettings failed: %v", err)
+	}
+	defaultID := lsp.DiagnosticResultID(uri)
+	if lsp.DiagnosticResultID(uri) != defaultID {
+		t.Fatalf("expected the same result ID for the same text and settings")
+	}
+
+	if err := lsp.ApplySettings([]byte(`{"complexity":{"maxRepeatBound":1000}}`)); err != nil {
+		t.Fatalf("ApplySettings failed: %v", err)
+	}
+	if lsp.DiagnosticResultID(uri) == defaultID {
+		t.Errorf("expected a new result ID after changing maxRepeatBound")
+	}
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/Matcher"
+)
+
+func compileGrammar(t *testing.T, grammar string) *Matcher.Grammar {
+	t.Helper()
+	file := GBNFParser.ParseGrammarFile("", grammar)
+	if len(file.Errors) > 0 {
+		t.Fatalf("Unexpected parse error %s", file.Errors[0].Message)
+	}
+	compiled, err := Matcher.Compile(file.AST)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compiled
+}
+
+func TestPredict(t *testing.T) {
+	grammar := compileGrammar(t, `root ::= "{" ws "\"a\":" ws num ("," ws num){0,2} ws "}"
+num ::= [0-9]+
+ws ::= [ \n]*
+`)
+	cases := []struct {
+		prefix   string
+		accepted int
+		rejected bool
+		complete bool
+		next     string
+		forced   string
+	}{
+		{``, 0, false, false, `[{]`, `{`},
+		{`{ "`, 3, false, false, `[a]`, `a":`},
+		{`{"a": 1`, 7, false, false, `[\n ,0-9}]`, ``},
+		{`{"a":1,2,3,`, 10, true, false, `[\n 0-9}]`, ``},
+		{`{"a":1}`, 7, false, true, ``, ``},
+	}
+	for _, c := range cases {
+		prediction, err := Matcher.Predict(grammar, "root", c.prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next := ""
+		if len(prediction.Next) > 0 {
+			next = GBNFParser.FormatCharClass(prediction.Next, false)
+		}
+		if prediction.Accepted != c.accepted || prediction.Rejected != c.rejected || prediction.Complete != c.complete || next != c.next || prediction.Forced != c.forced {
+			t.Errorf("For %q expected %d %t %t %s %q, got %d %t %t %s %q", c.prefix,
+				c.accepted, c.rejected, c.complete, c.next, c.forced,
+				prediction.Accepted, prediction.Rejected, prediction.Complete, next, prediction.Forced)
+		}
+	}
+}
+
+func TestMatcherNegatedClassesAndRules(t *testing.T) {
+	grammar := compileGrammar(t, `root ::= item ("|" item)?
+item ::= [^|]+ | ""
+`)
+	matcher, err := grammar.NewMatcher("item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !matcher.IsComplete() {
+		t.Error("Expected the empty alternative to complete item")
+	}
+	for _, char := range "abé" {
+		if !matcher.Accept(char) {
+			t.Fatalf("Expected %q to be accepted", char)
+		}
+	}
+	if matcher.Accept('|') {
+		t.Error("Expected | to be rejected by item")
+	}
+	if _, err := grammar.NewMatcher("missing"); err == nil {
+		t.Error("Expected an error for an undeclared rule")
+	}
+}
+
+func TestCompileRejectsLeftRecursion(t *testing.T) {
+	cases := map[string]string{
+		"root ::= root \"a\" | \"b\"\n":                             "rule `root` is left-recursive",
+		"root ::= ws list\nlist ::= ws root \"x\"\nws ::= \" \"*\n": "is left-recursive",
+		"root ::= (\"\")*\n":                                        "rule `root` is left-recursive",
+		"root ::= missing\n":                                        "rule `missing` is not declared",
+	}
+	for grammar, expected := range cases {
+		_, err := Matcher.Compile(GBNFParser.ParseGrammarFile("", grammar).AST)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("For %q expected %q, got %v", grammar, expected, err)
+		}
+	}
+
+	compileGrammar(t, "root ::= \"(\" root \")\" | \"\"\n")
+}
+
+func TestExpandRepeat(t *testing.T) {
+	cases := []struct {
+		grammar    string
+		expression string
+		rules      []string
+		count      int
+	}{
+		{`key ::= [a-z]{2,4}`, "[a-z] [a-z] key_2", []string{"key_1 ::= [a-z] |", "key_2 ::= [a-z] key_1 |"}, 2},
+		{`key ::= ("a" | "b")+`, "key_1 key_2", []string{`key_1 ::= "a" | "b"`, "key_2 ::= key_1 key_2 |"}, 2},
+		{`key ::= "x"{0}`, "", []string{}, 0},
+		{`key ::= "x"{0,100}`, "key_100", []string{`key_1 ::= "x" |`, `key_2 ::= "x" key_1 |`}, 100},
+	}
+	for _, c := range cases {
+		file := GBNFParser.ParseGrammarFile("test.gbnf", c.grammar)
+		expansion := Matcher.ExpandRepeat("key", file.AST.Children[0].Children[0], 2)
+		if expansion.Expression != c.expression || expansion.RuleCount != c.count || !slices.Equal(expansion.Rules, c.rules) {
+			t.Errorf("Unexpected expansion of %s: %+v", c.grammar, expansion)
+		}
+	}
+}
+
+func TestMatcherDecodesLiteralsOnce(t *testing.T) {
+	cases := []struct {
+		grammar string
+		text    string
+		match   bool
+	}{
+		{`root ::= "\\\\"`, `\\`, true},
+		{`root ::= "\\\\"`, `\`, false},
+		{`root ::= "\\n"`, `\n`, true},
+		{`root ::= "\\n"`, "\n", false},
+		{`root ::= "\n"`, "\n", true},
+		{`root ::= "\""`, `"`, true},
+		{`root ::= "\x41\\x41"`, `A\x41`, true},
+	}
+	for _, c := range cases {
+		prediction, err := Matcher.Predict(compileGrammar(t, c.grammar), "root", c.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prediction.FullMatch() != c.match {
+			t.Errorf("%s: expected matching %q to be %v", c.grammar, c.text, c.match)
+		}
+	}
+}
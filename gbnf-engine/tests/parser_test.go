@@ -277,3 +277,107 @@ func TestErrorOnEmptyRule(t *testing.T) {
 		t.Fatalf("Expected an error.")
 	}
 }
+
+func TestParserAlternativePrecedence(t *testing.T) {
+	tokens := CollectTokens(`rule ::= "a" | "b" "c"`)
+	parser := GBNFParser.Parser{Tokens: tokens}
+	node, err := parser.ParseRule()
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(node.Children) != 1 || node.Children[0].Type != GBNFParser.NodeAlternative {
+		t.Fatalf("Expected a single NodeAlternative, got %+v", node.Children)
+	}
+	alts := node.Children[0].Children
+	if len(alts) != 2 || alts[1].Type != GBNFParser.NodeSubExpression || len(alts[1].Children) != 2 {
+		t.Errorf("Expected `\"b\" \"c\"` to be grouped as the second alternative, got %+v", alts)
+	}
+}
+
+func TestParserAlternativesShareOneNode(t *testing.T) {
+	tokens := CollectTokens(`rule ::= | "a" "b" | "c" | ("d" | "e") "f"`)
+	parser := GBNFParser.Parser{Tokens: tokens}
+	node, err := parser.ParseRule()
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(node.Children) != 1 || node.Children[0].Type != GBNFParser.NodeAlternative {
+		t.Fatalf("Expected a single NodeAlternative, got %+v", node.Children)
+	}
+	expectedTypes := []GBNFParser.NodeType{
+		GBNFParser.NodeUnknown,
+		GBNFParser.NodeSubExpression,
+		GBNFParser.NodeToken,
+		GBNFParser.NodeSubExpression,
+	}
+	alts := node.Children[0].Children
+	if len(alts) != len(expectedTypes) {
+		t.Fatalf("Expected %d alternatives, got %d", len(expectedTypes), len(alts))
+	}
+	for i, alt := range alts {
+		if alt.Type != expectedTypes[i] {
+			t.Errorf("Expected node type %v for alternative %d, got %v", expectedTypes[i], i, alt.Type)
+		}
+	}
+	if last := alts[3].Children; len(last) != 2 || last[0].Type != GBNFParser.NodeSubExpression || last[0].Children[0].Type != GBNFParser.NodeAlternative {
+		t.Errorf("Expected the nested alternative to stay inside its parentheses, got %+v", last)
+	}
+}
+
+func TestParserImport(t *testing.T) {
+	tokens := CollectTokens("# @import \"common.gbnf\"\nroot ::= ws")
+	parser := GBNFParser.NewParser(tokens)
+	root, errs := parser.ParseAllRules()
+
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	if root.Children[0].Type != GBNFParser.NodeImport || root.Children[0].Token.Value != "common.gbnf" {
+		t.Errorf("Expected NodeImport, got %+v", root.Children[0])
+	}
+	if root.Children[1].Type != GBNFParser.NodeDeclaration {
+		t.Errorf("Expected NodeDeclaration, got %+v", root.Children[1])
+	}
+}
+
+func TestParserRepeatRejectsMaxBelowMin(t *testing.T) {
+	parser := GBNFParser.Parser{Tokens: CollectTokens(`letters ::= [a-z]{4,2}`)}
+	_, err := parser.ParseRule()
+	if err == nil || err.Message != "repeat maximum 2 is less than minimum 4" {
+		t.Errorf("Expected an error about the bounds, got %v", err)
+	}
+}
+
+func TestParserNodeSpans(t *testing.T) {
+	parser := GBNFParser.Parser{Tokens: CollectTokens(`root ::= "a" ( b | [c] )+ | d`)}
+	node, err := parser.ParseRule()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	alternative := node.Children[0]
+	branch := alternative.Children[0]
+	repeat := branch.Children[1]
+	group := repeat.Children[0]
+	cases := []struct {
+		name     string
+		node     *GBNFParser.Node
+		expected GBNFParser.Span
+	}{
+		{"declaration", node, GBNFParser.Span{Line: 0, Column: 0, EndLine: 0, EndColumn: 29}},
+		{"alternative", alternative, GBNFParser.Span{Line: 0, Column: 9, EndLine: 0, EndColumn: 29}},
+		{"branch", branch, GBNFParser.Span{Line: 0, Column: 9, EndLine: 0, EndColumn: 25}},
+		{"repeat", repeat, GBNFParser.Span{Line: 0, Column: 13, EndLine: 0, EndColumn: 25}},
+		{"group", group, GBNFParser.Span{Line: 0, Column: 13, EndLine: 0, EndColumn: 24}},
+		{"group alternative", group.Children[0], GBNFParser.Span{Line: 0, Column: 15, EndLine: 0, EndColumn: 22}},
+	}
+	for _, c := range cases {
+		if c.node.Span != c.expected {
+			t.Errorf("Expected the %s to span %+v, got %+v", c.name, c.expected, c.node.Span)
+		}
+	}
+}
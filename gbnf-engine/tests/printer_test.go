@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/Matcher"
+	"testing"
+)
+
+func formatText(text string) string {
+	parser := GBNFParser.NewParser(CollectTokens(text))
+	root, _ := parser.ParseAllRules()
+	return GBNFParser.Format(root)
+}
+
+func TestFormatNormalisesWhitespace(t *testing.T) {
+	formatted := formatText("root   ::=  \"a\"   [0-9]{1, 3}\n\n\nrest ::=\n  ( x |y )*")
+	expected := "root ::= \"a\" [0-9]{1,3}\nrest ::= (x | y)*\n"
+
+	if formatted != expected {
+		t.Errorf("Expected %q, got %q", expected, formatted)
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	text := "# @import \"common.gbnf\"\nroot ::= | \"\\\"q\\\"\" \"\\n\" | [^\"\\\\] x? y+\nx ::= \"a\\\\\"\ny ::= \"b\"\n"
+	formatted := formatText(text)
+
+	if formatted != text {
+		t.Errorf("Expected %q, got %q", text, formatted)
+	}
+	if formatText(formatted) != formatted {
+		t.Errorf("Formatting is not idempotent: %q", formatText(formatted))
+	}
+}
+
+func TestFormatKeepsLanguage(t *testing.T) {
+	cases := []struct {
+		grammar string
+		texts   []string
+	}{
+		{`root ::= "\\n"`, []string{`\n`, "\n"}},
+		{`root ::= "\\\\" "\n"`, []string{"\\\\\n", "\\\n"}},
+		{`root ::= "\"\\" | "\x41"`, []string{`"\`, `A`, `\x41`}},
+		{`root ::= [\\n] "\t"`, []string{"\\\t", "n\t", "\n\t"}},
+	}
+	for _, c := range cases {
+		formatted := formatText(c.grammar)
+		original, reprinted := compileGrammar(t, c.grammar), compileGrammar(t, formatted)
+		for _, text := range c.texts {
+			before, err := Matcher.Predict(original, "root", text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, err := Matcher.Predict(reprinted, "root", text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if before.FullMatch() != after.FullMatch() {
+				t.Errorf("%s: formatted as %s, matching %q changed from %v to %v", c.grammar, formatted, text, before.FullMatch(), after.FullMatch())
+			}
+		}
+	}
+}
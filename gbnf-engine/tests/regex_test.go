@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"testing"
+
+	"gbnflsp/gbnf-engine/Regex"
+)
+
+func TestTranslateRegex(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		expected string
+	}{
+		{`^[a-z]+\d{2,}$`, `root ::= [a-z]+ [0-9]{2,}` + "\n"},
+		{`^(ab|c)?x*$`, `root ::= ("ab" | "c")? "x"*` + "\n"},
+		{`^[^"\\]$`, `root ::= [^"\\]` + "\n"},
+		{`^(?i)ok$`, "root ::= [Oo] [Kk\u212A]\n"},
+		{`^a|b$`, "root ::= (\"a\" root-char* | root-char* \"b\")\nroot-char ::= [\\x00-\\U0010FFFF]\n"},
+		{`^x{0}$`, `root ::= ""` + "\n"},
+		{`^ax{0,0}(?P<skipped>y){0}b$`, `root ::= "a" "b"` + "\n"},
+		{`^a(x{0})?$`, `root ::= "a"` + "\n"},
+		{`^(?P<year>\d{4})-(?P<month_number>\d\d)$`, "root ::= root-year \"-\" root-month-number\nroot-year ::= [0-9]{4}\nroot-month-number ::= [0-9] [0-9]\n"},
+	}
+	for _, c := range cases {
+		rules, err := Regex.Translate(c.pattern, Regex.Options{})
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", c.pattern, err)
+			continue
+		}
+		if grammar := Regex.Format(rules); grammar != c.expected {
+			t.Errorf("For %s expected %q, got %q", c.pattern, c.expected, grammar)
+		}
+	}
+}
+
+func TestTranslateRegexAnchoredOption(t *testing.T) {
+	rules, err := Regex.Translate(`[0-9]+`, Regex.Options{Name: "digits", Anchored: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].Expression != "[0-9]+" {
+		t.Errorf("Expected only [0-9]+, got %v", rules)
+	}
+}
+
+func TestTranslateRegexRejectsWordBoundaries(t *testing.T) {
+	if _, err := Regex.Translate(`^\bword$`, Regex.Options{}); err == nil {
+		t.Error("Expected an error for a word boundary")
+	}
+}
+
+func TestTranslateRegexNamesRulesUniquely(t *testing.T) {
+	rules, err := Regex.Translate(`^(?P<part>a)(?P<part>b)$`, Regex.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "root ::= root-part root-part-2\nroot-part ::= \"a\"\nroot-part-2 ::= \"b\"\n"
+	if grammar := Regex.Format(rules); grammar != expected {
+		t.Errorf("Expected %q, got %q", expected, grammar)
+	}
+
+	declared := map[string]bool{"root-part": true}
+	rules, err = Regex.Translate(`^(?P<part>a)$`, Regex.Options{RuleName: func(name string) string {
+		if declared[name] {
+			return name + "-new"
+		}
+		return name
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "root ::= root-part-new\nroot-part-new ::= \"a\"\n"
+	if grammar := Regex.Format(rules); grammar != expected {
+		t.Errorf("Expected %q, got %q", expected, grammar)
+	}
+}
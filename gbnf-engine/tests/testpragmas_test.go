@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"testing"
+
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/Matcher"
+)
+
+func TestParseTests(t *testing.T) {
+	text := `root ::= "a" # @test accept "not a pragma"
+# @test accept "{\"a\":1}"
+  #   @test reject value "[1,\n"
+# @testing accept "x"
+# @test maybe "x"
+# @test accept "x" y
+`
+	tests, errors := GBNFParser.ParseTests(text)
+	if len(tests) != 2 {
+		t.Fatalf("Expected 2 tests, got %d", len(tests))
+	}
+	if !tests[0].Accept || tests[0].Rule != "root" || tests[0].Text != `{"a":1}` || tests[0].Line != 1 {
+		t.Errorf("Unexpected first test %+v", tests[0])
+	}
+	if tests[1].Accept || tests[1].Rule != "value" || tests[1].Text != "[1,\n" || tests[1].Column != 2 || tests[1].EndColumn != 32 {
+		t.Errorf("Unexpected second test %+v", tests[1])
+	}
+
+	expected := []struct {
+		line    int
+		message string
+	}{
+		{4, "expected accept or reject after @test"},
+		{5, "unexpected text after the test string"},
+	}
+	if len(errors) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d", len(expected), len(errors))
+	}
+	for index, err := range errors {
+		if err.Line != expected[index].line || err.Message != expected[index].message {
+			t.Errorf("Expected %q on line %d, got %q on line %d", expected[index].message, expected[index].line, err.Message, err.Line)
+		}
+	}
+}
+
+func TestPredictionFailure(t *testing.T) {
+	grammar := compileGrammar(t, "root ::= \"[\" [0-9]+ \"]\"\n")
+	cases := map[string]string{
+		"[1x]": "character 2 ('x') is not allowed; expected [0-9\\]]",
+		"[1":   "the text ends early; expected [0-9\\]]",
+	}
+	for text, expected := range cases {
+		prediction, err := Matcher.Predict(grammar, "root", text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prediction.FullMatch() {
+			t.Errorf("Expected %q not to match", text)
+		}
+		if failure := prediction.Failure(text); failure != expected {
+			t.Errorf("For %q expected %q, got %q", text, expected, failure)
+		}
+	}
+}
+
+func TestParseTestsDecodesEscapesOnce(t *testing.T) {
+	text := `root ::= [a-z\\]+
+# @test accept "a\\nb"
+# @test reject "a\nb"
+# @test accept "\"é\t\\\""
+`
+	tests, errors := GBNFParser.ParseTests(text)
+	if len(errors) != 0 || len(tests) != 3 {
+		t.Fatalf("Expected 3 tests, got %v and errors %v", tests, errors)
+	}
+	expected := []string{`a\nb`, "a\nb", "\"é\t\\\""}
+	for index, test := range tests {
+		if test.Text != expected[index] {
+			t.Errorf("Expected test %d to check %q, got %q", index, expected[index], test.Text)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"gbnflsp/gbnf-engine/GBNFParser"
+	"gbnflsp/gbnf-engine/Transform"
+)
+
+func parseGrammar(t *testing.T, grammar string) *GBNFParser.Node {
+	t.Helper()
+	file := GBNFParser.ParseGrammarFile("test.gbnf", grammar)
+	if len(file.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %v", file.Errors[0].Message)
+	}
+	return file.AST
+}
+
+func declaration(ast *GBNFParser.Node, name string) *GBNFParser.Node {
+	for _, node := range ast.Children {
+		if node.Type == GBNFParser.NodeDeclaration && node.Token.Value == name {
+			return node
+		}
+	}
+	return nil
+}
+
+func expectGrammar(t *testing.T, ast *GBNFParser.Node, changes []Transform.Change, expected string) {
+	t.Helper()
+	if result := GBNFParser.Format(Transform.Apply(ast, changes)); result != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, result)
+	}
+	if file := GBNFParser.ParseGrammarFile("result.gbnf", expected); len(file.Errors) > 0 {
+		t.Errorf("Expected grammar does not parse: %s", file.Errors[0].Message)
+	}
+}
+
+func TestInlineRule(t *testing.T) {
+	cases := []struct {
+		grammar  string
+		expected string
+	}{
+		{"root ::= \"a\" item \"b\"\nitem ::= \"x\" \"y\"\n", "root ::= \"a\" \"x\" \"y\" \"b\"\n"},
+		{"root ::= \"a\" item\nitem ::= \"x\" | \"y\"\n", "root ::= \"a\" (\"x\" | \"y\")\n"},
+		{"root ::= item* \"a\"\nitem ::= \"x\" \"y\"\n", "root ::= (\"x\" \"y\")* \"a\"\n"},
+		{"root ::= \"a\" | item\nitem ::= \"x\" | \"y\" \"z\"\n", "root ::= \"a\" | \"x\" | \"y\" \"z\"\n"},
+		{"root ::= item\nitem ::= \"x\" | \"y\"\n", "root ::= \"x\" | \"y\"\n"},
+	}
+	for _, c := range cases {
+		ast := parseGrammar(t, c.grammar)
+		changes, err := Transform.InlineRule(ast, "item")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expectGrammar(t, ast, changes, c.expected)
+	}
+
+	ast := parseGrammar(t, "root ::= item item\nitem ::= \"x\"\nlist ::= \"[\" list? \"]\"\nroot2 ::= list\n")
+	for name, expected := range map[string]string{
+		"item":    "rule `item` is used more than once",
+		"list":    "rule `list` is recursive",
+		"root":    "rule `root` is not used",
+		"missing": "rule `missing` must be declared exactly once to be inlined",
+	} {
+		if _, err := Transform.InlineRule(ast, name); err == nil || err.Error() != expected {
+			t.Errorf("Expected error %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestExtractRule(t *testing.T) {
+	ast := parseGrammar(t, "root ::= \"{\" ws \"a\" ws \"}\"\nnew-rule ::= \"x\"\n")
+	root := declaration(ast, "root")
+	changes, name, err := Transform.ExtractRule(ast, root, root, 1, 3, "new-rule")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if name != "new-rule-2" {
+		t.Errorf("Expected the new rule to be named new-rule-2, got %s", name)
+	}
+	expectGrammar(t, ast, changes, "root ::= \"{\" new-rule-2 ws \"}\"\nnew-rule-2 ::= ws \"a\"\nnew-rule ::= \"x\"\n")
+
+	ast = parseGrammar(t, "root ::= (ws \"a\")*\nws ::= \" \"\n")
+	root = declaration(ast, "root")
+	group := root.Children[0].Children[0]
+	changes, _, err = Transform.ExtractRule(ast, root, group, 0, 2, "item")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectGrammar(t, ast, changes, "root ::= item*\nitem ::= ws \"a\"\nws ::= \" \"\n")
+
+	ast = parseGrammar(t, "root ::= \"a\" | \"b\" | \"c\"\n")
+	root = declaration(ast, "root")
+	changes, _, err = Transform.ExtractRule(ast, root, root.Children[0], 1, 3, "letter")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectGrammar(t, ast, changes, "root ::= \"a\" | letter\nletter ::= \"b\" | \"c\"\n")
+}
+
+func TestMergeIdenticalRules(t *testing.T) {
+	ast := parseGrammar(t, `root ::= a b digits
+a ::= [0-9]+
+b ::= "x" digits
+digits ::= [0-9]+
+`)
+	groups := Transform.IdenticalRules(ast)
+	if len(groups) != 1 || len(groups[0]) != 2 {
+		t.Fatalf("Expected one group of two identical rules, got %v", groups)
+	}
+	expectGrammar(t, ast, Transform.MergeIdenticalRules(ast), "root ::= a b a\na ::= [0-9]+\nb ::= \"x\" a\n")
+}
+
+func TestFlattenAlternatives(t *testing.T) {
+	ast := parseGrammar(t, `root ::= "a" | ("b" | ("c" | "d") | "e") "f"`)
+	change, ok := Transform.FlattenAlternatives(declaration(ast, "root"))
+	if !ok {
+		t.Fatalf("Expected nested alternatives to be flattened")
+	}
+	expectGrammar(t, ast, []Transform.Change{change}, "root ::= \"a\" | (\"b\" | \"c\" | \"d\" | \"e\") \"f\"\n")
+	// The printer drops the parentheses of nested alternatives either way.
+	if nested := change.Replacement[0].Children[0].Children[1].Children[0].Children[0]; len(nested.Children) != 4 {
+		t.Errorf("Expected 4 branches in the group, got %d", len(nested.Children))
+	}
+
+	ast = parseGrammar(t, `root ::= "a" | "b"`)
+	if _, ok := Transform.FlattenAlternatives(declaration(ast, "root")); ok {
+		t.Errorf("Expected nothing to flatten")
+	}
+}
+
+func TestFactorPrefixes(t *testing.T) {
+	cases := []struct {
+		grammar  string
+		expected string
+	}{
+		{`root ::= "ab" | "ac"`, "root ::= \"a\" (\"b\" | \"c\")\n"},
+		{`root ::= "true" | "null" | "tree" | [0-9]`, "root ::= \"tr\" (\"ue\" | \"ee\") | \"null\" | [0-9]\n"},
+		{`root ::= "a" | "ab" ws`, "root ::= \"a\" (\"b\" ws)?\n"},
+		{`root ::= "abc" | "abd" | "ax"`, "root ::= \"a\" (\"b\" (\"c\" | \"d\") | \"x\")\n"},
+		{`root ::= "\n1" | "\n2"`, "root ::= \"\\n\" (\"1\" | \"2\")\n"},
+		{`root ::= ws "a" | ws "b"`, "root ::= ws (\"a\" | \"b\")\n"},
+		{`root ::= "ab" | "d" "e" | "ac"`, "root ::= \"a\" (\"b\" | \"c\") | \"d\" \"e\"\n"},
+		{`root ::= "\\a" | "\\b" | "\"c"`, "root ::= \"\\\\\" (\"a\" | \"b\") | \"\\\"c\"\n"},
+	}
+	for _, c := range cases {
+		ast := parseGrammar(t, c.grammar)
+		change, ok := Transform.FactorPrefixes(declaration(ast, "root"))
+		if !ok {
+			t.Errorf("Expected %s to be factored", c.grammar)
+			continue
+		}
+		expectGrammar(t, ast, []Transform.Change{change}, c.expected)
+	}
+
+	for _, grammar := range []string{`root ::= "a" | "b"`, `root ::= "a" | "b" "c"`, `root ::= ("x" "y" | "z") "w"`} {
+		ast := parseGrammar(t, grammar)
+		if _, ok := Transform.FactorPrefixes(declaration(ast, "root")); ok {
+			t.Errorf("Expected nothing to factor in %s", grammar)
+		}
+	}
+}
+
+func TestMergeDeclarations(t *testing.T) {
+	ast := parseGrammar(t, `root ::= value
+value ::= "true" | "false"
+other ::= "x"
+value ::= [0-9]+ ws
+`)
+	changes, err := Transform.MergeDeclarations(ast, "value")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectGrammar(t, ast, changes, "root ::= value\nvalue ::= \"true\" | \"false\" | [0-9]+ ws\nother ::= \"x\"\n")
+
+	if _, err := Transform.MergeDeclarations(ast, "other"); err == nil {
+		t.Errorf("Expected an error for a rule declared once")
+	}
+}
+
+func TestKeepLastDeclaration(t *testing.T) {
+	ast := parseGrammar(t, `root ::= value
+value ::= "true" | "false"
+other ::= "x"
+value ::= [0-9]+ ws
+`)
+	changes, err := Transform.KeepLastDeclaration(ast, "value")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectGrammar(t, ast, changes, "root ::= value\nother ::= \"x\"\nvalue ::= [0-9]+ ws\n")
+
+	if _, err := Transform.KeepLastDeclaration(ast, "other"); err == nil {
+		t.Errorf("Expected an error for a rule declared once")
+	}
+}
+
+func TestIdenticalRulesCompareLiteralsAsWritten(t *testing.T) {
+	ast := parseGrammar(t, `root ::= a b c
+a ::= "\\n"
+b ::= "\n"
+c ::= "\n"
+`)
+	groups := Transform.IdenticalRules(ast)
+	if len(groups) != 1 || groups[0][0].Token.Value != "b" || groups[0][1].Token.Value != "c" {
+		t.Fatalf("Expected only b and c to be identical, got %v", groups)
+	}
+}
+
+// applyEdits applies edits, in source order, to text.
+func applyEdits(text string, edits []Transform.Edit) string {
+	lines := strings.SplitAfter(text, "\n")
+	offset := func(line int, column int) int {
+		total := 0
+		for _, previous := range lines[:line] {
+			total += len([]rune(previous))
+		}
+		return total + column
+	}
+	runes := []rune(text)
+	for index := len(edits) - 1; index >= 0; index-- {
+		span := edits[index].Span
+		start, end := offset(span.Line, span.Column), offset(span.EndLine, span.EndColumn)
+		runes = append(runes[:start], append([]rune(edits[index].Text), runes[end:]...)...)
+	}
+	return string(runes)
+}
+
+func TestDeclarationEdits(t *testing.T) {
+	text := "root ::= (a # first\n  | b \"y\") # second\na ::= \"x\"\nb ::= \"x\"\n"
+	ast := parseGrammar(t, text)
+	changes := Transform.MergeIdenticalRules(ast)
+	if len(changes) != 2 || len(changes[0].Replacement) != 1 {
+		t.Fatalf("Expected root to change and b to be removed, got %v", changes)
+	}
+	edits, ok := Transform.DeclarationEdits(changes[0].Declaration, changes[0].Replacement[0])
+	if !ok || len(edits) != 1 || edits[0].Text != "a" {
+		t.Fatalf("Expected a single edit of the reference to b, got %v", edits)
+	}
+	expected := "root ::= (a # first\n  | a \"y\") # second\na ::= \"x\"\nb ::= \"x\"\n"
+	if result := applyEdits(text, edits); result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+
+	text = "root ::= \"{\" ws \"a\" ws \"}\" # keep\n"
+	ast = parseGrammar(t, text)
+	root := declaration(ast, "root")
+	changes, _, err := Transform.ExtractRule(ast, root, root, 1, 3, "item")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	edits, ok = Transform.DeclarationEdits(changes[0].Declaration, changes[0].Replacement[0])
+	expected = "root ::= \"{\" item ws \"}\" # keep\n"
+	if !ok || applyEdits(text, edits) != expected {
+		t.Errorf("Expected %q, got %q", expected, applyEdits(text, edits))
+	}
+}
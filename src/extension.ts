@@ -107,6 +107,22 @@ export async function activate(context: vscode.ExtensionContext) {
   outputChannel = vscode.window.createOutputChannel("GBNF LSP");
   outputChannel.show();
 
+  // The server asks for a rename after extracting a rule, so the new rule
+  // can be named right away.
+  context.subscriptions.push(
+    vscode.commands.registerCommand(
+      "gbnf.startRename",
+      async (uri: string, position: { line: number; character: number }) => {
+        const editor = await vscode.window.showTextDocument(
+          vscode.Uri.parse(uri)
+        );
+        const cursor = new vscode.Position(position.line, position.character);
+        editor.selection = new vscode.Selection(cursor, cursor);
+        await vscode.commands.executeCommand("editor.action.rename");
+      }
+    )
+  );
+
   outputChannel.appendLine("Extension activating...");
 
   try {
@@ -135,6 +151,8 @@ export async function activate(context: vscode.ExtensionContext) {
       documentSelector: [{ scheme: "file", language: "gbnf" }],
       outputChannel: outputChannel,
       traceOutputChannel: outputChannel,
+      initializationOptions: vscode.workspace.getConfiguration("gbnf"),
+      synchronize: { configurationSection: "gbnf" },
     };
 
     client = new LanguageClient(